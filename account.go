@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// CSV of sort code prefixes (3, 4 or 8 digits), bank and optional branch names, replacing the bundled list
+var bankDirectoryFile = getEnv("BANK_DIRECTORY", "")
+
+// Bank identifiers (first three sort code digits) of the main commercial banks
+var bankDirectory = map[string]bankEntry{
+	"101": {bank: "Narodowy Bank Polski"},
+	"102": {bank: "PKO Bank Polski"},
+	"103": {bank: "Bank Handlowy w Warszawie (Citi Handlowy)"},
+	"105": {bank: "ING Bank Śląski"},
+	"109": {bank: "Santander Bank Polska"},
+	"113": {bank: "Bank Gospodarstwa Krajowego"},
+	"114": {bank: "mBank"},
+	"116": {bank: "Bank Millennium"},
+	"124": {bank: "Bank Polska Kasa Opieki (Pekao)"},
+	"132": {bank: "Bank Pocztowy"},
+	"154": {bank: "Bank Ochrony Środowiska"},
+	"156": {bank: "VeloBank"},
+	"158": {bank: "Mercedes-Benz Bank Polska"},
+	"160": {bank: "BNP Paribas Bank Polska"},
+	"161": {bank: "SGB-Bank"},
+	"187": {bank: "Nest Bank"},
+	"193": {bank: "Bank Polskiej Spółdzielczości"},
+	"194": {bank: "Credit Agricole Bank Polska"},
+	"203": {bank: "BNP Paribas Bank Polska"},
+	"212": {bank: "Santander Consumer Bank"},
+	"213": {bank: "Volkswagen Bank"},
+	"216": {bank: "Toyota Bank Polska"},
+	"249": {bank: "Alior Bank"},
+}
+
+// Bank and branch a sort code prefix belongs to
+type bankEntry struct {
+	bank   string
+	branch string
+}
+
+// Validated Polish account number in both notations
+type AccountInfo struct {
+	Response      string `json:"response"`
+	Input         string `json:"input"`
+	Valid         bool   `json:"valid"`
+	NRB           string `json:"nrb,omitempty"`
+	NRBFormatted  string `json:"nrbFormatted,omitempty"`
+	IBAN          string `json:"iban,omitempty"`
+	IBANFormatted string `json:"ibanFormatted,omitempty"`
+	// Digits 3-10, the bank (3), branch (4) and check digit (1)
+	SortCode      string       `json:"sortCode,omitempty"`
+	SortCodeValid *bool        `json:"sortCodeValid,omitempty"`
+	Bank          string       `json:"bank,omitempty"`
+	Branch        string       `json:"branch,omitempty"`
+	Errors        []FieldError `json:"errors,omitempty"`
+}
+
+// 📌 Replace the bundled bank list with BANK_DIRECTORY
+func loadBankDirectory() error {
+	if bankDirectoryFile == "" {
+		return nil
+	}
+	file, err := os.Open(bankDirectoryFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	input := bufio.NewReader(file)
+	firstLine, _ := input.Peek(4096)
+	reader := csv.NewReader(input)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	if line, _, _ := strings.Cut(string(firstLine), "\n"); strings.Count(line, ";") > strings.Count(line, ",") {
+		reader.Comma = ';'
+	}
+	records, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	directory := make(map[string]bankEntry, len(records))
+	for _, record := range records {
+		if len(record) < 2 {
+			continue
+		}
+		// Header rows and comments have no numeric code
+		code := strings.ReplaceAll(strings.TrimSpace(strings.TrimPrefix(record[0], "\ufeff")), " ", "")
+		if !isDigits(code) || (len(code) != 3 && len(code) != 4 && len(code) != 8) {
+			continue
+		}
+		entry := bankEntry{bank: strings.TrimSpace(record[1])}
+		if len(record) > 2 {
+			entry.branch = strings.TrimSpace(record[2])
+		}
+		directory[code] = entry
+	}
+	bankDirectory = directory
+	log.Printf("[INFO] Loaded %d sort codes from %s", len(directory), bankDirectoryFile)
+	return nil
+}
+
+// 📌 Find the bank of a sort code, the most specific prefix wins
+func lookupBank(code string) bankEntry {
+	for _, length := range []int{8, 4, 3} {
+		if entry, ok := bankDirectory[code[:length]]; ok {
+			return entry
+		}
+	}
+	if code[0] == '8' {
+		// Cooperative banks have four-digit identifiers from 8000 up
+		return bankEntry{bank: "Bank spółdzielczy"}
+	}
+	return bankEntry{}
+}
+
+// 📌 Check the sort code check digit (weights 3, 9, 7, 1, 3, 9, 7 modulo 10)
+func validSortCode(code string) bool {
+	sum := 0
+	for i, weight := range []int{3, 9, 7, 1, 3, 9, 7} {
+		sum += int(code[i]-'0') * weight
+	}
+	return (10-sum%10)%10 == int(code[7]-'0')
+}
+
+// 📌 Split digits into groups, the first of `head` digits and the rest of four
+func groupDigits(value string, head int) string {
+	groups := []string{value[:head]}
+	for i := head; i < len(value); i += 4 {
+		groups = append(groups, value[i:min(i+4, len(value))])
+	}
+	return strings.Join(groups, " ")
+}
+
+// 📌 Validate an NRB or PL IBAN, in any spacing, and describe it in both notations
+func describeAccount(input string) AccountInfo {
+	info := AccountInfo{Response: "OK", Input: input}
+	value := strings.ToUpper(strings.NewReplacer(" ", "", "-", "", "\u00a0", "").Replace(strings.TrimSpace(input)))
+	reject := func(code string, message string) AccountInfo {
+		info.Errors = []FieldError{{Field: "number", Code: code, Message: message}}
+		return info
+	}
+
+	switch {
+	case value == "":
+		return reject("MISSING", "Account number is required")
+	case len(value) >= 2 && value[0] >= 'A' && value[0] <= 'Z' && !strings.HasPrefix(value, "PL"):
+		return reject("FOREIGN_ACCOUNT", "Only Polish accounts (NRB or PL IBAN) are supported")
+	}
+	value = strings.TrimPrefix(value, "PL")
+	switch {
+	case !isDigits(value):
+		return reject("NOT_NUMERIC", "Account number must contain digits only after the optional PL prefix")
+	case len(value) != 26:
+		return reject("WRONG_LENGTH", "Account number must have 26 digits")
+	}
+
+	info.NRB = value
+	info.NRBFormatted = groupDigits(value, 2)
+	info.IBAN = "PL" + value
+	info.IBANFormatted = groupDigits(info.IBAN, 4)
+	info.SortCode = sortCode(value)
+	sortCodeValid := validSortCode(info.SortCode)
+	info.SortCodeValid = &sortCodeValid
+	entry := lookupBank(info.SortCode)
+	info.Bank, info.Branch = entry.bank, entry.branch
+	if !validNRBChecksum(value) {
+		return reject("INVALID_CHECKSUM", "Account check digits do not match")
+	}
+	info.Valid = true
+	return info
+}
+
+// 📌 Handle /account API endpoint, GET ?number= for one account or POST a JSON array of numbers
+func accountHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(describeAccount(r.URL.Query().Get("number")))
+	case http.MethodPost:
+		var numbers []string
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, int64(batchMaxItems)*64+1024)).Decode(&numbers); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Invalid request, expected a JSON array of account numbers"})
+			return
+		}
+		if len(numbers) > batchMaxItems {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Too many account numbers"})
+			return
+		}
+		results := make([]AccountInfo, len(numbers))
+		for i, number := range numbers {
+			results[i] = describeAccount(number)
+		}
+		json.NewEncoder(w).Encode(results)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Use GET or POST"})
+	}
+}
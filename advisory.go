@@ -0,0 +1,108 @@
+package main
+
+import (
+	"log"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	// Payments above this amount in PLN fall under the whitelist and split payment rules
+	advisoryThreshold = getEnvFloat("ADVISORY_THRESHOLD", 15000)
+	// PLN per unit of the other accepted currencies, e.g. "EUR=4.2693,USD=3.9512"
+	exchangeRates = parseExchangeRates(getEnv("EXCHANGE_RATES", ""))
+	// Recommend split payment for whitelisted accounts of active VAT payers above the threshold
+	splitPaymentAdvice = getEnvBool("SPLIT_PAYMENT_ADVICE", true)
+)
+
+// Payment advisory of a verification with an amount
+type Advisory struct {
+	// BELOW_THRESHOLD, PAYMENT_ALLOWED, SPLIT_PAYMENT_RECOMMENDED, SPLIT_PAYMENT_REQUIRED, NOTIFY_TAX_OFFICE or WHITELIST_REQUIRED
+	Code      string  `json:"code"`
+	Message   string  `json:"message"`
+	Amount    string  `json:"amount"`
+	Currency  string  `json:"currency"`
+	AmountPLN float64 `json:"amountPLN"`
+	Threshold float64 `json:"threshold"`
+}
+
+// Amount of a payment, converted to PLN
+type paymentAmount struct {
+	value    string
+	currency string
+	pln      float64
+}
+
+// 📌 Parse EXCHANGE_RATES, entries that are not CODE=rate are skipped with a warning
+func parseExchangeRates(value string) map[string]float64 {
+	rates := map[string]float64{"PLN": 1}
+	for _, entry := range splitList(value) {
+		code, rate, _ := strings.Cut(entry, "=")
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(rate), 64)
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if err != nil || parsed <= 0 || len(code) != 3 {
+			log.Printf("[WARNING] Invalid EXCHANGE_RATES entry %q, expected CODE=rate", entry)
+			settingProblems = append(settingProblems, "EXCHANGE_RATES entry "+strconv.Quote(entry)+" is not CODE=rate")
+			continue
+		}
+		rates[code] = parsed
+	}
+	return rates
+}
+
+// 📌 Parse the amount and currency parameters, nil without an amount
+func parseAmount(value string, currency string) (*paymentAmount, []FieldError) {
+	if value == "" {
+		if currency != "" {
+			return nil, []FieldError{{Field: "amount", Code: "MISSING", Message: "currency requires amount"}}
+		}
+		return nil, nil
+	}
+
+	// Accept "15000.00", "15 000,00" and "15000"
+	normalized := strings.ReplaceAll(strings.ReplaceAll(value, " ", ""), ",", ".")
+	parsed, err := strconv.ParseFloat(normalized, 64)
+	if err != nil || parsed < 0 || math.IsInf(parsed, 0) || math.IsNaN(parsed) {
+		return nil, []FieldError{{Field: "amount", Code: "INVALID_AMOUNT", Message: "Amount must be a non-negative decimal number, e.g. 15000.00"}}
+	}
+	currency = strings.ToUpper(currency)
+	if currency == "" {
+		currency = "PLN"
+	}
+	rate, ok := exchangeRates[currency]
+	if !ok {
+		return nil, []FieldError{{Field: "currency", Code: "UNSUPPORTED_CURRENCY", Message: "No exchange rate for " + currency + ", set EXCHANGE_RATES"}}
+	}
+	return &paymentAmount{value: normalized, currency: currency, pln: math.Round(parsed*rate*100) / 100}, nil
+}
+
+// 📌 Add the payment advisory for an amount to a verification response
+func annotateAdvisory(result *Response, amount *paymentAmount, bankRequested bool) {
+	if amount == nil || result.Response != "OK" {
+		return
+	}
+	advisory := &Advisory{Amount: amount.value, Currency: amount.currency, AmountPLN: amount.pln, Threshold: advisoryThreshold}
+	matched := result.Bank == "MATCHED"
+	switch {
+	case amount.pln <= advisoryThreshold:
+		advisory.Code = "BELOW_THRESHOLD"
+		advisory.Message = "Whitelist and split payment rules do not apply to this amount"
+	case !bankRequested || result.Status == "UNVERIFIED":
+		advisory.Code = "WHITELIST_REQUIRED"
+		advisory.Message = "Verify the bank account against the whitelist before paying"
+	case matched && result.Status == "ACTIVE" && splitPaymentAdvice:
+		advisory.Code = "SPLIT_PAYMENT_RECOMMENDED"
+		advisory.Message = "Account is on the whitelist; pay with split payment, mandatory for goods and services of Annex 15"
+	case matched:
+		advisory.Code = "PAYMENT_ALLOWED"
+		advisory.Message = "Account is on the whitelist"
+	case result.Status == "ACTIVE":
+		advisory.Code = "SPLIT_PAYMENT_REQUIRED"
+		advisory.Message = "Account is not on the whitelist; pay with split payment or notify the tax office (ZAW-NR) within 7 days"
+	default:
+		advisory.Code = "NOTIFY_TAX_OFFICE"
+		advisory.Message = "Account is not on the whitelist; notify the tax office (ZAW-NR) within 7 days of the payment"
+	}
+	result.Advisory = advisory
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+type tenantKey struct{}
+
+// Roles a caller can hold, admin implies every other role
+const (
+	roleVerify  = "verify"
+	roleBatch   = "batch"
+	roleAuditor = "auditor"
+	roleAdmin   = "admin"
+)
+
+// Roles of keys configured without any, the access API keys always had
+var defaultRoles = []string{roleVerify, roleBatch}
+
+// Configured API key: its name (the tenant) and the roles it was granted
+type apiKey struct {
+	Name  string
+	Roles map[string]bool
+}
+
+// API keys as "name:key[:role|role]" entries, /verify is open when none are configured
+var apiKeys = parseAPIKeys(getSecret("API_KEYS", ""))
+
+// Keys managed through /admin/keys, by SHA-256 of the key; guarded by secretsMu like apiKeys
+var managedKeys = make(map[string]apiKey)
+
+// How often managed keys are re-read, so keys added on another replica sharing the store apply
+const managedKeysRefreshInterval = time.Minute
+
+// 📌 Grant a list of role names, logging unknown ones
+func grantRoles(name string, roles []string) map[string]bool {
+	granted := make(map[string]bool)
+	for _, role := range roles {
+		switch role = strings.ToLower(strings.TrimSpace(role)); role {
+		case roleVerify, roleBatch, roleAuditor, roleAdmin:
+			granted[role] = true
+		default:
+			log.Printf("[WARNING] Ignoring unknown role %q of API key %s", role, name)
+		}
+	}
+	return granted
+}
+
+// 📌 Parse comma-separated "name:key[:role|role]" entries into key -> API key
+func parseAPIKeys(value string) map[string]apiKey {
+	keys := make(map[string]apiKey)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, rest, ok := strings.Cut(entry, ":")
+		key, roleList, _ := strings.Cut(rest, ":")
+		if !ok || name == "" || key == "" {
+			log.Printf("[WARNING] Ignoring malformed API key entry (expected name:key)")
+			continue
+		}
+
+		roles := defaultRoles
+		if roleList != "" {
+			roles = strings.Split(roleList, "|")
+		}
+		keys[key] = apiKey{Name: name, Roles: grantRoles(name, roles)}
+	}
+	return keys
+}
+
+// 📌 Find the configured API key matching a presented key
+func lookupAPIKey(key string) (apiKey, bool) {
+	var matched apiKey
+	found := false
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	// Compare against every key so timing does not reveal a prefix match
+	for candidate, configured := range apiKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(candidate)) == 1 {
+			matched, found = configured, true
+		}
+	}
+	hash := apiKeyHash(key)
+	for candidate, managed := range managedKeys {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(candidate)) == 1 {
+			matched, found = managed, true
+		}
+	}
+	return matched, found
+}
+
+// 📌 Read the managed API keys from the store
+func loadManagedKeys() error {
+	stored, err := store.APIKeys()
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]apiKey, len(stored))
+	for _, key := range stored {
+		keys[key.KeySHA256] = apiKey{Name: key.Name, Roles: grantRoles(key.Name, key.Roles)}
+	}
+
+	secretsMu.Lock()
+	managedKeys = keys
+	secretsMu.Unlock()
+	return nil
+}
+
+// 📌 Re-read managed API keys every minute
+func runManagedKeysRefresh() {
+	ticker := time.NewTicker(managedKeysRefreshInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := loadManagedKeys(); err != nil {
+			log.Printf("[WARNING] Reading API keys failed, keeping the current ones: %v", err)
+		}
+	}
+}
+
+// 📌 Handle /admin/keys API endpoint: list (GET), create (POST {"name","roles"}) or revoke (DELETE ?name=) managed keys
+func keysHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		stored, err := store.APIKeys()
+		if err != nil {
+			log.Printf("[ERROR] Reading API keys failed: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Reading API keys failed"})
+			return
+		}
+		keys := make([]StoredAPIKey, 0, len(stored))
+		for _, key := range stored {
+			key.KeySHA256 = ""
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+		json.NewEncoder(w).Encode(keys)
+	case http.MethodPost:
+		var request StoredAPIKey
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&request); err != nil || request.Name == "" || strings.ContainsAny(request.Name, ":,") {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Invalid key, expected {\"name\", \"roles\"}"})
+			return
+		}
+		if len(request.Roles) == 0 {
+			request.Roles = defaultRoles
+		}
+		granted := grantRoles(request.Name, request.Roles)
+		if len(granted) != len(request.Roles) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Unknown role, use verify, batch, auditor or admin"})
+			return
+		}
+
+		secret := make([]byte, 32)
+		_, _ = rand.Read(secret)
+		key := hex.EncodeToString(secret)
+		stored := StoredAPIKey{Name: request.Name, KeySHA256: apiKeyHash(key), Roles: request.Roles, CreatedAt: time.Now().UTC()}
+		if err := store.AddAPIKey(stored); errors.Is(err, errAPIKeyExists) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "API key " + request.Name + " exists"})
+			return
+		} else if err != nil {
+			log.Printf("[ERROR] Creating API key failed: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Creating API key failed"})
+			return
+		}
+		_ = loadManagedKeys()
+		log.Printf("[INFO] API key %s created", request.Name)
+
+		// The key itself is shown only in this response
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{"name": stored.Name, "key": key, "roles": stored.Roles, "createdAt": stored.CreatedAt})
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		ok, err := store.DeleteAPIKey(name)
+		if err != nil {
+			log.Printf("[ERROR] Revoking API key failed: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Revoking API key failed"})
+			return
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Unknown API key"})
+			return
+		}
+		_ = loadManagedKeys()
+		log.Printf("[INFO] API key %s revoked", name)
+		json.NewEncoder(w).Encode(Response{Response: "OK", Message: "API key revoked"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Use GET, POST or DELETE"})
+	}
+}
+
+// 📌 Tenant (API key name) of an authenticated request
+func tenantFromRequest(r *http.Request) string {
+	tenant, _ := r.Context().Value(tenantKey{}).(string)
+	return tenant
+}
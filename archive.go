@@ -0,0 +1,111 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 📌 Detect the archive format from the magic bytes: "7z", "zip", "gzip" or "json"
+func detectArchiveFormat(file string) (string, error) {
+	input, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer input.Close()
+
+	header, err := bufio.NewReader(input).Peek(6)
+	if err != nil && len(header) == 0 {
+		return "", err
+	}
+
+	switch {
+	case bytes.HasPrefix(header, []byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C}):
+		return "7z", nil
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")):
+		return "zip", nil
+	case bytes.HasPrefix(header, []byte{0x1F, 0x8B}):
+		return "gzip", nil
+	case bytes.HasPrefix(bytes.TrimLeft(bytes.TrimPrefix(header, []byte("\xEF\xBB\xBF")), " \t\r\n"), []byte("{")):
+		return "json", nil
+	}
+	return "", errors.New("unknown file format")
+}
+
+// 📌 Name of an archive without its extensions (20250101.json.gz → 20250101)
+func archiveBaseName(file string) string {
+	name := filepath.Base(file)
+	if index := strings.Index(name, "."); index > 0 {
+		return name[:index]
+	}
+	return name
+}
+
+// 📌 Write a stream into a new file
+func writeStream(r io.Reader, path string) error {
+	output, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(output, r); err != nil {
+		output.Close()
+		return err
+	}
+	return output.Close()
+}
+
+// 📌 Extract the flat-file JSON from a `.zip` archive
+func extractZip(file string, jsonPath string) error {
+	archive, err := zip.OpenReader(file)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	// Prefer the entry named like the target, otherwise take the only JSON entry
+	var match *zip.File
+	var candidates []*zip.File
+	for _, entry := range archive.File {
+		if strings.EqualFold(filepath.Ext(entry.Name), ".json") {
+			candidates = append(candidates, entry)
+			if filepath.Base(entry.Name) == filepath.Base(jsonPath) {
+				match = entry
+			}
+		}
+	}
+	if match == nil && len(candidates) == 1 {
+		match = candidates[0]
+	}
+	if match == nil {
+		return errors.New("zip archive does not contain a single JSON file")
+	}
+
+	content, err := match.Open()
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	return writeStream(content, jsonPath)
+}
+
+// 📌 Decompress a `.gz` file
+func extractGzip(file string, jsonPath string) error {
+	input, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	decompressed, err := gzip.NewReader(input)
+	if err != nil {
+		return err
+	}
+	defer decompressed.Close()
+	return writeStream(decompressed, jsonPath)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+type rolesKey struct{}
+
+// Bearer token protecting admin and peer endpoints, it holds every role
+var adminToken = getSecret("ADMIN_TOKEN", "")
+
+// 📌 Extract the bearer token from the Authorization header
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// 📌 Check whether callers have to authenticate, with API keys or JWTs configured
+func authRequired() bool {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	return len(apiKeys) > 0 || len(managedKeys) > 0 || oidcIssuer != ""
+}
+
+// 📌 Check whether an authenticated request holds a role
+func hasRole(r *http.Request, role string) bool {
+	roles, ok := r.Context().Value(rolesKey{}).(map[string]bool)
+	if !ok {
+		// Without authentication the verification endpoints stay open
+		return !authRequired() && (role == roleVerify || role == roleBatch)
+	}
+	return roles[roleAdmin] || roles[role]
+}
+
+// 📌 Require a caller holding role: the admin bearer token, a JWT or an X-API-Key granted it
+//
+// Without API_KEYS and OIDC_ISSUER the verify and batch endpoints are open and
+// the admin and auditor endpoints accept the admin token only.
+func requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	public := role == roleVerify || role == roleBatch
+	limited := next
+	if public {
+		limited = limitRate(injectFaults(next))
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, admin := bearerToken(r), readSecret(&adminToken)
+		if admin != "" && subtle.ConstantTimeCompare([]byte(token), []byte(admin)) == 1 {
+			next(w, r.WithContext(context.WithValue(r.Context(), rolesKey{}, map[string]bool{roleAdmin: true})))
+			return
+		}
+
+		var name, kind string
+		var roles map[string]bool
+		switch {
+		case oidcIssuer != "" && isJWT(token):
+			identity, err := verifyJWT(token)
+			if err != nil {
+				// The reason (JWKS fetch errors, claims) stays in the log, clients only learn the token was refused
+				log.Printf("[WARNING] Rejected a bearer token: %v", err)
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Invalid bearer token"})
+				return
+			}
+			name, kind, roles = identity.Tenant, "Token", identity.Roles
+		case !authRequired():
+			if public {
+				limited(w, r)
+				return
+			}
+			if admin == "" {
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Admin endpoints are disabled, set ADMIN_TOKEN"})
+				return
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Unauthorized"})
+			return
+		default:
+			key, ok := lookupAPIKey(r.Header.Get("X-API-Key"))
+			if !ok {
+				message := "Missing or invalid API key"
+				if oidcIssuer != "" {
+					message = "Missing or invalid API key or bearer token"
+				}
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: message})
+				return
+			}
+			name, kind, roles = key.Name, "API key", key.Roles
+		}
+
+		if !roles[roleAdmin] && !roles[role] {
+			recordUsage(name, "ERROR")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: kind + " lacks the " + role + " role"})
+			return
+		}
+		ctx := context.WithValue(r.Context(), tenantKey{}, name)
+		limited(w, r.WithContext(context.WithValue(ctx, rolesKey{}, roles)))
+	}
+}
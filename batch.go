@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"sort"
+	"sync"
+
+	"pl-vatbank-checker/whitelist"
+)
+
+// Largest accepted batch
+var batchMaxItems = getEnvInt("BATCH_MAX_ITEMS", 50000)
+
+// Single entry of a batch request, the same as the embeddable handler's
+type BatchItem = whitelist.BatchItem
+
+// Batch entry as sent, with the client references echoed in its line
+type batchRequestItem struct {
+	BatchItem
+	Correlation
+}
+
+// Single line of a batch response, Index points into the request array
+type BatchResult struct {
+	Index int    `json:"index"`
+	NIP   string `json:"nip"`
+	Bank  string `json:"bankAccount,omitempty"`
+	Response
+}
+
+// 📌 Verify a batch on a worker pool, calling emit once per unique input with all its indexes
+//
+// Duplicates are verified once. For NIP-only batches (supplier master syncs)
+// this means every distinct NIP costs exactly one hash chain.
+func verifyBatch(items []BatchItem, emit func(indexes []int, result Response)) {
+	type job struct {
+		item    BatchItem
+		indexes []int
+	}
+
+	unique := make(map[BatchItem]*job, len(items))
+	var order []*job
+	for i, item := range items {
+		if existing, ok := unique[item]; ok {
+			existing.indexes = append(existing.indexes, i)
+			continue
+		}
+		entry := &job{item: item, indexes: []int{i}}
+		unique[item] = entry
+		order = append(order, entry)
+	}
+
+	jobs := make(chan *job)
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range jobs {
+				// Batch items share the class workers with single lookups instead of bypassing them
+				release := classOf(entry.item.Bank).wait()
+				result := verifyRecovered(entry.item.NIP, entry.item.Bank)
+				release()
+				emit(entry.indexes, result)
+			}
+		}()
+	}
+
+	for _, entry := range order {
+		jobs <- entry
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// 📌 Handle /verify/batch API endpoint
+func batchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Use POST"})
+		return
+	}
+
+	var requested []batchRequestItem
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, int64(batchMaxItems)*128+1024)).Decode(&requested); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Invalid batch, expected a JSON array of {\"nip\", \"bank\"} objects"})
+		return
+	}
+	if len(requested) > batchMaxItems {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Too many items in batch"})
+		return
+	}
+	// References stay out of the items so duplicates are still verified once
+	items := make([]BatchItem, len(requested))
+	correlations := make([]*Correlation, len(requested))
+	for i, item := range requested {
+		items[i], correlations[i] = item.BatchItem, item.Correlation.orNil()
+	}
+
+	tenant := tenantFromRequest(r)
+	problem := datasetProblem()
+	if problem != "" {
+		if status, result := unavailableResponse(problem); status != http.StatusOK {
+			recordError("dataset_unavailable")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(result)
+			return
+		}
+	}
+
+	// A workbook needs every result, JSON Lines are streamed as they complete
+	workbook := wantsXLSX(r)
+	var collected []BatchResult
+	if workbook {
+		collected = make([]BatchResult, len(items))
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	var writeMu sync.Mutex
+
+	emit := func(indexes []int, result Response) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		for _, index := range indexes {
+			item := items[index]
+			result.Correlation, result.Confirmation = correlations[index], ""
+			if result.Correlation != nil && result.Response == "OK" {
+				// Referenced entries are kept as confirmations, as with /verify
+				result.Confirmation = issueConfirmation(tenant, "batch", item.NIP, item.Bank, result)
+			}
+			recordRequest(item.NIP, item.Bank, result)
+			recordUsage(tenant, result.Status)
+			if result.Response == "OK" {
+				recordStats(result, item.Bank != "")
+			}
+			line := BatchResult{Index: index, NIP: item.NIP, Bank: item.Bank, Response: result}
+			if workbook {
+				collected[index] = line
+			} else {
+				encoder.Encode(line)
+			}
+		}
+		if flusher != nil && !workbook {
+			flusher.Flush()
+		}
+	}
+
+	// Invalid entries are answered right away, the rest go to the worker pool
+	var valid []BatchItem
+	var validIndexes []int
+	for i, item := range items {
+		if category, fields := validateInput(item.NIP, item.Bank); category != "" {
+			recordError(category)
+			emit([]int{i}, validationResponse(fields))
+			continue
+		}
+		if fields := validateCorrelation(correlations[i]); len(fields) > 0 {
+			recordError("invalid_correlation")
+			emit([]int{i}, validationResponse(fields))
+			continue
+		}
+		if problem != "" {
+			_, result := unavailableResponse(problem)
+			emit([]int{i}, result)
+			continue
+		}
+		valid = append(valid, item)
+		validIndexes = append(validIndexes, i)
+	}
+
+	verifyBatch(valid, func(indexes []int, result Response) {
+		mapped := make([]int, len(indexes))
+		for i, index := range indexes {
+			mapped[i] = validIndexes[index]
+		}
+		emit(mapped, result)
+	})
+
+	if workbook {
+		startXLSXDownload(w, "batch.xlsx")
+		writeXLSX(w, batchWorkbook(collected))
+	}
+}
+
+// 📌 Summary and per-entry sheets of batch results
+func batchWorkbook(results []BatchResult) []xlsxSheet {
+	rows := [][]any{{"Index", "NIP", "Bank account", "Response", "Status", "Bank", "Date", "Message", "Invoice ID", "Payment ID", "Cost Center", "Confirmation"}}
+	counts := make(map[string]int)
+	var statuses []string
+	date, matched := "", 0
+	for _, result := range results {
+		references := result.Correlation.columns()
+		rows = append(rows, []any{result.Index, result.NIP, result.Bank, result.Response.Response, result.Status, result.Response.Bank, result.Date, result.Message, references[0], references[1], references[2], result.Confirmation})
+		status := result.Status
+		if status == "" {
+			status = result.Response.Response
+		}
+		if counts[status] == 0 {
+			statuses = append(statuses, status)
+		}
+		counts[status]++
+		if result.Response.Bank == "MATCHED" {
+			matched++
+		}
+		if result.Date != "" {
+			date = result.Date
+		}
+	}
+
+	summary := [][]any{{"Summary", ""}, {"Dataset date", date}, {"Entries", len(results)}, {"Account matched", matched}}
+	sort.Strings(statuses)
+	for _, status := range statuses {
+		summary = append(summary, []any{status, counts[status]})
+	}
+	return []xlsxSheet{{Name: "Summary", Rows: summary}, {Name: "Results", Rows: rows}}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Request classes generated by the bench subcommand, in report order
+var benchClasses = []string{"nip", "direct", "mask"}
+
+// Latencies of one request class
+type benchSamples struct {
+	latencies []time.Duration
+	errors    int
+}
+
+// 📌 Parse a traffic mix like "nip=70,direct=20,mask=10" into cumulative weights
+func parseBenchMix(value string) ([]int, error) {
+	weights := make(map[string]int)
+	for _, entry := range strings.Split(value, ",") {
+		name, weight, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		parsed, err := strconv.Atoi(weight)
+		if !ok || err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid mix entry %q, expected class=weight", entry)
+		}
+		weights[name] = parsed
+	}
+	cumulative := make([]int, len(benchClasses))
+	total := 0
+	for i, class := range benchClasses {
+		total += weights[class]
+		cumulative[i] = total
+		delete(weights, class)
+	}
+	for name := range weights {
+		return nil, fmt.Errorf("unknown class %q, use nip, direct or mask", name)
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("mix has no weight")
+	}
+	return cumulative, nil
+}
+
+// 📌 Random NIP with a valid check digit
+func randomNIP() string {
+	digits := make([]byte, 10)
+	for {
+		for i := range digits {
+			digits[i] = byte('0' + rand.IntN(10))
+		}
+		// About one in eleven random NIPs has the right check digit
+		if validNIPChecksum(string(digits)) {
+			return string(digits)
+		}
+	}
+}
+
+// 📌 Random NRB with valid check digits, it matches no taxpayer and so tries every mask
+func randomNRB() string {
+	digits := make([]byte, 24)
+	for i := range digits {
+		digits[i] = byte('0' + rand.IntN(10))
+	}
+	// Check digits make the IBAN remainder (account + "PL00") modulo 97 equal 1
+	remainder := 0
+	for _, char := range string(digits) + "252100" {
+		remainder = (remainder*10 + int(char-'0')) % 97
+	}
+	return fmt.Sprintf("%02d", 98-remainder) + string(digits)
+}
+
+// 📌 Read "nip,account" pairs that match the target's dataset
+func readBenchPairs(path string) ([][2]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var pairs [][2]string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		nip, account, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ",")
+		if ok && len(nip) == 10 && len(account) == 26 {
+			pairs = append(pairs, [2]string{nip, account})
+		}
+	}
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("%s has no nip,account lines", path)
+	}
+	return pairs, scanner.Err()
+}
+
+// 📌 Latency at a percentile of sorted samples
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[min(len(sorted)-1, int(float64(len(sorted))*p/100))]
+}
+
+// 📌 Send synthetic verification traffic to a target instance and report latency percentiles
+func runBench(args []string) int {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	target := flags.String("target", "http://localhost:8080", "base URL of the instance to load")
+	duration := flags.Duration("duration", 30*time.Second, "how long to send requests")
+	concurrency := flags.Int("concurrency", 8, "number of parallel requests")
+	rate := flags.Int("rate", 0, "requests per second across all workers, 0 sends as fast as responses arrive")
+	mix := flags.String("mix", "nip=70,direct=20,mask=10", "weights of NIP-only, direct account match and mask-heavy (unknown account) requests")
+	pairsFile := flags.String("pairs", "", "file of nip,account lines matching the target's dataset for direct requests (default: the sandbox pair)")
+	apiKey := flags.String("api-key", os.Getenv("BENCH_API_KEY"), "X-API-Key sent with every request")
+	flags.Parse(args)
+
+	cumulative, err := parseBenchMix(*mix)
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		return 1
+	}
+	pairs := [][2]string{{"3333333333", "61109010140000071219812874"}}
+	if *pairsFile != "" {
+		if pairs, err = readBenchPairs(*pairsFile); err != nil {
+			log.Printf("[ERROR] Reading pairs failed: %v", err)
+			return 1
+		}
+	}
+
+	// With a rate, workers take a ticket per request; without one the channel stays nil and is skipped
+	var tickets chan struct{}
+	if *rate > 0 {
+		tickets = make(chan struct{}, *concurrency)
+		go func() {
+			ticker := time.NewTicker(time.Second / time.Duration(*rate))
+			defer ticker.Stop()
+			for range ticker.C {
+				select {
+				case tickets <- struct{}{}:
+				default:
+				}
+			}
+		}()
+	}
+
+	log.Printf("[INFO] Sending %s of traffic (%s) to %s with %d workers", *duration, *mix, *target, *concurrency)
+	client := &http.Client{Timeout: time.Minute}
+	samples := make(map[string]*benchSamples)
+	for _, class := range benchClasses {
+		samples[class] = &benchSamples{}
+	}
+	var samplesMu sync.Mutex
+	var wg sync.WaitGroup
+	started := time.Now()
+	deadline := started.Add(*duration)
+
+	for i := 0; i < max(*concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				if tickets != nil {
+					<-tickets
+				}
+
+				pick := rand.IntN(cumulative[len(cumulative)-1])
+				class := 0
+				for pick >= cumulative[class] {
+					class++
+				}
+				query := url.Values{}
+				switch benchClasses[class] {
+				case "nip":
+					query.Set("nip", randomNIP())
+				case "direct":
+					pair := pairs[rand.IntN(len(pairs))]
+					query.Set("nip", pair[0])
+					query.Set("bank", pair[1])
+				case "mask":
+					query.Set("nip", randomNIP())
+					query.Set("bank", randomNRB())
+				}
+
+				req, _ := http.NewRequest(http.MethodGet, *target+"/verify?"+query.Encode(), nil)
+				if *apiKey != "" {
+					req.Header.Set("X-API-Key", *apiKey)
+				}
+				sent := time.Now()
+				var result Response
+				resp, err := client.Do(req)
+				if err == nil {
+					err = json.NewDecoder(resp.Body).Decode(&result)
+					resp.Body.Close()
+					if err == nil && (resp.StatusCode != http.StatusOK || result.Response != "OK") {
+						err = fmt.Errorf("%s: %s", resp.Status, result.Message)
+					}
+				}
+				elapsed := time.Since(sent)
+
+				samplesMu.Lock()
+				entry := samples[benchClasses[class]]
+				if err != nil {
+					if entry.errors == 0 {
+						log.Printf("[WARNING] %s request failed: %v", benchClasses[class], err)
+					}
+					entry.errors++
+				} else {
+					entry.latencies = append(entry.latencies, elapsed)
+				}
+				samplesMu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(started)
+
+	fmt.Printf("%-8s %8s %7s %9s %9s %9s %9s %9s\n", "class", "requests", "errors", "req/s", "p50", "p90", "p99", "max")
+	var all []time.Duration
+	errors := 0
+	report := func(name string, latencies []time.Duration, failed int) {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		total := len(latencies) + failed
+		fmt.Printf("%-8s %8d %7d %9.1f %9s %9s %9s %9s\n", name, total, failed, float64(total)/elapsed.Seconds(),
+			percentile(latencies, 50).Round(time.Microsecond), percentile(latencies, 90).Round(time.Microsecond),
+			percentile(latencies, 99).Round(time.Microsecond), percentile(latencies, 100).Round(time.Microsecond))
+	}
+	for _, class := range benchClasses {
+		if entry := samples[class]; len(entry.latencies)+entry.errors > 0 {
+			report(class, entry.latencies, entry.errors)
+			all = append(all, entry.latencies...)
+			errors += entry.errors
+		}
+	}
+	report("total", all, errors)
+
+	if len(all) == 0 {
+		log.Printf("[ERROR] No request succeeded")
+		return 1
+	}
+	return 0
+}
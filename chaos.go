@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	// Serve /admin/chaos so fault injection can be switched on, never enable it in production
+	chaosEnabled = getEnvBool("CHAOS_ENABLED", false)
+
+	chaos   *ChaosConfig
+	chaosMu sync.Mutex
+
+	errChaosUpdate = errors.New("injected update failure")
+)
+
+// Faults injected through /admin/chaos until they expire
+type ChaosConfig struct {
+	// Delay added to every API request, e.g. "2s"
+	Latency string `json:"latency,omitempty"`
+	// Share of API requests answered with 503, 0 to 1
+	ErrorRate float64 `json:"errorRate,omitempty"`
+	// Treat the dataset as stale, so UNAVAILABLE_POLICY applies to every verification
+	Stale bool `json:"stale,omitempty"`
+	// Fail every dataset download
+	UpdateFailure bool `json:"updateFailure,omitempty"`
+	// Only requests of these tenants get latency and errors, every client when empty
+	Tenants []string `json:"tenants,omitempty"`
+	// How long the faults stay active, "1h" if not given
+	Duration string    `json:"duration,omitempty"`
+	Expires  time.Time `json:"expires"`
+
+	latency time.Duration
+}
+
+// 📌 Active faults, nil when none are injected or they expired
+func activeChaos() *ChaosConfig {
+	chaosMu.Lock()
+	defer chaosMu.Unlock()
+	if chaos != nil && time.Now().After(chaos.Expires) {
+		log.Printf("[INFO] Injected faults expired")
+		chaos = nil
+	}
+	return chaos
+}
+
+// 📌 Problem of a dataset made stale by fault injection
+func chaosStaleProblem() string {
+	if config := activeChaos(); config != nil && config.Stale {
+		return "Dataset is stale (injected fault)"
+	}
+	return ""
+}
+
+// 📌 Report whether dataset downloads should fail
+func chaosUpdateFailure() bool {
+	config := activeChaos()
+	return config != nil && config.UpdateFailure
+}
+
+// 📌 Delay or fail API requests according to the injected faults
+func injectFaults(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		config := activeChaos()
+		if config == nil || (len(config.Tenants) > 0 && !slices.Contains(config.Tenants, tenantFromRequest(r))) {
+			next(w, r)
+			return
+		}
+		if config.latency > 0 {
+			select {
+			case <-time.After(config.latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if config.ErrorRate > 0 && rand.Float64() < config.ErrorRate {
+			recordError("chaos")
+			w.Header().Set("X-Fault-Injected", "true")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Service temporarily unavailable"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// 📌 Handle /admin/chaos API endpoint: GET shows, POST injects and DELETE clears faults
+func chaosHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		config := activeChaos()
+		if config == nil {
+			json.NewEncoder(w).Encode(Response{Response: "OK", Message: "No faults injected"})
+			return
+		}
+		json.NewEncoder(w).Encode(config)
+	case http.MethodPost:
+		var config ChaosConfig
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&config); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Invalid JSON body"})
+			return
+		}
+		duration := time.Hour
+		var err error
+		if config.Duration != "" {
+			duration, err = time.ParseDuration(config.Duration)
+		}
+		if err == nil && config.Latency != "" {
+			config.latency, err = time.ParseDuration(config.Latency)
+		}
+		if err != nil || duration <= 0 || config.latency < 0 || config.ErrorRate < 0 || config.ErrorRate > 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "latency and duration must be durations like 2s, errorRate between 0 and 1"})
+			return
+		}
+		config.Duration = duration.String()
+		config.Expires = time.Now().Add(duration).UTC()
+
+		chaosMu.Lock()
+		chaos = &config
+		chaosMu.Unlock()
+		log.Printf("[WARNING] Injecting faults until %s: latency %s, error rate %.2f, stale %t, update failure %t, tenants %v",
+			config.Expires.Format(time.RFC3339), config.latency, config.ErrorRate, config.Stale, config.UpdateFailure, config.Tenants)
+		json.NewEncoder(w).Encode(config)
+	case http.MethodDelete:
+		chaosMu.Lock()
+		chaos = nil
+		chaosMu.Unlock()
+		log.Printf("[INFO] Injected faults cleared")
+		json.NewEncoder(w).Encode(Response{Response: "OK", Message: "Faults cleared"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Use GET, POST or DELETE"})
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import "strings"
+
+// 📌 Read NIP and optional account digits from a message like "NIP 111-111-11-11 PL61 1090 1014 …"
+func parseChatQuery(text string) (string, string, bool) {
+	var digits strings.Builder
+	for _, char := range text {
+		if char >= '0' && char <= '9' {
+			digits.WriteRune(char)
+		}
+	}
+	switch value := digits.String(); len(value) {
+	case 10:
+		return value, "", true
+	case 36:
+		return value[:10], value[10:], true
+	}
+	return "", "", false
+}
+
+// 📌 Answer a chat message with the verification result and confirmation ID, false when it holds no NIP
+func chatAnswer(tenant string, source string, text string) (string, bool) {
+	nip, bank, ok := parseChatQuery(text)
+	if !ok {
+		return "", false
+	}
+	if category, fields := validateInput(nip, bank); category != "" {
+		recordUsage(tenant, "ERROR")
+		recordError(category)
+		return "⚠️ " + validationResponse(fields).Message, true
+	}
+	if problem := datasetProblem(); problem != "" {
+		recordUsage(tenant, "ERROR")
+		recordError("dataset_unavailable")
+		return "⚠️ " + problem + ", try again later", true
+	}
+
+	result := verify(nip, bank)
+	recordRequest(nip, bank, result)
+	recordUsage(tenant, result.Status)
+	recordStats(result, bank != "")
+	confirmation := issueConfirmation(tenant, source, nip, bank, result)
+
+	icon := "✅"
+	switch {
+	case result.Status == "NOT_FOUND":
+		icon = "❌"
+	case bank != "" && result.Bank != "MATCHED":
+		icon = "⚠️"
+	}
+	lines := []string{icon + " " + result.Status, "NIP " + nip}
+	if bank != "" {
+		lines = append(lines, "Account "+bank+": "+result.Bank)
+	}
+	lines = append(lines, "Dataset "+result.Date)
+	if result.Warning != "" {
+		lines = append(lines, "⚠️ "+result.Warning)
+	}
+	if confirmation != "" {
+		lines = append(lines, "Confirmation "+confirmation)
+	}
+	return strings.Join(lines, "\n"), true
+}
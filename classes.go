@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// NIP-only checks are cheap, one hash chain each; account checks fan out over every mask
+	nipClass     = newRequestClass("nip", getEnvInt("NIP_WORKERS", runtime.GOMAXPROCS(0)), getEnvInt("NIP_QUEUE", 1000))
+	accountClass = newRequestClass("account", getEnvInt("ACCOUNT_WORKERS", max(1, runtime.GOMAXPROCS(0)/2)), getEnvInt("ACCOUNT_QUEUE", 100))
+	// Longest wait for a worker before a single verification is refused
+	queueTimeout = getEnvDuration("QUEUE_TIMEOUT", 5*time.Second)
+
+	errQueueFull = errors.New("queue full")
+)
+
+// Bounded pool of workers with a bounded wait queue for one class of verifications
+type requestClass struct {
+	name    string
+	slots   chan struct{}
+	queue   int64
+	waiting atomic.Int64
+}
+
+// 📌 Create a request class with a number of concurrent workers and waiting requests
+func newRequestClass(name string, workers int, queue int) *requestClass {
+	return &requestClass{name: name, slots: make(chan struct{}, max(1, workers)), queue: int64(queue)}
+}
+
+// 📌 Class of a verification, accounts are expensive because of the mask fan-out
+func classOf(bank string) *requestClass {
+	if bank == "" {
+		return nipClass
+	}
+	return accountClass
+}
+
+// 📌 Wait for a worker of the class, failing at once when the queue is full or after QUEUE_TIMEOUT
+func (class *requestClass) enter(ctx context.Context) (func(), error) {
+	release := func() { <-class.slots }
+	select {
+	case class.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	if class.waiting.Add(1) > class.queue {
+		class.waiting.Add(-1)
+		return nil, errQueueFull
+	}
+	defer class.waiting.Add(-1)
+	ctx, cancel := context.WithTimeout(ctx, queueTimeout)
+	defer cancel()
+	select {
+	case class.slots <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// 📌 Wait for a worker of the class without a timeout, for batch items that must not be dropped
+func (class *requestClass) wait() func() {
+	class.slots <- struct{}{}
+	return func() { <-class.slots }
+}
+
+// 📌 Busy workers and waiting requests of both classes for /metrics
+func classMetrics() []metric {
+	var metrics []metric
+	for _, class := range []*requestClass{nipClass, accountClass} {
+		metrics = append(metrics,
+			metric{"vatbank_" + class.name + "_workers_busy", "gauge", "Verifications of the " + class.name + " class running.", float64(len(class.slots))},
+			metric{"vatbank_" + class.name + "_queue_waiting", "gauge", "Verifications of the " + class.name + " class waiting for a worker.", float64(class.waiting.Load())})
+	}
+	return metrics
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Settings from CONFIG_FILE, read before any other setting because getEnv depends on it
+var configFile = readConfigFile(os.Getenv("CONFIG_FILE"))
+
+var (
+	// Values that could not be parsed and fell back to their default, reported by config validate
+	settingProblems []string
+	// Every setting name looked up, so config validate can point out misspelled keys
+	readSettings sync.Map
+)
+
+// 📌 Read KEY=VALUE lines (with # comments and optional quotes) from a config file
+func readConfigFile(path string) map[string]string {
+	values := make(map[string]string)
+	if path == "" {
+		return values
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("[ERROR] Reading config file failed: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(text, "export "), "=")
+		if !ok {
+			log.Printf("[WARNING] Ignoring line %d of %s, expected KEY=VALUE", line, path)
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatalf("[ERROR] Reading config file failed: %v", err)
+	}
+	return values
+}
+
+// 📌 Read a setting as written in the environment, CONFIG_SOURCE or the config file, secret references unresolved
+func rawSetting(key string) string {
+	readSettings.Store(key, true)
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	if value, ok := remoteConfig[key]; ok && value != "" {
+		return value
+	}
+	return configFile[key]
+}
+
+// 📌 Read a string setting from the environment, then the config file
+func getEnv(key string, fallback string) string {
+	if value := rawSetting(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// 📌 Read a credential setting like getEnv, resolving a vault: or file: secret reference
+//
+// Only credentials go through here: paths and DSNs such as the sqlite
+// "file:/data/store.db?..." would otherwise be read as secret files.
+func getSecret(key string, fallback string) string {
+	value := rawSetting(key)
+	if isSecretRef(value) {
+		resolved, err := resolveSecret(value)
+		if err != nil {
+			log.Fatalf("[ERROR] Reading secret of %s failed: %v", key, err)
+		}
+		value = resolved
+	}
+	if value != "" {
+		return value
+	}
+	return fallback
+}
+
+// 📌 Read a float setting from the environment
+func getEnvFloat(key string, fallback float64) float64 {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("[WARNING] Invalid %s value %q, using default (%v)", key, value, fallback)
+		settingProblems = append(settingProblems, fmt.Sprintf("%s=%q is not a valid float", key, value))
+		return fallback
+	}
+	return parsed
+}
+
+// 📌 Create a directory (and parents) if it does not exist yet
+func ensureDir(path string) error {
+	if err := os.MkdirAll(path, 0o750); err != nil {
+		return err
+	}
+	// Fail early instead of at the first download when the volume is read-only
+	probe, err := os.CreateTemp(path, ".write-test-*")
+	if err != nil {
+		return err
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// 📌 Read a duration setting (e.g. "90s", "10m") from the environment
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed < 0 {
+		log.Printf("[WARNING] Invalid %s value %q, using default (%s)", key, value, fallback)
+		settingProblems = append(settingProblems, fmt.Sprintf("%s=%q is not a valid duration", key, value))
+		return fallback
+	}
+	return parsed
+}
+
+// 📌 Read a boolean setting from the environment
+func getEnvBool(key string, fallback bool) bool {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("[WARNING] Invalid %s value %q, using default (%t)", key, value, fallback)
+		settingProblems = append(settingProblems, fmt.Sprintf("%s=%q is not a valid boolean", key, value))
+		return fallback
+	}
+	return parsed
+}
+
+// 📌 Read an integer setting from the environment
+func getEnvInt(key string, fallback int) int {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("[WARNING] Invalid %s value %q, using default (%d)", key, value, fallback)
+		settingProblems = append(settingProblems, fmt.Sprintf("%s=%q is not a valid integer", key, value))
+		return fallback
+	}
+	return parsed
+}
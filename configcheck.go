@@ -0,0 +1,271 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Settings holding the base URL of a service this instance talks to
+var urlSettings = []string{
+	"MF_API_URL", "PEER_URL", "LEADER_URL", "SHADOW_URL", "S3_ENDPOINT", "KMS_ENDPOINT", "VAULT_ADDR",
+	"OIDC_ISSUER", "TELEGRAM_API_URL", "CONSUL_HTTP_ADDR", "ETCD_ENDPOINT", "REPORT_WEBHOOK_URL",
+}
+
+// 📌 Settings that contradict each other or name unknown options, the service refuses to start with any
+func configErrors() []string {
+	var problems []string
+	if (tlsCertFile == "") != (tlsKeyFile == "") {
+		problems = append(problems, "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if http3Addr != "" && tlsCertFile == "" {
+		problems = append(problems, "HTTP3_ADDR requires TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	if leaderElection && (leaderURL == "" || leaseNamespace == "") {
+		problems = append(problems, "LEADER_ELECTION needs LEADER_URL and a Kubernetes namespace (LEASE_NAMESPACE)")
+	}
+	if mode != "serve" && mode != "mock" && mode != "readonly" && mode != "proxy" && mode != "serverless" {
+		problems = append(problems, fmt.Sprintf("Unknown MODE: %s", mode))
+	}
+	if dataSource != "mf" && dataSource != "file" && dataSource != "s3" && dataSource != "peer" && dataSource != "sandbox" {
+		problems = append(problems, fmt.Sprintf("Unknown DATA_SOURCE: %s", dataSource))
+	}
+	if mode == "readonly" && dataSource != "file" && dataSource != "s3" && dataSource != "peer" {
+		problems = append(problems, "MODE=readonly never downloads from MF, use DATA_SOURCE=file, s3 or peer")
+	}
+	if mode == "serverless" && dataSource != "s3" {
+		problems = append(problems, "MODE=serverless loads a published snapshot, use DATA_SOURCE=s3")
+	}
+	if dataSource == "peer" && peerURL == "" {
+		problems = append(problems, "DATA_SOURCE=peer requires PEER_URL")
+	}
+	if telegramToken != "" && len(telegramAllowed) == 0 {
+		problems = append(problems, "TELEGRAM_BOT_TOKEN requires TELEGRAM_ALLOWED_USERS")
+	}
+	if slackResponseType != "ephemeral" && slackResponseType != "in_channel" {
+		problems = append(problems, fmt.Sprintf("Unknown SLACK_RESPONSE_TYPE: %s", slackResponseType))
+	}
+	if unavailablePolicy != "closed" && unavailablePolicy != "open" {
+		problems = append(problems, fmt.Sprintf("Unknown UNAVAILABLE_POLICY: %s", unavailablePolicy))
+	}
+	if transformCountMin < 1 || transformCountMax < transformCountMin {
+		problems = append(problems, "TRANSFORM_COUNT_MIN must be at least 1 and not above TRANSFORM_COUNT_MAX")
+	}
+	if retryInterval <= 0 {
+		problems = append(problems, "RETRY_INTERVAL must be greater than 0")
+	}
+	if dataSource == "file" && dataPath == "" {
+		problems = append(problems, "DATA_SOURCE=file requires DATA_PATH")
+	}
+	if dataSource == "s3" && s3Bucket == "" {
+		problems = append(problems, "DATA_SOURCE=s3 requires S3_BUCKET")
+	}
+	return problems
+}
+
+// 📌 Check that a directory exists and is writable, or could be created
+func checkDir(key string, path string) string {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Created on startup, so the closest existing parent must be writable
+		parent := filepath.Dir(filepath.Clean(path))
+		for parent != filepath.Dir(parent) {
+			if _, err := os.Stat(parent); err == nil {
+				break
+			}
+			parent = filepath.Dir(parent)
+		}
+		return checkDir(key, parent)
+	}
+	if err != nil {
+		return fmt.Sprintf("%s=%s: %v", key, path, err)
+	}
+	if !info.IsDir() {
+		return fmt.Sprintf("%s=%s is not a directory", key, path)
+	}
+	probe, err := os.CreateTemp(path, ".write-test-*")
+	if err != nil {
+		return fmt.Sprintf("%s=%s is not writable: %v", key, path, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return ""
+}
+
+// 📌 Check that a certificate and key form a pair and the certificate has not expired
+func checkKeyPair(subject string, certFile string, keyFile string) string {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Sprintf("%s: %v", subject, err)
+	}
+	certificate, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return fmt.Sprintf("%s: %v", subject, err)
+	}
+	if time.Now().After(certificate.NotAfter) {
+		return fmt.Sprintf("%s: certificate %s expired on %s", subject, certFile, certificate.NotAfter.Format(time.DateOnly))
+	}
+	return ""
+}
+
+// 📌 Check every setting without starting the service, returns errors and warnings
+func validateConfig() ([]string, []string) {
+	problems := append(append([]string(nil), settingProblems...), configErrors()...)
+	var warnings []string
+	add := func(problem string) {
+		if problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+
+	if err := enableRegistries(); err != nil {
+		add(fmt.Sprintf("REGISTRIES=%s: %v", registryNames, err))
+	}
+	if storeBackend != "file" && storeBackend != "sqlite" && storeBackend != "postgres" {
+		add(fmt.Sprintf("Unknown STORE: %s", storeBackend))
+	}
+	if storeBackend == "postgres" && storeDSN == "" {
+		add("STORE=postgres requires STORE_DSN")
+	}
+	if recordMode != "raw" && recordMode != "anonymized" {
+		add(fmt.Sprintf("Unknown RECORD_MODE: %s", recordMode))
+	}
+	if serviceRegistry != "" && serviceRegistry != "consul" && serviceRegistry != "etcd" {
+		add(fmt.Sprintf("Unknown SERVICE_REGISTRY: %s", serviceRegistry))
+	}
+
+	// Addresses and URLs
+	for _, key := range urlSettings {
+		value := rawSetting(key)
+		if value == "" || isSecretRef(value) {
+			continue
+		}
+		if parsed, err := url.Parse(value); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			add(fmt.Sprintf("%s=%q is not an absolute http(s) URL", key, value))
+		}
+	}
+	listeners, err := parseListeners(listenAddr)
+	if err != nil {
+		add(fmt.Sprintf("LISTEN_ADDR=%q: %v", listenAddr, err))
+	}
+	for _, item := range listeners {
+		if item.certFile != "" {
+			add(checkKeyPair("TLS of "+item.address, item.certFile, item.keyFile))
+		}
+	}
+	for key, address := range map[string]string{"HTTP3_ADDR": http3Addr, "STATSD_ADDR": statsdAddress, "METRICS_ADDR": metricsAddr, "REPORT_SMTP_ADDR": reportSMTPAddr} {
+		if _, _, err := net.SplitHostPort(address); address != "" && err != nil {
+			add(fmt.Sprintf("%s=%q: %v", key, address, err))
+		}
+	}
+	if logOutput != "stderr" && logOutput != "syslog" && logOutput != "journald" {
+		add(fmt.Sprintf("Unknown LOG_OUTPUT: %s", logOutput))
+	}
+	if network, _, ok := strings.Cut(syslogAddress, "://"); logOutput == "syslog" && (!ok || (network != "unix" && network != "udp" && network != "tcp")) {
+		add(fmt.Sprintf("SYSLOG_ADDRESS=%q must start with unix://, udp:// or tcp://", syslogAddress))
+	}
+	if _, ok := syslogFacilities[strings.ToLower(syslogFacility)]; logOutput != "stderr" && !ok {
+		add(fmt.Sprintf("Unknown SYSLOG_FACILITY: %s", syslogFacility))
+	}
+	if _, err := time.LoadLocation("Europe/Warsaw"); err != nil {
+		add(fmt.Sprintf("Europe/Warsaw time zone unavailable, prefetch times would use local time: %v", err))
+	}
+
+	// Directories and files
+	add(checkDir("DATA_DIR", dataDir))
+	if tmpDir != dataDir {
+		add(checkDir("TMP_DIR", tmpDir))
+	}
+	if dataSource == "file" && dataPath != "" {
+		if _, err := os.Stat(dataPath); err != nil {
+			add(fmt.Sprintf("DATA_PATH=%s: %v", dataPath, err))
+		}
+	}
+	if dataSource == "mf" && mode != "proxy" && mode != "mock" {
+		if _, err := findSevenZip(); err != nil {
+			add(fmt.Sprintf("SEVENZIP_PATH=%s: %v", sevenZipPath, err))
+		}
+	}
+
+	// Key material
+	configured := 0
+	for _, value := range []string{encryptionKey, encryptionKMSKey, encryptionTransitKey} {
+		if value != "" {
+			configured++
+		}
+	}
+	switch {
+	case configured > 1:
+		add("Set only one of ENCRYPTION_KEY, ENCRYPTION_KMS_KEY and ENCRYPTION_TRANSIT_KEY")
+	case encryptionKey != "":
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encryptionKey))
+		if err != nil {
+			add(fmt.Sprintf("ENCRYPTION_KEY is not base64: %v", err))
+		} else if len(key) != 32 {
+			add(fmt.Sprintf("ENCRYPTION_KEY has %d bytes, expected 32 (openssl rand -base64 32)", len(key)))
+		}
+	case encryptionKMSKey != "" && (kmsCredentials.accessKey == "" || kmsCredentials.secretKey == ""):
+		add("ENCRYPTION_KMS_KEY requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	case encryptionTransitKey != "" && vaultAddr == "":
+		add("ENCRYPTION_TRANSIT_KEY requires VAULT_ADDR")
+	}
+	if (s3AccessKey == "") != (s3SecretKey == "") {
+		add("S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY must be set together")
+	}
+	for _, entry := range strings.Split(getSecret("API_KEYS", ""), ",") {
+		entry = strings.TrimSpace(entry)
+		name, rest, ok := strings.Cut(entry, ":")
+		if key, _, _ := strings.Cut(rest, ":"); entry != "" && (!ok || name == "" || key == "") {
+			add(fmt.Sprintf("API_KEYS entry %q is not name:key[:role|role]", name))
+		}
+	}
+	if adminToken != "" && len(readSecret(&adminToken)) < 16 {
+		warnings = append(warnings, "ADMIN_TOKEN is shorter than 16 characters")
+	}
+
+	// Keys in the config file or CONFIG_SOURCE that no setting reads are usually typos
+	var unknown []string
+	for _, source := range []map[string]string{configFile, remoteConfig} {
+		for key := range source {
+			if _, ok := readSettings.Load(key); !ok {
+				unknown = append(unknown, key)
+			}
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		warnings = append(warnings, fmt.Sprintf("Unknown setting %s is ignored", key))
+	}
+	return problems, warnings
+}
+
+// 📌 Run the config subcommand: "config validate" checks the settings and exits 1 on any error
+func runConfig(args []string) int {
+	if len(args) != 1 || args[0] != "validate" {
+		fmt.Fprintln(os.Stderr, "usage: pl-vatbank-checker config validate")
+		return 2
+	}
+	problems, warnings := validateConfig()
+	for _, warning := range warnings {
+		log.Printf("[WARNING] %s", warning)
+	}
+	for _, problem := range problems {
+		log.Printf("[ERROR] %s", problem)
+	}
+	if len(problems) > 0 {
+		log.Printf("[ERROR] Configuration has %d errors", len(problems))
+		return 1
+	}
+	log.Printf("[INFO] Configuration is valid")
+	return 0
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+// Confirmations of the file store are appended here as proof of the check
+var confirmationsFile = getEnv("CONFIRMATIONS_FILE", filepath.Join(dataDir, "confirmations.jsonl"))
+
+// Stored proof that a NIP/account pair was checked against a given dataset
+type Confirmation struct {
+	ID         string    `json:"id"`
+	Time       time.Time `json:"time"`
+	Tenant     string    `json:"tenant,omitempty"`
+	Source     string    `json:"source"`
+	NIP        string    `json:"nip"`
+	Bank       string    `json:"bankAccount,omitempty"`
+	Status     string    `json:"status"`
+	BankStatus string    `json:"bank"`
+	Date       string    `json:"date"`
+	// Client references given with the verification
+	Correlation *Correlation `json:"correlation,omitempty"`
+}
+
+// 📌 Store a verification result and return its confirmation ID (data date and a random suffix)
+func issueConfirmation(tenant, source, nip, bank string, result Response) string {
+	suffix := make([]byte, 8)
+	_, _ = rand.Read(suffix)
+	confirmation := Confirmation{
+		ID:          result.Date + "-" + hex.EncodeToString(suffix),
+		Time:        time.Now().UTC(),
+		Tenant:      tenant,
+		Source:      source,
+		NIP:         nip,
+		Bank:        bank,
+		Status:      result.Status,
+		BankStatus:  result.Bank,
+		Date:        result.Date,
+		Correlation: result.Correlation,
+	}
+
+	if store == nil {
+		return ""
+	}
+	if err := store.AppendConfirmation(confirmation); err != nil {
+		log.Printf("[ERROR] Storing confirmation failed: %v", err)
+		return ""
+	}
+	return confirmation.ID
+}
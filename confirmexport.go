@@ -0,0 +1,157 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// 📌 Read the stored confirmations issued in a month (YYYY-MM, Europe/Warsaw)
+func monthConfirmations(month time.Time, tenant string) ([]Confirmation, error) {
+	start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, warsaw)
+	return store.Confirmations(start, start.AddDate(0, 1, 0), tenant)
+}
+
+// 📌 Keep a value from being run as a formula when index.csv is opened in a spreadsheet
+//
+// Client references such as invoiceId are free text, so a leading =, +, -, @,
+// tab or carriage return gets a ' prefix, which spreadsheets show as text.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// 📌 Write confirmations as a ZIP with one JSON file per confirmation and an index.csv
+func writeConfirmationsZip(w io.Writer, confirmations []Confirmation) error {
+	archive := zip.NewWriter(w)
+
+	index, err := archive.CreateHeader(&zip.FileHeader{Name: "index.csv", Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	table := csv.NewWriter(index)
+	table.Write([]string{"id", "time", "tenant", "source", "nip", "bankAccount", "status", "bank", "date", "invoiceId", "paymentId", "costCenter", "file"})
+	for _, confirmation := range confirmations {
+		row := []string{
+			confirmation.ID,
+			confirmation.Time.Format(time.RFC3339),
+			confirmation.Tenant,
+			confirmation.Source,
+			confirmation.NIP,
+			confirmation.Bank,
+			confirmation.Status,
+			confirmation.BankStatus,
+			confirmation.Date,
+		}
+		row = append(row, confirmation.Correlation.columns()...)
+		row = append(row, "confirmations/"+confirmation.ID+".json")
+		for i := range row {
+			row[i] = csvCell(row[i])
+		}
+		table.Write(row)
+	}
+	table.Flush()
+	if err := table.Error(); err != nil {
+		return err
+	}
+
+	for _, confirmation := range confirmations {
+		entry, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     "confirmations/" + confirmation.ID + ".json",
+			Method:   zip.Deflate,
+			Modified: confirmation.Time,
+		})
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(entry)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(confirmation); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// 📌 Handle /admin/confirmations/export?month=YYYY-MM[&tenant=] API endpoint
+func confirmationsExportHandler(w http.ResponseWriter, r *http.Request) {
+	monthValue := r.URL.Query().Get("month")
+	month, err := time.ParseInLocation("2006-01", monthValue, warsaw)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Invalid month, expected YYYY-MM"})
+		return
+	}
+
+	confirmations, err := monthConfirmations(month, r.URL.Query().Get("tenant"))
+	if err != nil {
+		log.Printf("[ERROR] Reading confirmations failed: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Reading confirmations failed"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="confirmations-%s.zip"`, monthValue))
+	if err := writeConfirmationsZip(w, confirmations); err != nil {
+		log.Printf("[ERROR] Writing confirmations archive failed: %v", err)
+	}
+}
+
+// 📌 Run the export-confirmations subcommand, e.g. from a monthly cron job
+func runConfirmationsExport(args []string) int {
+	now := time.Now().In(warsaw)
+	previous := time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, warsaw)
+
+	flags := flag.NewFlagSet("export-confirmations", flag.ExitOnError)
+	monthValue := flags.String("month", previous.Format("2006-01"), "month to export (YYYY-MM), defaults to the previous month")
+	tenant := flags.String("tenant", "", "only confirmations of this API key name")
+	output := flags.String("out", "", "ZIP file to write (default confirmations-<month>.zip)")
+	flags.Parse(args)
+
+	month, err := time.ParseInLocation("2006-01", *monthValue, warsaw)
+	if err != nil {
+		fmt.Println("Invalid month, expected YYYY-MM")
+		return 2
+	}
+	if *output == "" {
+		*output = "confirmations-" + *monthValue + ".zip"
+	}
+	if err := openStore(); err != nil {
+		log.Printf("[ERROR] Opening the %s store failed: %v", storeBackend, err)
+		return 1
+	}
+	defer store.Close()
+
+	confirmations, err := monthConfirmations(month, *tenant)
+	if err != nil {
+		log.Printf("[ERROR] Reading confirmations failed: %v", err)
+		return 1
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		log.Printf("[ERROR] Creating %s failed: %v", *output, err)
+		return 1
+	}
+	if err := writeConfirmationsZip(file, confirmations); err != nil {
+		file.Close()
+		log.Printf("[ERROR] Writing %s failed: %v", *output, err)
+		return 1
+	}
+	if err := file.Close(); err != nil {
+		log.Printf("[ERROR] Writing %s failed: %v", *output, err)
+		return 1
+	}
+	log.Printf("[INFO] Exported %d confirmations to %s", len(confirmations), *output)
+	return 0
+}
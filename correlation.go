@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/url"
+	"unicode"
+)
+
+// Longest accepted correlation value
+const correlationMaxLength = 128
+
+// Opaque client references of a verification, echoed in the response and stored with its confirmation
+type Correlation struct {
+	InvoiceID  string `json:"invoiceId,omitempty"`
+	PaymentID  string `json:"paymentId,omitempty"`
+	CostCenter string `json:"costCenter,omitempty"`
+}
+
+// 📌 Read invoiceId, paymentId and costCenter query parameters, nil when none is set
+func correlationFromQuery(query url.Values) *Correlation {
+	return Correlation{InvoiceID: query.Get("invoiceId"), PaymentID: query.Get("paymentId"), CostCenter: query.Get("costCenter")}.orNil()
+}
+
+// 📌 Pointer to the references, nil when none is set so responses and records stay unchanged
+func (c Correlation) orNil() *Correlation {
+	if c == (Correlation{}) {
+		return nil
+	}
+	return &c
+}
+
+// 📌 Reject correlation values that are too long or contain control characters
+func validateCorrelation(c *Correlation) []FieldError {
+	if c == nil {
+		return nil
+	}
+	var fields []FieldError
+	for _, field := range []struct{ name, value string }{{"invoiceId", c.InvoiceID}, {"paymentId", c.PaymentID}, {"costCenter", c.CostCenter}} {
+		switch {
+		case len(field.value) > correlationMaxLength:
+			fields = append(fields, FieldError{Field: field.name, Code: "TOO_LONG", Message: field.name + " must not exceed 128 characters"})
+		case !printable(field.value):
+			fields = append(fields, FieldError{Field: field.name, Code: "INVALID_CHARACTERS", Message: field.name + " must not contain control characters"})
+		}
+	}
+	return fields
+}
+
+// 📌 Check that a value has no control characters
+func printable(value string) bool {
+	for _, r := range value {
+		if unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// 📌 Columns of the references for CSV exports, empty without any
+func (c *Correlation) columns() []string {
+	if c == nil {
+		return []string{"", "", ""}
+	}
+	return []string{c.InvoiceID, c.PaymentID, c.CostCenter}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// Consul agent and etcd server of CONFIG_SOURCE and SERVICE_REGISTRY, read raw because getEnv depends on them
+	consulAddr   = strings.TrimSuffix(bootstrapSettingOr("CONSUL_HTTP_ADDR", "http://127.0.0.1:8500"), "/")
+	consulToken  = bootstrapSetting("CONSUL_HTTP_TOKEN")
+	etcdEndpoint = strings.TrimSuffix(bootstrapSettingOr("ETCD_ENDPOINT", "http://127.0.0.1:2379"), "/")
+	etcdUsername = bootstrapSetting("ETCD_USERNAME")
+	etcdPassword = bootstrapSetting("ETCD_PASSWORD")
+
+	discoveryClient = &http.Client{Timeout: 10 * time.Second}
+	// Token of an etcd authentication, renewed when etcd rejects it
+	etcdAuthToken string
+	etcdAuthMu    sync.Mutex
+
+	// Settings from CONFIG_SOURCE (consul:<prefix> or etcd:<prefix>), between the environment and CONFIG_FILE
+	remoteConfig = readRemoteConfig(bootstrapSetting("CONFIG_SOURCE"))
+
+	// Register this instance for discovery: consul (with a TTL health check) or etcd (under a lease)
+	serviceRegistry = getEnv("SERVICE_REGISTRY", "")
+	serviceName     = getEnv("SERVICE_NAME", "pl-vatbank-checker")
+	serviceID       = getEnv("SERVICE_ID", serviceName+"-"+hostname())
+	// Host other services connect to, by default the host of LISTEN_ADDR or the host name
+	serviceAddress = getEnv("SERVICE_ADDRESS", "")
+	serviceTags    = splitList(getEnv("SERVICE_TAGS", ""))
+	// Health check TTL (Consul) or lease TTL (etcd), renewed every third of it
+	serviceTTL = getEnvDuration("SERVICE_TTL", 30*time.Second)
+	// etcd key prefix of registrations, <prefix>/<name>/<id>
+	etcdServicePrefix = strings.TrimSuffix(getEnv("ETCD_SERVICE_PREFIX", "/services"), "/")
+
+	// Lease of the etcd registration, empty while unregistered
+	etcdLease string
+	// Set on shutdown so a late heartbeat does not register the instance again
+	serviceStopped bool
+	serviceMu      sync.Mutex
+)
+
+// 📌 Read a setting from the environment or CONFIG_FILE, for the settings that locate CONFIG_SOURCE
+func bootstrapSetting(key string) string {
+	readSettings.Store(key, true)
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return configFile[key]
+}
+
+// 📌 Read a bootstrap setting with a default
+func bootstrapSettingOr(key, fallback string) string {
+	if value := bootstrapSetting(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// 📌 Split a comma separated setting, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// 📌 Read the settings stored under a Consul or etcd key prefix, one key per setting
+func readRemoteConfig(source string) map[string]string {
+	values := make(map[string]string)
+	if source == "" {
+		return values
+	}
+
+	backend, prefix, _ := strings.Cut(source, ":")
+	prefix = strings.Trim(prefix, "/") + "/"
+	var err error
+	switch backend {
+	case "consul":
+		err = readConsulConfig(prefix, values)
+	case "etcd":
+		err = readEtcdConfig(prefix, values)
+	default:
+		err = fmt.Errorf("unknown backend %q, use consul:<prefix> or etcd:<prefix>", backend)
+	}
+	if err != nil {
+		log.Fatalf("[ERROR] Reading CONFIG_SOURCE %s failed: %v", source, err)
+	}
+	log.Printf("[INFO] Read %d settings from %s", len(values), source)
+	return values
+}
+
+// 📌 Read the Consul KV entries under a prefix
+func readConsulConfig(prefix string, values map[string]string) error {
+	var entries []struct {
+		Key   string
+		Value []byte
+	}
+	status, err := consulRequest(http.MethodGet, "/v1/kv/"+prefix+"?recurse=true", nil, &entries)
+	if status == http.StatusNotFound {
+		// Nothing stored under the prefix yet
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		addRemoteSetting(values, strings.TrimPrefix(entry.Key, prefix), entry.Value)
+	}
+	return nil
+}
+
+// 📌 Read the etcd keys under a prefix through the v3 JSON gateway
+func readEtcdConfig(prefix string, values map[string]string) error {
+	// The range end of a prefix is the prefix with its last byte incremented
+	key := "/" + prefix
+	end := []byte(key)
+	end[len(end)-1]++
+	var reply struct {
+		Kvs []struct {
+			Key   []byte `json:"key"`
+			Value []byte `json:"value"`
+		} `json:"kvs"`
+	}
+	if err := etcdRequest("/v3/kv/range", map[string]any{"key": []byte(key), "range_end": end}, &reply); err != nil {
+		return err
+	}
+	for _, kv := range reply.Kvs {
+		addRemoteSetting(values, strings.TrimPrefix(string(kv.Key), key), kv.Value)
+	}
+	return nil
+}
+
+// 📌 Keep a key of the prefix as a setting, nested keys are not settings
+func addRemoteSetting(values map[string]string, key string, value []byte) {
+	if key == "" || strings.Contains(key, "/") {
+		return
+	}
+	values[key] = strings.TrimSpace(string(value))
+}
+
+// 📌 Send a JSON request to the Consul agent, returning the HTTP status
+func consulRequest(method, path string, body any, target any) (int, error) {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return 0, err
+		}
+	}
+	req, err := http.NewRequest(method, consulAddr+path, &payload)
+	if err != nil {
+		return 0, err
+	}
+	if consulToken != "" {
+		req.Header.Set("X-Consul-Token", consulToken)
+	}
+
+	resp, err := discoveryClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("consul returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	if target == nil {
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, json.NewDecoder(io.LimitReader(resp.Body, 8<<20)).Decode(target)
+}
+
+// 📌 Send a request to the etcd v3 JSON gateway, authenticating again once when the token was rejected
+func etcdRequest(path string, body any, target any) error {
+	err := etcdPost(path, body, target, etcdToken(false))
+	if err != nil && etcdUsername != "" {
+		err = etcdPost(path, body, target, etcdToken(true))
+	}
+	return err
+}
+
+// 📌 Token of ETCD_USERNAME, empty without etcd authentication
+func etcdToken(renew bool) string {
+	if etcdUsername == "" {
+		return ""
+	}
+	etcdAuthMu.Lock()
+	defer etcdAuthMu.Unlock()
+	if etcdAuthToken != "" && !renew {
+		return etcdAuthToken
+	}
+	var reply struct {
+		Token string `json:"token"`
+	}
+	if err := etcdPost("/v3/auth/authenticate", map[string]string{"name": etcdUsername, "password": etcdPassword}, &reply, ""); err != nil {
+		log.Printf("[WARNING] etcd authentication failed: %v", err)
+	}
+	etcdAuthToken = reply.Token
+	return etcdAuthToken
+}
+
+// 📌 Send a single JSON request to etcd
+func etcdPost(path string, body any, target any, token string) error {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, etcdEndpoint+path, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	resp, err := discoveryClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("etcd returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	if target == nil {
+		return nil
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 8<<20)).Decode(target)
+}
+
+// 📌 Host and port other services reach this instance on
+func serviceEndpoint() (string, int, error) {
+	listeners, err := parseListeners(listenAddr)
+	if err != nil {
+		return "", 0, err
+	}
+	// The first LISTEN_ADDR is the one registered
+	host, portText, _ := net.SplitHostPort(listeners[0].address)
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		return "", 0, fmt.Errorf("listen port %q is not a number", portText)
+	}
+	switch {
+	case serviceAddress != "":
+		host = serviceAddress
+	case host == "" || host == "0.0.0.0" || host == "::":
+		host = hostname()
+	}
+	return host, port, nil
+}
+
+// 📌 Register the instance in SERVICE_REGISTRY and keep its health up to date until shutdown
+func registerService() error {
+	host, port, err := serviceEndpoint()
+	if err != nil {
+		return err
+	}
+	switch serviceRegistry {
+	case "consul":
+		if err := registerConsul(host, port); err != nil {
+			return err
+		}
+	case "etcd":
+		if err := registerEtcd(host, port); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown SERVICE_REGISTRY %q, use consul or etcd", serviceRegistry)
+	}
+	log.Printf("[INFO] Registered %s as %s at %s:%d in %s", serviceName, serviceID, host, port, serviceRegistry)
+	reportServiceHealth()
+	go runServiceHeartbeat()
+	return nil
+}
+
+// 📌 Register the instance with a TTL health check in the local Consul agent
+func registerConsul(host string, port int) error {
+	registration := map[string]any{
+		"ID":      serviceID,
+		"Name":    serviceName,
+		"Address": host,
+		"Port":    port,
+		"Tags":    serviceTags,
+		"Check": map[string]any{
+			"CheckID": "service:" + serviceID,
+			"Name":    "Dataset loaded and fresh",
+			"TTL":     serviceTTL.String(),
+			// Instances that died without deregistering disappear on their own
+			"DeregisterCriticalServiceAfter": (10 * serviceTTL).String(),
+		},
+	}
+	_, err := consulRequest(http.MethodPut, "/v1/agent/service/register", registration, nil)
+	return err
+}
+
+// 📌 Put the instance under a fresh etcd lease, in the endpoint format of etcd's naming resolver
+func registerEtcd(host string, port int) error {
+	var grant struct {
+		ID string `json:"ID"`
+	}
+	ttl := max(int(serviceTTL/time.Second), 5)
+	if err := etcdRequest("/v3/lease/grant", map[string]any{"TTL": ttl}, &grant); err != nil {
+		return err
+	}
+	endpoint, err := json.Marshal(map[string]any{
+		"Addr":     net.JoinHostPort(host, strconv.Itoa(port)),
+		"Metadata": map[string]any{"name": serviceName, "tags": serviceTags},
+	})
+	if err != nil {
+		return err
+	}
+	key := etcdServicePrefix + "/" + serviceName + "/" + serviceID
+	if err := etcdRequest("/v3/kv/put", map[string]any{"key": []byte(key), "value": endpoint, "lease": grant.ID}, nil); err != nil {
+		return err
+	}
+	etcdLease = grant.ID
+	return nil
+}
+
+// 📌 Tell the registry whether the instance can serve: a Consul check update, or renewing (or dropping) the etcd lease
+func reportServiceHealth() {
+	problem := datasetProblem()
+	serviceMu.Lock()
+	defer serviceMu.Unlock()
+	if serviceStopped {
+		return
+	}
+	switch serviceRegistry {
+	case "consul":
+		status, output := "passing", "Ready"
+		if problem != "" {
+			status, output = "critical", problem
+		}
+		update := map[string]string{"Status": status, "Output": output}
+		checkPath := "/v1/agent/check/update/" + url.PathEscape("service:"+serviceID)
+		if _, err := consulRequest(http.MethodPut, checkPath, update, nil); err != nil {
+			// Consul drops a service critical for DeregisterCriticalServiceAfter, e.g. during a long first download
+			log.Printf("[WARNING] Updating the Consul health check failed, registering again: %v", err)
+			host, port, _ := serviceEndpoint()
+			if err := registerConsul(host, port); err != nil {
+				log.Printf("[WARNING] Registering in Consul failed: %v", err)
+				return
+			}
+			if _, err := consulRequest(http.MethodPut, checkPath, update, nil); err != nil {
+				log.Printf("[WARNING] Updating the Consul health check failed: %v", err)
+			}
+		}
+	case "etcd":
+		// etcd has no health checks, an instance that cannot serve is not listed
+		if problem != "" {
+			revokeEtcdLease()
+			return
+		}
+		if etcdLease != "" {
+			var reply struct {
+				Result struct {
+					TTL string `json:"TTL"`
+				} `json:"result"`
+			}
+			err := etcdRequest("/v3/lease/keepalive", map[string]string{"ID": etcdLease}, &reply)
+			if err == nil && reply.Result.TTL != "" && reply.Result.TTL != "0" {
+				return
+			}
+			log.Printf("[WARNING] etcd lease %s expired, registering again: %v", etcdLease, err)
+			etcdLease = ""
+		}
+		host, port, _ := serviceEndpoint()
+		if err := registerEtcd(host, port); err != nil {
+			log.Printf("[WARNING] Registering in etcd failed: %v", err)
+		}
+	}
+}
+
+// 📌 Revoke the etcd lease, which deletes the registration
+func revokeEtcdLease() {
+	if etcdLease == "" {
+		return
+	}
+	if err := etcdRequest("/v3/lease/revoke", map[string]string{"ID": etcdLease}, nil); err != nil {
+		log.Printf("[WARNING] Revoking etcd lease %s failed: %v", etcdLease, err)
+	}
+	etcdLease = ""
+}
+
+// 📌 Report the instance's health to the registry every third of SERVICE_TTL
+func runServiceHeartbeat() {
+	ticker := time.NewTicker(max(serviceTTL/3, time.Second))
+	defer ticker.Stop()
+	for range ticker.C {
+		reportServiceHealth()
+	}
+}
+
+// 📌 Remove the instance from SERVICE_REGISTRY, called on shutdown
+func deregisterService() {
+	serviceMu.Lock()
+	defer serviceMu.Unlock()
+	serviceStopped = true
+	switch serviceRegistry {
+	case "consul":
+		if _, err := consulRequest(http.MethodPut, "/v1/agent/service/deregister/"+url.PathEscape(serviceID), nil, nil); err != nil {
+			log.Printf("[WARNING] Deregistering from Consul failed: %v", err)
+			return
+		}
+	case "etcd":
+		revokeEtcdLease()
+	default:
+		return
+	}
+	log.Printf("[INFO] Deregistered %s from %s", serviceID, serviceRegistry)
+}
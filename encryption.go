@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefix of an encrypted record: enc:v1:<wrapped data key>:<nonce and ciphertext>, both base64
+const sealedPrefix = "enc:v1:"
+
+var (
+	// Encrypt confirmations, recorded requests, the watchlist and scheduled payments with one of: a base64 AES-256 key
+	// (usually a file: or vault: reference), an AWS KMS key or a Vault transit key
+	encryptionKey        = getSecret("ENCRYPTION_KEY", "")
+	encryptionKMSKey     = getEnv("ENCRYPTION_KMS_KEY", "")
+	encryptionTransitKey = getEnv("ENCRYPTION_TRANSIT_KEY", "")
+	transitMount         = strings.Trim(getEnv("ENCRYPTION_TRANSIT_MOUNT", "transit"), "/")
+
+	kmsRegion      = getEnv("KMS_REGION", getEnv("AWS_REGION", "us-east-1"))
+	kmsEndpoint    = strings.TrimSuffix(getEnv("KMS_ENDPOINT", "https://kms."+kmsRegion+".amazonaws.com"), "/")
+	kmsCredentials = awsCredentials{getSecret("AWS_ACCESS_KEY_ID", ""), getSecret("AWS_SECRET_ACCESS_KEY", ""), getSecret("AWS_SESSION_TOKEN", "")}
+	kmsClient      = &http.Client{Timeout: 10 * time.Second}
+
+	// Data key of the records this process writes, and its wrapped form stored with every record
+	sealKey     cipher.AEAD
+	sealWrapped string
+	// Data keys of records written by other processes or runs, by wrapped form
+	unwrappedKeys  = make(map[string]cipher.AEAD)
+	encryptionErr  error
+	encryptionOnce sync.Once
+	encryptionMu   sync.Mutex
+)
+
+// 📌 Report whether records are encrypted at rest
+func encryptionEnabled() bool {
+	return encryptionKey != "" || encryptionKMSKey != "" || encryptionTransitKey != ""
+}
+
+// 📌 Prepare the data key once: the static key, or a fresh one generated by KMS or Vault transit
+func initEncryption() error {
+	encryptionOnce.Do(func() {
+		if !encryptionEnabled() {
+			return
+		}
+		configured := 0
+		for _, value := range []string{encryptionKey, encryptionKMSKey, encryptionTransitKey} {
+			if value != "" {
+				configured++
+			}
+		}
+		if configured > 1 {
+			encryptionErr = errors.New("set only one of ENCRYPTION_KEY, ENCRYPTION_KMS_KEY and ENCRYPTION_TRANSIT_KEY")
+			return
+		}
+
+		var plaintext []byte
+		switch {
+		case encryptionKey != "":
+			plaintext, encryptionErr = base64.StdEncoding.DecodeString(strings.TrimSpace(encryptionKey))
+			if encryptionErr != nil {
+				encryptionErr = fmt.Errorf("ENCRYPTION_KEY is not base64: %w", encryptionErr)
+				return
+			}
+		case encryptionKMSKey != "":
+			plaintext, sealWrapped, encryptionErr = kmsGenerateDataKey()
+		default:
+			plaintext, sealWrapped, encryptionErr = transitGenerateDataKey()
+		}
+		if encryptionErr != nil {
+			return
+		}
+		sealKey, encryptionErr = newAEAD(plaintext)
+	})
+	return encryptionErr
+}
+
+// 📌 AES-256-GCM with a data key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("data key has %d bytes, expected 32", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// 📌 Encrypt a record when encryption is enabled, otherwise return it unchanged
+func sealRecord(plaintext []byte) ([]byte, error) {
+	if sealKey == nil {
+		if encryptionEnabled() {
+			return nil, errors.New("encryption is not initialized")
+		}
+		return plaintext, nil
+	}
+	nonce := make([]byte, sealKey.NonceSize(), sealKey.NonceSize()+len(plaintext)+sealKey.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := sealKey.Seal(nonce, nonce, plaintext, nil)
+	return []byte(sealedPrefix + base64.StdEncoding.EncodeToString([]byte(sealWrapped)) + ":" + base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// 📌 Decrypt a record written by sealRecord, records written without encryption pass through
+func openRecord(data []byte) ([]byte, error) {
+	encoded, ok := bytes.CutPrefix(bytes.TrimSpace(data), []byte(sealedPrefix))
+	if !ok {
+		return data, nil
+	}
+	wrappedPart, sealedPart, ok := bytes.Cut(encoded, []byte(":"))
+	if !ok {
+		return nil, errors.New("malformed encrypted record")
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(string(wrappedPart))
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(sealedPart))
+	if err != nil {
+		return nil, err
+	}
+	key, err := recordKey(string(wrapped))
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < key.NonceSize() {
+		return nil, errors.New("malformed encrypted record")
+	}
+	return key.Open(nil, sealed[:key.NonceSize()], sealed[key.NonceSize():], nil)
+}
+
+// 📌 Data key of a record, unwrapped through KMS or Vault transit once per wrapped key
+func recordKey(wrapped string) (cipher.AEAD, error) {
+	if err := initEncryption(); err != nil {
+		return nil, err
+	}
+	if wrapped == "" {
+		// Written with the static ENCRYPTION_KEY
+		if encryptionKey == "" {
+			return nil, errors.New("record was encrypted with ENCRYPTION_KEY, which is not set")
+		}
+		return sealKey, nil
+	}
+	if wrapped == sealWrapped {
+		return sealKey, nil
+	}
+
+	encryptionMu.Lock()
+	defer encryptionMu.Unlock()
+	if key, ok := unwrappedKeys[wrapped]; ok {
+		return key, nil
+	}
+	var plaintext []byte
+	var err error
+	switch {
+	case strings.HasPrefix(wrapped, "vault:"):
+		plaintext, err = transitDecrypt(wrapped)
+	default:
+		plaintext, err = kmsDecrypt(wrapped)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping data key: %w", err)
+	}
+	key, err := newAEAD(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	unwrappedKeys[wrapped] = key
+	return key, nil
+}
+
+// 📌 Call an AWS KMS action with a JSON request
+func kmsRequest(action string, body any, target any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, kmsEndpoint+"/", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	payloadHash := sha256.Sum256(payload)
+	signAWSRequest(req, "kms", kmsRegion, hex.EncodeToString(payloadHash[:]), kmsCredentials, time.Now())
+
+	resp, err := kmsClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("KMS %s returned %s: %s", action, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(target)
+}
+
+// 📌 Generate a data key under ENCRYPTION_KMS_KEY, returning it in plaintext and wrapped
+func kmsGenerateDataKey() ([]byte, string, error) {
+	var reply struct {
+		CiphertextBlob []byte
+		Plaintext      []byte
+	}
+	if err := kmsRequest("GenerateDataKey", map[string]string{"KeyId": encryptionKMSKey, "KeySpec": "AES_256"}, &reply); err != nil {
+		return nil, "", err
+	}
+	return reply.Plaintext, string(reply.CiphertextBlob), nil
+}
+
+// 📌 Unwrap a data key generated by KMS
+func kmsDecrypt(wrapped string) ([]byte, error) {
+	var reply struct {
+		Plaintext []byte
+	}
+	if err := kmsRequest("Decrypt", map[string]any{"CiphertextBlob": []byte(wrapped)}, &reply); err != nil {
+		return nil, err
+	}
+	return reply.Plaintext, nil
+}
+
+// 📌 Generate a data key under ENCRYPTION_TRANSIT_KEY, returning it in plaintext and wrapped (vault:v1:…)
+func transitGenerateDataKey() ([]byte, string, error) {
+	token, err := vaultLogin()
+	if err != nil {
+		return nil, "", err
+	}
+	var reply struct {
+		Data struct {
+			Plaintext  string `json:"plaintext"`
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	if err := vaultRequest(http.MethodPost, "/v1/"+transitMount+"/datakey/plaintext/"+encryptionTransitKey, token, map[string]int{"bits": 256}, &reply); err != nil {
+		return nil, "", err
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(reply.Data.Plaintext)
+	return plaintext, reply.Data.Ciphertext, err
+}
+
+// 📌 Unwrap a data key generated by Vault transit
+func transitDecrypt(wrapped string) ([]byte, error) {
+	if encryptionTransitKey == "" {
+		return nil, errors.New("record was encrypted with Vault transit, set ENCRYPTION_TRANSIT_KEY")
+	}
+	token, err := vaultLogin()
+	if err != nil {
+		return nil, err
+	}
+	var reply struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	if err := vaultRequest(http.MethodPost, "/v1/"+transitMount+"/decrypt/"+encryptionTransitKey, token, map[string]string{"ciphertext": wrapped}, &reply); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(reply.Data.Plaintext)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+)
+
+func TestSealRecordRoundTrip(t *testing.T) {
+	encryptionKey = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	if err := initEncryption(); err != nil {
+		t.Fatalf("initEncryption: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		plaintext []byte
+	}{
+		{"empty", []byte{}},
+		{"JSON record", []byte(`{"nip":"5261040828","bankAccount":"61109010140000071219812874"}`)},
+		{"binary", []byte{0, 1, 2, 255, '\n'}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sealed, err := sealRecord(test.plaintext)
+			if err != nil {
+				t.Fatalf("sealRecord: %v", err)
+			}
+			if !bytes.HasPrefix(sealed, []byte(sealedPrefix)) {
+				t.Fatalf("sealed record %q lacks the %s prefix", sealed, sealedPrefix)
+			}
+			if len(test.plaintext) > 0 && bytes.Contains(sealed, test.plaintext) {
+				t.Fatalf("sealed record contains the plaintext")
+			}
+			opened, err := openRecord(sealed)
+			if err != nil {
+				t.Fatalf("openRecord: %v", err)
+			}
+			if !bytes.Equal(opened, test.plaintext) {
+				t.Errorf("openRecord = %q, want %q", opened, test.plaintext)
+			}
+
+			// A flipped ciphertext byte must fail authentication
+			split := bytes.LastIndexByte(sealed, ':') + 1
+			ciphertext, _ := base64.StdEncoding.DecodeString(string(sealed[split:]))
+			ciphertext[len(ciphertext)-1] ^= 1
+			tampered := append(bytes.Clone(sealed[:split]), base64.StdEncoding.EncodeToString(ciphertext)...)
+			if _, err := openRecord(tampered); err == nil {
+				t.Errorf("openRecord accepted a tampered record")
+			}
+		})
+	}
+
+	// Records written before encryption was enabled are read unchanged
+	if opened, err := openRecord([]byte(`{"nip":"5261040828"}`)); err != nil || string(opened) != `{"nip":"5261040828"}` {
+		t.Errorf("openRecord of a plain record = %q, %v", opened, err)
+	}
+}
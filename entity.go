@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// NIPs per call of the MF API multi-NIP search
+	entityBatchSize = 30
+	// Calls between saves of a running refresh, it is also saved when stopped and at the end
+	entitySaveEvery = 10
+)
+
+var (
+	// Mirror registry details (name, REGON, KRS, accounts) of known NIPs from the MF API and serve /entity/{nip}
+	entityMirror = getEnvBool("ENTITY_MIRROR", false)
+	// Mirrored entities survive restarts in this file
+	entityFile = getEnv("ENTITY_FILE", filepath.Join(dataDir, "entities.json"))
+	// Optional list of NIPs to mirror, one per line (e.g. the supplier master data)
+	entityNIPsFile = getEnv("ENTITY_NIPS_FILE", "")
+	// Most NIPs kept in the mirror, by default as many as one refresh can search within MF_API_QUOTA
+	entityMax = getEnvInt("ENTITY_MAX", defaultEntityMax())
+
+	entities   = make(map[string]*Entity)
+	entitiesOf string
+	// Refresh in progress: its dataset date and the last NIP searched, NIPs are refreshed in ascending order
+	entityCursorOf string
+	entityCursor   string
+	// NIPs the MF API did not know, by search day, so /entity asks for them once a day
+	entityMissing = make(map[string]string)
+	entityMu      sync.Mutex
+	entityRunMu   sync.Mutex
+)
+
+// Registry details of a taxpayer as published by the MF API
+type Entity struct {
+	NIP                   string   `json:"nip"`
+	Name                  string   `json:"name"`
+	StatusVat             string   `json:"statusVat"`
+	REGON                 string   `json:"regon,omitempty"`
+	KRS                   string   `json:"krs,omitempty"`
+	ResidenceAddress      string   `json:"residenceAddress,omitempty"`
+	WorkingAddress        string   `json:"workingAddress,omitempty"`
+	RegistrationLegalDate string   `json:"registrationLegalDate,omitempty"`
+	RemovalDate           string   `json:"removalDate,omitempty"`
+	AccountNumbers        []string `json:"accountNumbers"`
+	HasVirtualAccounts    bool     `json:"hasVirtualAccounts"`
+	// Day of the MF API answer and the request ID to quote to the MF
+	MirroredAt string `json:"mirroredAt"`
+	RequestID  string `json:"requestId,omitempty"`
+}
+
+// Persisted mirror, Date is the dataset date of the last complete refresh
+type entityMirrorFile struct {
+	Date     string    `json:"date"`
+	Entities []*Entity `json:"entities"`
+	// Refresh stopped by the quota or throttling, resumed after the cursor NIP
+	CursorOf string `json:"cursorOf,omitempty"`
+	Cursor   string `json:"cursor,omitempty"`
+}
+
+// Answer of /entity/{nip}: the hash-based status and the mirrored details
+type EntityResponse struct {
+	Response
+	NIP    string  `json:"nip"`
+	Entity *Entity `json:"entity"`
+}
+
+// 📌 Load the persisted mirror, a missing file means an empty one
+func loadEntities() error {
+	if !entityMirror {
+		return nil
+	}
+	var mirror entityMirrorFile
+	if err := readSealedJSONFile(entityFile, &mirror); err != nil {
+		return err
+	}
+	entityMu.Lock()
+	defer entityMu.Unlock()
+	for _, entity := range mirror.Entities {
+		entities[entity.NIP] = entity
+	}
+	entitiesOf, entityCursorOf, entityCursor = mirror.Date, mirror.CursorOf, mirror.Cursor
+	if len(mirror.Entities) > 0 {
+		log.Printf("[INFO] Loaded %d mirrored entities of %s", len(mirror.Entities), mirror.Date)
+	}
+	return nil
+}
+
+// 📌 Persist the mirror, sealed as it holds counterparty accounts; the caller holds entityMu
+func saveEntities() {
+	mirror := entityMirrorFile{Date: entitiesOf, Entities: make([]*Entity, 0, len(entities)), CursorOf: entityCursorOf, Cursor: entityCursor}
+	for _, entity := range entities {
+		mirror.Entities = append(mirror.Entities, entity)
+	}
+	if err := writeSealedJSONFile(entityFile, mirror); err != nil {
+		log.Printf("[ERROR] Saving mirrored entities failed: %v", err)
+	}
+}
+
+// 📌 NIPs the mirror covers: ENTITY_NIPS_FILE, the watchlist, requested NIPs and those mirrored already
+func entityNIPs() []string {
+	seen := make(map[string]bool)
+	var nips []string
+	add := func(nip string) {
+		if len(nips) < entityMax && !seen[nip] && isDigits(nip) && len(nip) == 10 {
+			seen[nip] = true
+			nips = append(nips, nip)
+		}
+	}
+
+	if entityNIPsFile != "" {
+		if file, err := os.Open(entityNIPsFile); err != nil {
+			log.Printf("[WARNING] Reading ENTITY_NIPS_FILE failed: %v", err)
+		} else {
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				add(strings.ReplaceAll(strings.TrimSpace(scanner.Text()), "-", ""))
+			}
+			file.Close()
+		}
+	}
+	if store != nil {
+		if entries, err := store.WatchEntries(""); err == nil {
+			for _, entry := range entries {
+				add(entry.NIP)
+			}
+		}
+	}
+	resultCacheMu.Lock()
+	for key := range queryCounts {
+		nip, _, _ := strings.Cut(key, "/")
+		add(nip)
+	}
+	resultCacheMu.Unlock()
+	entityMu.Lock()
+	for nip := range entities {
+		add(nip)
+	}
+	entityMu.Unlock()
+	sort.Strings(nips)
+	return nips
+}
+
+// 📌 Default ENTITY_MAX, the NIPs searchable with MF_API_QUOTA calls of 30 or 10000 without a quota
+func defaultEntityMax() int {
+	if mfAPIQuota > 0 {
+		return mfAPIQuota * entityBatchSize
+	}
+	return 10000
+}
+
+// 📌 Search up to 30 NIPs in the MF API, the returned map holds the NIPs found
+func mfSearchEntities(nips []string, date string) (map[string]*Entity, error) {
+	var result struct {
+		Entries []struct {
+			Identifier string `json:"identifier"`
+			Subjects   []struct {
+				Name                  string   `json:"name"`
+				NIP                   string   `json:"nip"`
+				StatusVat             string   `json:"statusVat"`
+				REGON                 string   `json:"regon"`
+				KRS                   string   `json:"krs"`
+				ResidenceAddress      string   `json:"residenceAddress"`
+				WorkingAddress        string   `json:"workingAddress"`
+				RegistrationLegalDate string   `json:"registrationLegalDate"`
+				RemovalDate           string   `json:"removalDate"`
+				AccountNumbers        []string `json:"accountNumbers"`
+				HasVirtualAccounts    bool     `json:"hasVirtualAccounts"`
+			} `json:"subjects"`
+		} `json:"entries"`
+		RequestID string `json:"requestId"`
+	}
+	if err := mfAPIGet("/api/search/nips/"+strings.Join(nips, ",")+"?date="+date, &result); err != nil {
+		return nil, err
+	}
+	found := make(map[string]*Entity, len(result.Entries))
+	for _, entry := range result.Entries {
+		if len(entry.Subjects) == 0 {
+			continue
+		}
+		subject := entry.Subjects[0]
+		accounts := subject.AccountNumbers
+		if accounts == nil {
+			accounts = []string{}
+		}
+		found[entry.Identifier] = &Entity{
+			NIP:                   entry.Identifier,
+			Name:                  subject.Name,
+			StatusVat:             subject.StatusVat,
+			REGON:                 subject.REGON,
+			KRS:                   subject.KRS,
+			ResidenceAddress:      subject.ResidenceAddress,
+			WorkingAddress:        subject.WorkingAddress,
+			RegistrationLegalDate: subject.RegistrationLegalDate,
+			RemovalDate:           subject.RemovalDate,
+			AccountNumbers:        accounts,
+			HasVirtualAccounts:    subject.HasVirtualAccounts,
+			MirroredAt:            date,
+			RequestID:             result.RequestID,
+		}
+	}
+	return found, nil
+}
+
+// 📌 Refresh the mirror from the MF API once per dataset date, runs after every dataset load
+func refreshEntities() {
+	if !entityMirror || mode == "mock" {
+		return
+	}
+	entityRunMu.Lock()
+	defer entityRunMu.Unlock()
+
+	mu.RLock()
+	date := dataDate
+	mu.RUnlock()
+	entityMu.Lock()
+	done := entitiesOf == date
+	cursor := ""
+	if entityCursorOf == date {
+		cursor = entityCursor
+	}
+	entityMu.Unlock()
+	if done {
+		return
+	}
+
+	// NIPs up to the cursor were refreshed for this date before the quota or a restart stopped it
+	nips := entityNIPs()
+	skipped := sort.SearchStrings(nips, cursor)
+	if skipped < len(nips) && nips[skipped] == cursor {
+		skipped++
+	}
+	if cursor != "" {
+		log.Printf("[INFO] Resuming the entity mirror of %s after %d of %d NIPs", date, skipped, len(nips))
+	}
+	apiDate := time.Now().In(warsaw).Format("2006-01-02")
+	started := time.Now()
+	refreshed, removed := 0, 0
+	for start := skipped; start < len(nips); start += entityBatchSize {
+		chunk := nips[start:min(start+entityBatchSize, len(nips))]
+		found, err := mfSearchEntities(chunk, apiDate)
+		if err != nil {
+			// Quota or throttling, the rest is tried after the next load
+			log.Printf("[WARNING] Mirroring entities stopped after %d of %d NIPs: %v", start, len(nips), err)
+			if start > skipped {
+				entityMu.Lock()
+				saveEntities()
+				entityMu.Unlock()
+			}
+			return
+		}
+		entityMu.Lock()
+		for _, nip := range chunk {
+			if entity, ok := found[nip]; ok {
+				entities[nip] = entity
+				refreshed++
+			} else if _, ok := entities[nip]; ok {
+				// No longer in the registry
+				delete(entities, nip)
+				removed++
+			}
+		}
+		// Progress survives a restart, the next run continues after the last saved chunk
+		entityCursorOf, entityCursor = date, chunk[len(chunk)-1]
+		if (start-skipped)/entityBatchSize%entitySaveEvery == entitySaveEvery-1 {
+			saveEntities()
+		}
+		entityMu.Unlock()
+	}
+
+	entityMu.Lock()
+	entitiesOf, entityCursorOf, entityCursor = date, "", ""
+	saveEntities()
+	entityMu.Unlock()
+	log.Printf("[INFO] Mirrored %d entities for %s in %s (%d removed)", refreshed, date, time.Since(started).Round(time.Second), removed)
+}
+
+// 📌 Mirrored entity of a NIP, searched in the MF API and added to the mirror on a miss
+func lookupEntity(nip string) (*Entity, error) {
+	apiDate := time.Now().In(warsaw).Format("2006-01-02")
+	entityMu.Lock()
+	entity, ok := entities[nip]
+	missing := entityMissing[nip] == apiDate
+	entityMu.Unlock()
+	if ok || missing {
+		return entity, nil
+	}
+
+	found, err := mfSearchEntities([]string{nip}, apiDate)
+	if err != nil {
+		return nil, err
+	}
+	entity = found[nip]
+	entityMu.Lock()
+	defer entityMu.Unlock()
+	if entity == nil {
+		// Unknown NIPs cost no further calls until the next day
+		if len(entityMissing) >= entityMax {
+			for known, day := range entityMissing {
+				if day != apiDate {
+					delete(entityMissing, known)
+				}
+			}
+		}
+		if len(entityMissing) < entityMax {
+			entityMissing[nip] = apiDate
+		}
+	} else if len(entities) < entityMax {
+		entities[nip] = entity
+		saveEntities()
+	}
+	return entity, nil
+}
+
+// 📌 Handle /entity/{nip} API endpoint
+func entityHandler(w http.ResponseWriter, r *http.Request) {
+	if !entityMirror {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Entity mirror is disabled, set ENTITY_MIRROR=true"})
+		return
+	}
+	nip := r.PathValue("nip")
+	if category, fields := validateInput(nip, ""); category != "" {
+		recordUsage(tenantFromRequest(r), "ERROR")
+		recordError(category)
+		json.NewEncoder(w).Encode(validationResponse(fields))
+		return
+	}
+
+	result := EntityResponse{NIP: nip}
+	if problem := datasetProblem(); problem != "" {
+		status, unavailable := unavailableResponse(problem)
+		if status != http.StatusOK {
+			recordUsage(tenantFromRequest(r), "ERROR")
+			recordError("dataset_unavailable")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(unavailable)
+			return
+		}
+		result.Response = unavailable
+	} else if result.Response = verify(nip, ""); result.code != 0 {
+		recordUsage(tenantFromRequest(r), "ERROR")
+		recordError("mf_api")
+		w.WriteHeader(result.code)
+		json.NewEncoder(w).Encode(result.Response)
+		return
+	}
+
+	entity, err := lookupEntity(nip)
+	if err != nil {
+		log.Printf("[WARNING] Searching entity %s in the MF API failed: %v", nip, err)
+		result.Warning = "ENTITY_UNAVAILABLE"
+	}
+	result.Entity = entity
+	recordUsage(tenantFromRequest(r), result.Status)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Comment line sent on idle streams so proxies keep the connection open
+const eventsKeepAlive = 30 * time.Second
+
+// Dataset activation sent to /events subscribers
+type DatasetEvent struct {
+	ID           string `json:"id"`
+	Date         string `json:"date"`
+	ActiveHashes int    `json:"activeHashes"`
+	ExemptHashes int    `json:"exemptHashes"`
+	Masks        int    `json:"masks"`
+	Iterations   int    `json:"iterations"`
+	ActivatedAt  string `json:"activatedAt"`
+}
+
+var (
+	eventsMu         sync.Mutex
+	eventSubscribers = map[chan DatasetEvent]struct{}{}
+	// Latest activation, sent to every new subscriber first
+	lastDatasetEvent *DatasetEvent
+)
+
+// 📌 Notify /events subscribers that a new dataset is active
+func publishDatasetEvent() {
+	mu.RLock()
+	event := DatasetEvent{
+		Date:         dataDate,
+		ActiveHashes: len(activeHashes),
+		ExemptHashes: len(exemptHashes),
+		Masks:        len(masks),
+		Iterations:   iterations,
+		ActivatedAt:  time.Now().UTC().Format(time.RFC3339),
+	}
+	mu.RUnlock()
+	// Same value as the /snapshot ETag, without the quotes
+	event.ID = strings.Trim(datasetETag(), `"`)
+
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	lastDatasetEvent = &event
+	for subscriber := range eventSubscribers {
+		select {
+		case subscriber <- event:
+		default:
+			// A subscriber that is this far behind only needs the latest event
+		}
+	}
+}
+
+// 📌 Write a single server-sent event
+func writeEvent(w http.ResponseWriter, event DatasetEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: dataset\nid: %s\ndata: %s\n\n", event.ID, data)
+	return err
+}
+
+// 📌 Handle /events API endpoint, a server-sent events stream of dataset activations
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Streaming unsupported"})
+		return
+	}
+
+	events := make(chan DatasetEvent, 4)
+	eventsMu.Lock()
+	eventSubscribers[events] = struct{}{}
+	current := lastDatasetEvent
+	eventsMu.Unlock()
+	defer func() {
+		eventsMu.Lock()
+		delete(eventSubscribers, events)
+		eventsMu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Reconnecting clients that already saw the current dataset get no repeat
+	if current != nil && current.ID != r.Header.Get("Last-Event-ID") {
+		if writeEvent(w, *current) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			if writeEvent(w, event) != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Keys kept whatever ?fields= asks for: the outcome, error details and the item a batch line belongs to
+var alwaysKeptFields = []string{"response", "message", "errors", "incident", "index", "nip", "bankAccount"}
+
+// Drops the top-level keys not asked for from every JSON value written, batch lines included
+type fieldsWriter struct {
+	http.ResponseWriter
+	fields map[string]bool
+}
+
+// 📌 Keep only the requested keys of a JSON object, or of every object in a JSON array
+func filterFields(data []byte, fields map[string]bool) ([]byte, bool) {
+	trimmed := bytes.TrimSpace(data)
+	filterObject := func(raw json.RawMessage) (json.RawMessage, bool) {
+		// Decoded token by token so the kept keys stay in their original order
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+			return nil, false
+		}
+		filtered := []byte{'{'}
+		for decoder.More() {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, false
+			}
+			key, _ := token.(string)
+			var value json.RawMessage
+			if err := decoder.Decode(&value); err != nil {
+				return nil, false
+			}
+			if !fields[key] {
+				continue
+			}
+			if len(filtered) > 1 {
+				filtered = append(filtered, ',')
+			}
+			name, _ := json.Marshal(key)
+			filtered = append(append(append(filtered, name...), ':'), value...)
+		}
+		return append(filtered, '}'), true
+	}
+
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		filtered, ok := filterObject(trimmed)
+		return append(filtered, '\n'), ok
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		var items []json.RawMessage
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, false
+		}
+		for i, item := range items {
+			if filtered, ok := filterObject(item); ok {
+				items[i] = filtered
+			}
+		}
+		filtered, err := json.Marshal(items)
+		return append(filtered, '\n'), err == nil
+	}
+	return nil, false
+}
+
+// 📌 Filter every line of a write, json.Encoder writes a single value but an idempotent replay writes the whole NDJSON body at once
+//
+// Anything that is not JSON (e.g. a workbook) passes unchanged.
+func (w *fieldsWriter) Write(data []byte) (int, error) {
+	var filtered []byte
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			filtered = append(filtered, line...)
+			continue
+		}
+		kept, ok := filterFields(line, w.fields)
+		if !ok {
+			return w.ResponseWriter.Write(data)
+		}
+		filtered = append(filtered, kept...)
+	}
+	if _, err := w.ResponseWriter.Write(filtered); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *fieldsWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// 📌 Answer with only the response fields listed in ?fields=, e.g. fields=status,date
+func selectFields(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list := r.URL.Query().Get("fields")
+		if list == "" {
+			next(w, r)
+			return
+		}
+		fields := make(map[string]bool)
+		for _, field := range strings.Split(list, ",") {
+			fields[strings.TrimSpace(field)] = true
+		}
+		for _, field := range alwaysKeptFields {
+			fields[field] = true
+		}
+		next(&fieldsWriter{ResponseWriter: w, fields: fields}, r)
+	}
+}
@@ -0,0 +1,180 @@
+// Package flatfile verifies NIPs and bank accounts against the Ministry of
+// Finance flat file. It only uses the standard library, so the same checks
+// compile for the server and for GOOS=js GOARCH=wasm.
+package flatfile
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Largest liczbaTransformacji accepted by Load, as the server's TRANSFORM_COUNT_MAX default (MF uses 5000)
+const DefaultMaxIterations = 20000
+
+// Accepted range of liczbaTransformacji, every verification runs that many SHA-512 rounds
+type Limits struct {
+	// 1 if not set
+	MinIterations int
+	// DefaultMaxIterations if not set
+	MaxIterations int
+}
+
+// Loaded flat file, the maps are replaced and never modified once in use
+type Dataset struct {
+	Date       string
+	Iterations int
+	Active     map[string]bool
+	Exempt     map[string]bool
+	Masks      []string
+}
+
+// A single hash lookup performed by Lookup
+type Check struct {
+	// "nip", "account" or "mask"
+	Check  string
+	Mask   string
+	Input  string
+	Active bool
+	Exempt bool
+}
+
+// Outcome of a lookup, Status and Bank as in the /verify response
+type Result struct {
+	Status string
+	Bank   string
+	// How the bank account matched: "direct", "masked" or "none"
+	Match string
+}
+
+// 📌 Generate SHA-512 Hash with an explicit number of iterations
+//
+// Every round hashes the lowercase hex of the previous digest. The hex is
+// encoded into one fixed buffer, so the chain allocates nothing per round;
+// crypto/sha512 itself uses the AVX2 or SHA-512 instructions of the CPU.
+func Hash(input string, rounds int) string {
+	if rounds < 1 {
+		return input
+	}
+
+	var encoded [2 * sha512.Size]byte
+	sum := sha512.Sum512([]byte(input))
+	for i := 1; i < rounds; i++ {
+		hex.Encode(encoded[:], sum[:])
+		sum = sha512.Sum512(encoded[:])
+	}
+	hex.Encode(encoded[:], sum[:])
+	return string(encoded[:])
+}
+
+// 📌 Apply a mask to an account number, positions past the end of a short account stay 'Y'
+func ApplyMask(bank string, mask string) string {
+	maskedResult := []rune(mask)
+	accountDigits := []rune(bank)
+
+	for i, char := range maskedResult {
+		if char == 'Y' && i < len(accountDigits) {
+			// Replace 'Y' with the corresponding digit from the account number
+			maskedResult[i] = accountDigits[i]
+		} else if char == 'X' {
+			// Keep 'X' as it represents a placeholder
+			maskedResult[i] = 'X'
+		}
+	}
+
+	return string(maskedResult)
+}
+
+// 📌 Read a flat file or a /snapshot of one (after gunzip) with the default Limits
+func Load(r io.Reader) (*Dataset, error) {
+	return LoadLimited(r, Limits{})
+}
+
+// 📌 Read a flat file or a /snapshot of one (after gunzip), rejecting a liczbaTransformacji outside limits
+func LoadLimited(r io.Reader, limits Limits) (*Dataset, error) {
+	if limits.MinIterations < 1 {
+		limits.MinIterations = 1
+	}
+	if limits.MaxIterations < 1 {
+		limits.MaxIterations = DefaultMaxIterations
+	}
+	var file struct {
+		Header struct {
+			DataDate       string `json:"dataGenerowaniaDanych"`
+			TransformCount string `json:"liczbaTransformacji"`
+		} `json:"naglowek"`
+		ActiveHashes []string `json:"skrotyPodatnikowCzynnych"`
+		ExemptHashes []string `json:"skrotyPodatnikowZwolnionych"`
+		Masks        []string `json:"maski"`
+	}
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, err
+	}
+	iterations, err := strconv.Atoi(file.Header.TransformCount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid liczbaTransformacji %q", file.Header.TransformCount)
+	}
+	if iterations < limits.MinIterations || iterations > limits.MaxIterations {
+		return nil, fmt.Errorf("liczbaTransformacji %d is outside %d-%d", iterations, limits.MinIterations, limits.MaxIterations)
+	}
+
+	dataset := &Dataset{
+		Date:       file.Header.DataDate,
+		Iterations: iterations,
+		Active:     make(map[string]bool, len(file.ActiveHashes)),
+		Exempt:     make(map[string]bool, len(file.ExemptHashes)),
+		Masks:      file.Masks,
+	}
+	for _, hash := range file.ActiveHashes {
+		dataset.Active[hash] = true
+	}
+	for _, hash := range file.ExemptHashes {
+		dataset.Exempt[hash] = true
+	}
+	return dataset, nil
+}
+
+// 📌 Look up a NIP and optional bank account, reporting every check performed to onCheck (may be nil)
+func (d *Dataset) Lookup(nip string, bank string, onCheck func(Check)) Result {
+	check := func(kind string, mask string, input string) (bool, bool) {
+		hashed := Hash(input, d.Iterations)
+		isActive, isExempt := d.Active[hashed], d.Exempt[hashed]
+		if onCheck != nil {
+			onCheck(Check{Check: kind, Mask: mask, Input: input, Active: isActive, Exempt: isExempt})
+		}
+		return isActive, isExempt
+	}
+
+	isActive, isExempt := check("nip", "", d.Date+nip)
+	if isActive {
+		return Result{Status: "ACTIVE", Bank: "NA", Match: "none"}
+	}
+	if isExempt {
+		return Result{Status: "EXEMPT", Bank: "NA", Match: "none"}
+	}
+
+	if bank != "" {
+		isActiveBank, isExemptBank := check("account", "", d.Date+nip+bank)
+		if isActiveBank {
+			return Result{Status: "ACTIVE", Bank: "MATCHED", Match: "direct"}
+		}
+		if isExemptBank {
+			return Result{Status: "EXEMPT", Bank: "MATCHED", Match: "direct"}
+		}
+
+		for _, mask := range d.Masks {
+			isActiveMasked, isExemptMasked := check("mask", mask, d.Date+nip+ApplyMask(bank, mask))
+			if isActiveMasked {
+				return Result{Status: "ACTIVE", Bank: "MATCHED", Match: "masked"}
+			}
+			if isExemptMasked {
+				return Result{Status: "EXEMPT", Bank: "MATCHED", Match: "masked"}
+			}
+		}
+	}
+
+	return Result{Status: "NOT_FOUND", Bank: "NOT_FOUND", Match: "none"}
+}
@@ -0,0 +1,46 @@
+package flatfile
+
+import "testing"
+
+func TestHash(t *testing.T) {
+	// Expected digests computed independently with Python's hashlib
+	tests := []struct {
+		name   string
+		input  string
+		rounds int
+		want   string
+	}{
+		{"no rounds", "201910185261040828", 0, "201910185261040828"},
+		{"single round", "201910185261040828", 1, "ca49c3517c83bb4274ec3214f66e809438ccbcaa37bf40cbeca2e4633cc3fa28db2fdcc021dd3565385ffb5044a23be4301c1a92de0b8719ce0e6f948e2b30c8"},
+		{"NIP", "201910185261040828", 5000, "edd26801e91509e663e1a0b183c838e46727c29e473cb6d15d2d3cd6260b38057895258cf475f88be38a493be85e63e0b8f66ab253095f28c6e3765d8062b681"},
+		{"NIP and account", "20191018526104082861109010140000071219812874", 5000, "9d20ae3af42f96e85cf4913615db244343b7faa8a18a5735a4df9fd6d0ff79944ad7cf1f91cf43e5c52f5db9be23fc40115549d51c6e69e48ee2a92ae106b043"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Hash(test.input, test.rounds); got != test.want {
+				t.Errorf("Hash(%q, %d) = %s, want %s", test.input, test.rounds, got, test.want)
+			}
+		})
+	}
+}
+
+func TestApplyMask(t *testing.T) {
+	tests := []struct {
+		name string
+		bank string
+		mask string
+		want string
+	}{
+		{"sort code kept", "61109010140000071219812874", "YY10901014XXXXXXXXXXXXXXXX", "6110901014XXXXXXXXXXXXXXXX"},
+		{"digits of the mask stay", "61109010140000071219812874", "YY99999999YYYY000000YYYYYY", "61999999990000000000812874"},
+		{"only X", "61109010140000071219812874", "XXXXXXXXXXXXXXXXXXXXXXXXXX", "XXXXXXXXXXXXXXXXXXXXXXXXXX"},
+		{"short account", "6110", "YYYYYYXXXXXXXXXXXXXXXXXXXX", "6110YYXXXXXXXXXXXXXXXXXXXX"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ApplyMask(test.bank, test.mask); got != test.want {
+				t.Errorf("ApplyMask(%q, %q) = %s, want %s", test.bank, test.mask, got, test.want)
+			}
+		})
+	}
+}
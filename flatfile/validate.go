@@ -0,0 +1,98 @@
+package flatfile
+
+import "encoding/json"
+
+// Single offending input field of a rejected verification
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Weights of the first nine NIP digits, the tenth is the check digit
+var nipWeights = []int{6, 5, 7, 2, 3, 4, 5, 6, 7}
+
+// 📌 Validate a single verification input, returns the error category and the offending fields
+//
+// The server, the whitelist handler and the wasm build share these rules, so
+// the same input is rejected with the same codes and messages everywhere.
+func ValidateInput(nip string, bank string, checksums bool) (string, []FieldError) {
+	var fields []FieldError
+	category := ""
+
+	switch {
+	case nip == "":
+		fields = append(fields, FieldError{Field: "nip", Code: "MISSING", Message: "NIP is required"})
+		category = "missing_parameters"
+	case !IsDigits(nip):
+		fields = append(fields, FieldError{Field: "nip", Code: "NOT_NUMERIC", Message: "NIP must contain digits only"})
+	case len(nip) != 10:
+		fields = append(fields, FieldError{Field: "nip", Code: "WRONG_LENGTH", Message: "NIP must have 10 digits"})
+	case checksums && !ValidNIPChecksum(nip):
+		fields = append(fields, FieldError{Field: "nip", Code: "INVALID_CHECKSUM", Message: "NIP check digit does not match"})
+	}
+	if category == "" && len(fields) > 0 {
+		category = "invalid_nip"
+	}
+
+	if bank != "" {
+		before := len(fields)
+		switch {
+		case !IsDigits(bank):
+			fields = append(fields, FieldError{Field: "bank", Code: "NOT_NUMERIC", Message: "Bank account must contain digits only (26-digit NRB without spaces or PL prefix)"})
+		case len(bank) != 26:
+			fields = append(fields, FieldError{Field: "bank", Code: "WRONG_LENGTH", Message: "Bank account must have 26 digits"})
+		case checksums && !ValidNRBChecksum(bank):
+			fields = append(fields, FieldError{Field: "bank", Code: "INVALID_CHECKSUM", Message: "Bank account check digits do not match"})
+		}
+		if category == "" && len(fields) > before {
+			category = "invalid_bank"
+		}
+	}
+	return category, fields
+}
+
+// 📌 Check that a value is non-empty and contains only ASCII digits
+func IsDigits(value string) bool {
+	if value == "" {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		if value[i] < '0' || value[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// 📌 Check the NIP check digit (weighted sum modulo 11)
+func ValidNIPChecksum(nip string) bool {
+	sum := 0
+	for i, weight := range nipWeights {
+		sum += int(nip[i]-'0') * weight
+	}
+	return sum%11 == int(nip[9]-'0')
+}
+
+// 📌 Check the NRB check digits (IBAN modulo 97 with the PL country code)
+func ValidNRBChecksum(nrb string) bool {
+	// Move the country code ("PL" = 25 21) and check digits to the end
+	rearranged := nrb[2:] + "2521" + nrb[:2]
+	remainder := 0
+	for i := 0; i < len(rearranged); i++ {
+		remainder = (remainder*10 + int(rearranged[i]-'0')) % 97
+	}
+	return remainder == 1
+}
+
+// 📌 accountAssigned value for a verification, computed like the official MF API
+func AccountAssigned(bank string, match string) json.RawMessage {
+	switch {
+	case bank == "":
+		return json.RawMessage("null")
+	case match == "direct" || match == "masked":
+		return json.RawMessage("true")
+	default:
+		return json.RawMessage("false")
+	}
+}
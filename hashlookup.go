@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// 📌 Check that a value is a 128-character lowercase hex SHA-512 digest
+func isHashValue(value string) bool {
+	return len(value) == 128 && strings.Trim(value, "0123456789abcdef") == ""
+}
+
+// 📌 Handle /verify/hash API endpoint
+func hashLookupHandler(w http.ResponseWriter, r *http.Request) {
+	// Accept the hash in a POST form too, so it does not end up in access logs
+	hash := strings.ToLower(r.FormValue("hash"))
+	if !isHashValue(hash) {
+		recordUsage(tenantFromRequest(r), "ERROR")
+		recordError("invalid_hash")
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Invalid hash, expected 128 hex characters"})
+		return
+	}
+
+	if problem := datasetProblem(); problem != "" {
+		status, result := unavailableResponse(problem)
+		recordUsage(tenantFromRequest(r), "ERROR")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	mu.RLock()
+	currentDataDate := dataDate
+	_, isActive := activeHashes[hash]
+	_, isExempt := exemptHashes[hash]
+	mu.RUnlock()
+
+	result := Response{Response: "OK", Status: "NOT_FOUND", Date: currentDataDate}
+	if isActive {
+		result.Status = "ACTIVE"
+	} else if isExempt {
+		result.Status = "EXEMPT"
+	}
+	annotateDataAge(&result)
+
+	recordUsage(tenantFromRequest(r), result.Status)
+	recordStats(result, false)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Hash computed per the MF flat-file algorithm
+type HashResponse struct {
+	Response   string `json:"response"`
+	Date       string `json:"date"`
+	Iterations int    `json:"iterations"`
+	Input      string `json:"input"`
+	Hash       string `json:"hash"`
+}
+
+// 📌 Validate the inputs of a hash computation
+func validateHashInput(date string, nip string, bank string, rounds int) string {
+	switch {
+	case len(date) != 8 || strings.Trim(date, "0123456789") != "":
+		return "Invalid date, expected YYYYMMDD"
+	case nip == "":
+		return "Missing required parameters"
+	case bank != "" && len(bank) != 26:
+		return "Invalid bank account number"
+	case rounds < 1 || rounds > transformCountMax:
+		// Capped like the flat files themselves so the endpoint cannot be used to burn CPU
+		return fmt.Sprintf("Invalid iterations, expected 1-%d", transformCountMax)
+	}
+	return ""
+}
+
+// 📌 Handle /hash API endpoint
+func hashHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	mu.RLock()
+	date, rounds := dataDate, iterations
+	mu.RUnlock()
+
+	if value := query.Get("date"); value != "" {
+		date = value
+	}
+	if value := query.Get("iterations"); value != "" {
+		// Unparsable values become 0 and are rejected by validation
+		rounds, _ = strconv.Atoi(value)
+	}
+	nip, bank := query.Get("nip"), query.Get("bank")
+
+	if message := validateHashInput(date, nip, bank, rounds); message != "" {
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: message})
+		return
+	}
+
+	// Runs on a NIP worker like a verification, so hash requests queue behind the same limit
+	release, err := nipClass.enter(r.Context())
+	if err != nil {
+		recordError("overloaded")
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Too many verifications in progress, retry shortly"})
+		return
+	}
+	input := date + nip + bank
+	hash := calculateHashRounds(input, rounds)
+	release()
+	json.NewEncoder(w).Encode(HashResponse{Response: "OK", Date: date, Iterations: rounds, Input: input, Hash: hash})
+}
+
+// 📌 Compute a flat-file hash on the command line
+func runHash(args []string) int {
+	flags := flag.NewFlagSet("hash", flag.ExitOnError)
+	date := flags.String("date", today(), "data date (YYYYMMDD)")
+	nip := flags.String("nip", "", "NIP")
+	bank := flags.String("bank", "", "bank account number (26 digits, optional)")
+	rounds := flags.Int("iterations", iterations, "number of SHA-512 iterations")
+	flags.Parse(args)
+
+	if message := validateHashInput(*date, *nip, *bank, *rounds); message != "" {
+		fmt.Println(message)
+		return 2
+	}
+
+	fmt.Println(calculateHashRounds(*date+*nip+*bank, *rounds))
+	return 0
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Free space below which the disk check reports a warning
+const lowDiskSpace = 1 << 30
+
+// Result of a single diagnostic check
+type HealthCheck struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// Verbose health report
+type HealthReport struct {
+	Response string                 `json:"response"`
+	Message  string                 `json:"message"`
+	Checks   map[string]HealthCheck `json:"checks"`
+}
+
+// 📌 Check free space in the data and temp directories
+func checkDisk() HealthCheck {
+	var messages []string
+	status := "OK"
+	for _, dir := range []struct{ name, path string }{{"data", dataDir}, {"tmp", tmpDir}} {
+		free, err := freeDiskSpace(dir.path)
+		if err != nil {
+			return HealthCheck{Status: "ERROR", Message: fmt.Sprintf("%s directory %s: %v", dir.name, dir.path, err)}
+		}
+		if free < lowDiskSpace {
+			status = "WARNING"
+		}
+		messages = append(messages, fmt.Sprintf("%s directory %s: %d MiB free", dir.name, dir.path, free>>20))
+	}
+	return HealthCheck{Status: status, Message: strings.Join(messages, ", ")}
+}
+
+// 📌 Check that the 7z binary can be found
+func checkSevenZip() HealthCheck {
+	binary, err := findSevenZip()
+	if err != nil {
+		return HealthCheck{Status: "ERROR", Message: err.Error()}
+	}
+	return HealthCheck{Status: "OK", Message: binary}
+}
+
+// 📌 Check outbound connectivity to the Ministry of Finance host
+func checkMFConnectivity() HealthCheck {
+	target, err := url.Parse(strings.ReplaceAll(dataURL, "{DATE}", today()))
+	if err != nil {
+		return HealthCheck{Status: "ERROR", Message: err.Error()}
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	started := time.Now()
+	resp, err := client.Head(target.Scheme + "://" + target.Host + "/")
+	if err != nil {
+		return HealthCheck{Status: "ERROR", Message: err.Error()}
+	}
+	resp.Body.Close()
+	return HealthCheck{Status: "OK", Message: fmt.Sprintf("%s reachable (HTTP %d in %s)", target.Host, resp.StatusCode, time.Since(started).Round(time.Millisecond))}
+}
+
+// 📌 Check memory headroom against the soft or container memory limit
+func checkMemory() HealthCheck {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	limit := debug.SetMemoryLimit(-1)
+	if limit == math.MaxInt64 {
+		cgroupLimit, err := cgroupMemoryLimit()
+		if err != nil {
+			return HealthCheck{Status: "OK", Message: fmt.Sprintf("%d MiB in use, no memory limit", stats.Sys>>20)}
+		}
+		limit = cgroupLimit
+	}
+
+	used := int64(stats.Sys - stats.HeapReleased)
+	headroom := limit - used
+	status := "OK"
+	if headroom < limit/10 {
+		status = "WARNING"
+	}
+	return HealthCheck{Status: status, Message: fmt.Sprintf("%d MiB in use of %d MiB limit, %d MiB headroom", used>>20, limit>>20, headroom>>20)}
+}
+
+// 📌 Check that a usable dataset is loaded
+func checkDataset() HealthCheck {
+	if problem := datasetProblem(); problem != "" {
+		return HealthCheck{Status: "ERROR", Message: problem}
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	return HealthCheck{Status: "OK", Message: fmt.Sprintf("data date %s, %d active and %d exempt hashes, %d masks",
+		dataDate, len(activeHashes), len(exemptHashes), len(masks))}
+}
+
+// 📌 Run all diagnostic checks
+func verboseHealth() HealthReport {
+	report := HealthReport{Response: "OK", Message: "Service is running", Checks: map[string]HealthCheck{
+		"dataset": checkDataset(),
+		"disk":    checkDisk(),
+		"memory":  checkMemory(),
+	}}
+	if dataSource == "mf" || dataSource == "file" || dataSource == "s3" {
+		report.Checks["sevenZip"] = checkSevenZip()
+	}
+	if dataSource == "mf" {
+		report.Checks["mfConnectivity"] = checkMFConnectivity()
+	}
+
+	for _, check := range report.Checks {
+		if check.Status == "ERROR" {
+			report.Response = "ERROR"
+			report.Message = "Some checks failed"
+		}
+	}
+	return report
+}
+
+// 📌 Handle /health API endpoint
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("verbose") == "true" {
+		json.NewEncoder(w).Encode(verboseHealth())
+		return
+	}
+	json.NewEncoder(w).Encode(Response{Response: "OK", Message: "Service is running"})
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Status timelines of watched pairs, kept after a pair leaves the watchlist
+var historyFile = getEnv("HISTORY_FILE", filepath.Join(dataDir, "history.json"))
+
+// Time span in which consecutive datasets reported the same status for a pair
+type StatusPeriod struct {
+	Status     string `json:"status"`
+	BankStatus string `json:"bank"`
+	// First and last dataset date (YYYYMMDD) that reported this status
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Since     time.Time `json:"since"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// Timeline of a single NIP/account pair of a tenant
+type StatusHistory struct {
+	Tenant  string         `json:"tenant"`
+	NIP     string         `json:"nip"`
+	Bank    string         `json:"bankAccount,omitempty"`
+	Periods []StatusPeriod `json:"periods"`
+}
+
+// Changes are written this long after the first unsaved one, so a burst of watched verifications is one write
+const historySaveDelay = 5 * time.Second
+
+var (
+	// Guarded by watchlistMu, history only grows while a pair is watched
+	statusHistory = make(map[string]*StatusHistory)
+	// Pending save of the status history, guarded by watchlistMu
+	historySaveTimer *time.Timer
+	// Serializes writes of HISTORY_FILE, which run outside watchlistMu
+	historyFileMu sync.Mutex
+)
+
+// 📌 Load the persisted status history, a missing file is an empty history
+func loadHistory() error {
+	var histories []*StatusHistory
+	if err := readSealedJSONFile(historyFile, &histories); err != nil {
+		return err
+	}
+
+	watchlistMu.Lock()
+	defer watchlistMu.Unlock()
+	for _, history := range histories {
+		statusHistory[watchKey(history.Tenant, history.NIP, history.Bank)] = history
+	}
+	if len(histories) > 0 {
+		log.Printf("[INFO] Loaded status history of %d pairs", len(histories))
+	}
+	return nil
+}
+
+// 📌 Save the status history after historySaveDelay, the caller holds watchlistMu
+func saveHistoryLater() {
+	if historySaveTimer == nil {
+		historySaveTimer = time.AfterFunc(historySaveDelay, saveHistory)
+	}
+}
+
+// 📌 Persist the status history, copied under watchlistMu and written outside it
+func saveHistory() {
+	watchlistMu.Lock()
+	historySaveTimer = nil
+	histories := make([]StatusHistory, 0, len(statusHistory))
+	for _, history := range statusHistory {
+		copied := *history
+		copied.Periods = append([]StatusPeriod(nil), history.Periods...)
+		histories = append(histories, copied)
+	}
+	watchlistMu.Unlock()
+	sort.Slice(histories, func(i, j int) bool {
+		return watchKey(histories[i].Tenant, histories[i].NIP, histories[i].Bank) < watchKey(histories[j].Tenant, histories[j].NIP, histories[j].Bank)
+	})
+
+	historyFileMu.Lock()
+	defer historyFileMu.Unlock()
+	if err := writeSealedJSONFile(historyFile, histories); err != nil {
+		log.Printf("[ERROR] Saving status history failed: %v", err)
+	}
+}
+
+// 📌 Write a pending status history save right away, on shutdown
+func flushHistory() {
+	watchlistMu.Lock()
+	pending := historySaveTimer != nil && historySaveTimer.Stop()
+	watchlistMu.Unlock()
+	if pending {
+		saveHistory()
+	}
+}
+
+// 📌 Extend the current period of a pair or open a new one on a status change or a gap, the caller holds watchlistMu
+func recordHistory(entry *WatchEntry, result Response, now time.Time) {
+	if result.Date == "" {
+		return
+	}
+	key := watchKey(entry.Tenant, entry.NIP, entry.Bank)
+	history, ok := statusHistory[key]
+	if !ok {
+		history = &StatusHistory{Tenant: entry.Tenant, NIP: entry.NIP, Bank: entry.Bank}
+		statusHistory[key] = history
+	}
+
+	if last := len(history.Periods) - 1; last >= 0 {
+		current := &history.Periods[last]
+		if current.Status == result.Status && current.BankStatus == result.Bank && !datesApart(current.To, result.Date) {
+			current.To = max(current.To, result.Date)
+			current.CheckedAt = now
+			return
+		}
+	}
+	history.Periods = append(history.Periods, StatusPeriod{
+		Status:     result.Status,
+		BankStatus: result.Bank,
+		From:       result.Date,
+		To:         result.Date,
+		Since:      now,
+		CheckedAt:  now,
+	})
+}
+
+// 📌 Check whether a dataset date lies more than a day after the end of a period, nothing is known about the days between
+func datesApart(to string, date string) bool {
+	last, err := time.Parse("20060102", to)
+	if err != nil {
+		return false
+	}
+	next, err := time.Parse("20060102", date)
+	return err == nil && next.Sub(last) > 24*time.Hour
+}
+
+// 📌 Handle /history/{nip}[?bank=] API endpoint, returning the tenant's status timelines of a NIP
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	tenant := tenantFromRequest(r)
+	if tenant == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "The status history requires an API key, set API_KEYS"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Use GET"})
+		return
+	}
+
+	nip := r.PathValue("nip")
+	bank, filtered := r.URL.Query().Get("bank"), r.URL.Query().Has("bank")
+	watchlistMu.Lock()
+	histories := []StatusHistory{}
+	for _, history := range statusHistory {
+		if history.Tenant == tenant && history.NIP == nip && (!filtered || history.Bank == bank) {
+			copied := *history
+			copied.Periods = append([]StatusPeriod(nil), history.Periods...)
+			histories = append(histories, copied)
+		}
+	}
+	watchlistMu.Unlock()
+
+	if len(histories) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "No history, add the NIP with /verify?watch=true"})
+		return
+	}
+	sort.Slice(histories, func(i, j int) bool { return histories[i].Bank < histories[j].Bank })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(histories)
+}
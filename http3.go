@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+var (
+	// Certificate and key in PEM, serve HTTPS (HTTP/1.1 and HTTP/2) on LISTEN_ADDR when set
+	tlsCertFile = getEnv("TLS_CERT_FILE", "")
+	tlsKeyFile  = getEnv("TLS_KEY_FILE", "")
+	// UDP address of the HTTP/3 (QUIC) listener, e.g. :8443, needs TLS_CERT_FILE
+	http3Addr = getEnv("HTTP3_ADDR", "")
+)
+
+// 📌 Serve HTTP/3 on HTTP3_ADDR and advertise it through Alt-Svc on the HTTPS (HTTP/1.1 and HTTP/2) responses
+func startHTTP3(handler http.Handler) (http.Handler, error) {
+	certificate, err := loadCertificate(tlsCertFile, tlsKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS_CERT_FILE and TLS_KEY_FILE: %w", err)
+	}
+	// Bound before serving so a taken port fails the startup, not a goroutine
+	conn, err := net.ListenPacket("udp", http3Addr)
+	if err != nil {
+		return nil, err
+	}
+	server := &http3.Server{
+		Handler:   handler,
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{GetCertificate: certificate.GetCertificate}),
+	}
+	go func() {
+		log.Fatalf("[ERROR] HTTP/3 listener on %s stopped: %v", http3Addr, server.Serve(conn))
+	}()
+
+	altSvc := fmt.Sprintf(`h3=":%d"; ma=86400`, conn.LocalAddr().(*net.UDPAddr).Port)
+	log.Printf("[INFO] HTTP/3 running at %s", conn.LocalAddr())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only HTTPS origins may be upgraded, a =plain listener of LISTEN_ADDR does not advertise it
+		if r.ProtoMajor < 3 && r.TLS != nil {
+			w.Header().Set("Alt-Svc", altSvc)
+		}
+		handler.ServeHTTP(w, r)
+	}), nil
+}
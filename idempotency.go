@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Largest request body remembered for an Idempotency-Key, above every handler's own limit
+const idempotencyMaxBody = 64 << 20
+
+var (
+	// How long a response is replayed for a repeated Idempotency-Key
+	idempotencyTTL = getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour)
+	// Keys and response bytes remembered per tenant, its oldest responses make room for new ones
+	idempotencyMaxKeys  = getEnvInt("IDEMPOTENCY_MAX_KEYS", 1000)
+	idempotencyMaxBytes = getEnvInt("IDEMPOTENCY_MAX_BYTES", 64<<20)
+
+	// Remembered responses by tenant, then by path and key
+	idempotencyTenants = make(map[string]*idempotencyTenant)
+	idempotencyMu      sync.Mutex
+)
+
+// Responses remembered for one tenant and the bytes of their bodies
+type idempotencyTenant struct {
+	responses map[string]*idempotentResponse
+	bytes     int
+}
+
+// Response stored for an Idempotency-Key, body is empty until the first request finishes
+type idempotentResponse struct {
+	fingerprint [32]byte
+	done        bool
+	status      int
+	header      http.Header
+	body        []byte
+	expires     time.Time
+}
+
+// Passes a response through while keeping a copy for replays
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// Keeps streamed batch results flowing to the client
+func (w *recordingWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// 📌 Replay the response of an earlier POST with the same Idempotency-Key instead of running it again
+//
+// Keys are scoped to the tenant and path. A retry with a different body gets
+// 422, one arriving while the first is still running gets 409. Server errors
+// are not remembered, so the retry runs again.
+func idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || r.Method != http.MethodPost || idempotencyTTL <= 0 {
+			next(w, r)
+			return
+		}
+		if len(key) > 255 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Idempotency-Key must not exceed 255 characters"})
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, idempotencyMaxBody))
+		if err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Request body too large"})
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		fingerprint := sha256.Sum256(body)
+		tenantName := tenantFromRequest(r)
+		scope := r.URL.Path + "\x00" + key
+
+		idempotencyMu.Lock()
+		tenant := idempotencyTenants[tenantName]
+		if tenant == nil {
+			tenant = &idempotencyTenant{responses: make(map[string]*idempotentResponse)}
+			idempotencyTenants[tenantName] = tenant
+		}
+		if entry, ok := tenant.responses[scope]; ok && entry.done && time.Now().After(entry.expires) {
+			tenant.forget(scope)
+		}
+		if entry, ok := tenant.responses[scope]; ok {
+			idempotencyMu.Unlock()
+			switch {
+			case entry.fingerprint != fingerprint:
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Idempotency-Key was already used with a different request body"})
+			case !entry.done:
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "A request with this Idempotency-Key is still in progress"})
+			default:
+				for name, values := range entry.header {
+					w.Header()[name] = values
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(entry.status)
+				w.Write(entry.body)
+			}
+			return
+		}
+		if len(tenant.responses) >= idempotencyMaxKeys && !tenant.evictOldest() {
+			// Every remembered key of the tenant is still running, this request is not remembered
+			idempotencyMu.Unlock()
+			next(w, r)
+			return
+		}
+		entry := &idempotentResponse{fingerprint: fingerprint}
+		tenant.responses[scope] = entry
+		idempotencyMu.Unlock()
+
+		recorder := &recordingWriter{ResponseWriter: w}
+		completed := false
+		defer func() {
+			idempotencyMu.Lock()
+			defer idempotencyMu.Unlock()
+			size := recorder.body.Len()
+			if !completed || recorder.status >= http.StatusInternalServerError || size > idempotencyMaxBytes {
+				tenant.forget(scope)
+				return
+			}
+			for tenant.bytes+size > idempotencyMaxBytes {
+				tenant.evictOldest()
+			}
+			tenant.bytes += size
+			entry.done = true
+			entry.status = recorder.status
+			entry.header = w.Header().Clone()
+			entry.body = recorder.body.Bytes()
+			entry.expires = time.Now().Add(idempotencyTTL)
+		}()
+		next(recorder, r)
+		completed = true
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+	}
+}
+
+// 📌 Drop a remembered response, the caller holds idempotencyMu
+func (t *idempotencyTenant) forget(scope string) {
+	if entry, ok := t.responses[scope]; ok {
+		t.bytes -= len(entry.body)
+		delete(t.responses, scope)
+	}
+}
+
+// 📌 Drop the completed response closest to expiry, false if none is completed; the caller holds idempotencyMu
+func (t *idempotencyTenant) evictOldest() bool {
+	oldest := ""
+	for scope, entry := range t.responses {
+		if entry.done && (oldest == "" || entry.expires.Before(t.responses[oldest].expires)) {
+			oldest = scope
+		}
+	}
+	if oldest == "" {
+		return false
+	}
+	t.forget(oldest)
+	return true
+}
+
+// 📌 Drop expired responses every minute instead of on every request
+func runIdempotencySweep() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		idempotencyMu.Lock()
+		now := time.Now()
+		for name, tenant := range idempotencyTenants {
+			for scope, entry := range tenant.responses {
+				if entry.done && now.After(entry.expires) {
+					tenant.forget(scope)
+				}
+			}
+			if len(tenant.responses) == 0 {
+				delete(idempotencyTenants, name)
+			}
+		}
+		idempotencyMu.Unlock()
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+var (
+	// Attempts per update before a corrupted download is given up on
+	downloadAttempts = getEnvInt("DOWNLOAD_ATTEMPTS", 3)
+	// Size bounds of a downloaded archive, 0 disables the upper bound
+	archiveMinSize = int64(getEnvInt("ARCHIVE_MIN_SIZE", 100))
+	archiveMaxSize = int64(getEnvInt("ARCHIVE_MAX_SIZE", 0))
+)
+
+// 📌 Download an archive and verify it, downloading again while it is corrupted
+func downloadVerified(download func() (string, error)) (string, error) {
+	attempts := max(downloadAttempts, 1)
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		var file string
+		file, err = download()
+		if err != nil {
+			return "", err
+		}
+		if err = verifyArchive(file); err == nil {
+			return file, nil
+		}
+
+		// Never let a later attempt resume from the corrupted file
+		_ = os.Remove(file)
+		log.Printf("[WARNING] Archive %s is corrupted (attempt %d/%d): %v", filepath.Base(file), attempt, attempts, err)
+	}
+	log.Printf("[ERROR] Giving up after %d corrupted downloads", attempts)
+	return "", fmt.Errorf("archive corrupted: %w", err)
+}
+
+// 📌 Check the size bounds and integrity of an archive before extraction
+func verifyArchive(file string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	if info.Size() < archiveMinSize {
+		return fmt.Errorf("size %d bytes is below ARCHIVE_MIN_SIZE (%d)", info.Size(), archiveMinSize)
+	}
+	if archiveMaxSize > 0 && info.Size() > archiveMaxSize {
+		return fmt.Errorf("size %d bytes exceeds ARCHIVE_MAX_SIZE (%d)", info.Size(), archiveMaxSize)
+	}
+
+	format, err := detectArchiveFormat(file)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "7z":
+		archive, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		return runSevenZip(filepath.Dir(archive), "t", archive)
+	case "zip":
+		return testZip(file)
+	case "gzip":
+		return testGzip(file)
+	default:
+		return testJSONEnd(file, info.Size())
+	}
+}
+
+// 📌 Read every entry of a `.zip` archive, which checks their CRC-32
+func testZip(file string) error {
+	archive, err := zip.OpenReader(file)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	for _, entry := range archive.File {
+		content, err := entry.Open()
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name, err)
+		}
+		_, err = io.Copy(io.Discard, content)
+		content.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name, err)
+		}
+	}
+	return nil
+}
+
+// 📌 Decompress a `.gz` file to the end, which checks its CRC-32 and length
+func testGzip(file string) error {
+	input, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	decompressed, err := gzip.NewReader(input)
+	if err != nil {
+		return err
+	}
+	defer decompressed.Close()
+	_, err = io.Copy(io.Discard, decompressed)
+	return err
+}
+
+// 📌 Plain JSON is parsed later, only make sure the file was not cut off
+func testJSONEnd(file string, size int64) error {
+	input, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	tail := make([]byte, min(size, 64))
+	if _, err := input.ReadAt(tail, size-int64(len(tail))); err != nil {
+		return err
+	}
+	if !bytes.HasSuffix(bytes.TrimRight(tail, " \t\r\n"), []byte("}")) {
+		return errors.New("JSON file is truncated")
+	}
+	return nil
+}
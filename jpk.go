@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Largest accepted JPK_V7 file, purchase records are streamed
+const jpkMaxBytes = 256 << 20
+
+// Single purchase record of the JPK_V7 register, only the supplier fields
+type jpkPurchase struct {
+	Country  string `xml:"KodKrajuNadaniaTIN"`
+	NIP      string `xml:"NrDostawcy"`
+	Name     string `xml:"NazwaDostawcy"`
+	Document string `xml:"DowodZakupu"`
+}
+
+// Supplier found in the purchase register with its whitelist result
+type JPKCounterparty struct {
+	NIP       string   `json:"nip"`
+	Name      string   `json:"name,omitempty"`
+	Documents []string `json:"documents"`
+	Response
+}
+
+// Contractor scan of a JPK_V7M/V7K file, Exceptions lists every supplier that is not ACTIVE
+type JPKReport struct {
+	Response       string            `json:"response"`
+	Schema         string            `json:"schema,omitempty"`
+	Year           string            `json:"year,omitempty"`
+	Month          string            `json:"month,omitempty"`
+	Quarter        string            `json:"quarter,omitempty"`
+	Purchases      int               `json:"purchases"`
+	Counterparties int               `json:"counterparties"`
+	Summary        map[string]int    `json:"summary"`
+	Exceptions     []JPKCounterparty `json:"exceptions"`
+}
+
+// 📌 Normalize a supplier number from the register, returns "" for foreign or missing ones
+func jpkSupplierNIP(purchase jpkPurchase) string {
+	if country := strings.ToUpper(strings.TrimSpace(purchase.Country)); country != "" && country != "PL" {
+		return ""
+	}
+	nip := strings.NewReplacer(" ", "", "-", "").Replace(strings.ToUpper(strings.TrimSpace(purchase.NIP)))
+	nip = strings.TrimPrefix(nip, "PL")
+	if nip == "BRAK" {
+		return ""
+	}
+	return nip
+}
+
+// 📌 Read the header and every purchase record of a JPK_V7 file
+func parseJPK(r io.Reader, report *JPKReport, purchase func(jpkPurchase)) error {
+	decoder := xml.NewDecoder(r)
+	root := true
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if root {
+			if start.Name.Local != "JPK" {
+				return errors.New("expected element type <JPK> but have <" + start.Name.Local + ">")
+			}
+			root = false
+			continue
+		}
+
+		switch start.Name.Local {
+		case "KodFormularza":
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "kodSystemowy" {
+					report.Schema = attr.Value
+				}
+			}
+		case "Rok", "Miesiac", "Kwartal":
+			var value string
+			if err := decoder.DecodeElement(&value, &start); err != nil {
+				return err
+			}
+			switch start.Name.Local {
+			case "Rok":
+				report.Year = strings.TrimSpace(value)
+			case "Miesiac":
+				report.Month = strings.TrimSpace(value)
+			default:
+				report.Quarter = strings.TrimSpace(value)
+			}
+		case "ZakupWiersz":
+			var record jpkPurchase
+			if err := decoder.DecodeElement(&record, &start); err != nil {
+				return err
+			}
+			purchase(record)
+		}
+	}
+}
+
+// 📌 Handle /verify/jpk API endpoint, scanning suppliers of a JPK_V7M/V7K purchase register
+func jpkHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Use POST"})
+		return
+	}
+
+	report := JPKReport{Response: "OK", Summary: map[string]int{}, Exceptions: []JPKCounterparty{}}
+	suppliers := map[string]*JPKCounterparty{}
+	var order []string
+	err := parseJPK(http.MaxBytesReader(w, r.Body, jpkMaxBytes), &report, func(purchase jpkPurchase) {
+		report.Purchases++
+		nip := jpkSupplierNIP(purchase)
+		if nip == "" {
+			report.Summary["FOREIGN_OR_MISSING"]++
+			return
+		}
+		supplier, ok := suppliers[nip]
+		if !ok {
+			supplier = &JPKCounterparty{NIP: nip, Name: strings.TrimSpace(purchase.Name), Documents: []string{}}
+			suppliers[nip] = supplier
+			order = append(order, nip)
+		}
+		supplier.Documents = append(supplier.Documents, strings.TrimSpace(purchase.Document))
+	})
+	if err != nil {
+		recordError("invalid_jpk")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Invalid JPK_V7 XML: " + err.Error()})
+		return
+	}
+
+	problem := datasetProblem()
+	if problem != "" {
+		if status, result := unavailableResponse(problem); status != http.StatusOK {
+			recordError("dataset_unavailable")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(result)
+			return
+		}
+	}
+
+	tenant := tenantFromRequest(r)
+	var valid []BatchItem
+	for _, nip := range order {
+		supplier := suppliers[nip]
+		if category, fields := validateInput(nip, ""); category != "" {
+			recordError(category)
+			supplier.Response = validationResponse(fields)
+			continue
+		}
+		if problem != "" {
+			_, supplier.Response = unavailableResponse(problem)
+			continue
+		}
+		valid = append(valid, BatchItem{NIP: nip})
+	}
+	verifyBatch(valid, func(indexes []int, result Response) {
+		// One distinct NIP per item, so every supplier is written by one worker only
+		for _, index := range indexes {
+			suppliers[valid[index].NIP].Response = result
+		}
+	})
+
+	report.Counterparties = len(order)
+	for _, nip := range order {
+		supplier := suppliers[nip]
+		status := supplier.Status
+		if supplier.Response.Response == "ERROR" {
+			status = "INVALID"
+		} else {
+			recordRequest(nip, "", supplier.Response)
+			recordUsage(tenant, status)
+			recordStats(supplier.Response, false)
+		}
+		report.Summary[status]++
+		if status != "ACTIVE" {
+			report.Exceptions = append(report.Exceptions, *supplier)
+		}
+	}
+	sort.SliceStable(report.Exceptions, func(i, j int) bool {
+		return report.Exceptions[i].Status < report.Exceptions[j].Status
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"strings"
+)
+
+// Largest accepted KSeF invoice XML
+const ksefMaxBytes = 10 << 20
+
+// Fields of a KSeF structured invoice (FA(2)/FA(3)) needed for verification, namespaces are ignored
+type ksefInvoice struct {
+	XMLName xml.Name `xml:"Faktura"`
+	Header  struct {
+		// "FA (2)" or "FA (3)"
+		Form struct {
+			Code string `xml:"kodSystemowy,attr"`
+		} `xml:"KodFormularza"`
+	} `xml:"Naglowek"`
+	SellerNIP      string   `xml:"Podmiot1>DaneIdentyfikacyjne>NIP"`
+	IssueDate      string   `xml:"Fa>P_1"`
+	InvoiceNumber  string   `xml:"Fa>P_2"`
+	Accounts       []string `xml:"Fa>Platnosc>RachunekBankowy>NrRB"`
+	FactorAccounts []string `xml:"Fa>Platnosc>RachunekBankowyFaktora>NrRB"`
+}
+
+// Whitelist result of a single bank account found on an invoice
+type KSeFAccount struct {
+	Account string `json:"account"`
+	Factor  bool   `json:"factor,omitempty"`
+	Response
+}
+
+// Consolidated verdict for a KSeF invoice: PASS when the seller is registered and every account matched
+type KSeFVerification struct {
+	Response      string        `json:"response"`
+	Verdict       string        `json:"verdict"`
+	Schema        string        `json:"schema,omitempty"`
+	InvoiceNumber string        `json:"invoiceNumber,omitempty"`
+	IssueDate     string        `json:"issueDate,omitempty"`
+	SellerNIP     string        `json:"sellerNip"`
+	Seller        Response      `json:"seller"`
+	Accounts      []KSeFAccount `json:"accounts"`
+	Message       string        `json:"message,omitempty"`
+}
+
+// 📌 Normalize an invoice account number to a 26-digit NRB (drops spaces, dashes and the PL prefix)
+func normalizeAccount(value string) string {
+	value = strings.NewReplacer(" ", "", "-", "", "\u00a0", "").Replace(strings.TrimSpace(value))
+	if len(value) == 28 && strings.EqualFold(value[:2], "PL") {
+		value = value[2:]
+	}
+	return value
+}
+
+// 📌 Verify the seller and every account of a parsed invoice
+func verifyInvoice(invoice ksefInvoice, tenant string) KSeFVerification {
+	nip := strings.TrimSpace(invoice.SellerNIP)
+	result := KSeFVerification{
+		Response:      "OK",
+		Verdict:       "PASS",
+		Schema:        strings.TrimSpace(invoice.Header.Form.Code),
+		InvoiceNumber: strings.TrimSpace(invoice.InvoiceNumber),
+		IssueDate:     strings.TrimSpace(invoice.IssueDate),
+		SellerNIP:     nip,
+		Accounts:      []KSeFAccount{},
+	}
+
+	if category, fields := validateInput(nip, ""); category != "" {
+		recordError(category)
+		result.Seller = validationResponse(fields)
+		result.Verdict = "FAIL"
+		result.Message = "Invalid seller NIP"
+		return result
+	}
+	result.Seller = verify(nip, "")
+	recordUsage(tenant, result.Seller.Status)
+	recordStats(result.Seller, false)
+	// The flat file may only hold NIP+account hashes, so a matched account also proves registration
+	registered := result.Seller.Status == "ACTIVE" || result.Seller.Status == "EXEMPT"
+
+	accounts := make([]KSeFAccount, 0, len(invoice.Accounts)+len(invoice.FactorAccounts))
+	for _, account := range invoice.Accounts {
+		accounts = append(accounts, KSeFAccount{Account: normalizeAccount(account)})
+	}
+	for _, account := range invoice.FactorAccounts {
+		accounts = append(accounts, KSeFAccount{Account: normalizeAccount(account), Factor: true})
+	}
+
+	for _, account := range accounts {
+		if category, fields := validateInput(nip, account.Account); category != "" {
+			recordError(category)
+			account.Response = validationResponse(fields)
+		} else {
+			account.Response = verify(nip, account.Account)
+			recordRequest(nip, account.Account, account.Response)
+			recordUsage(tenant, account.Response.Status)
+			recordStats(account.Response, true)
+		}
+		if account.Response.Bank == "MATCHED" {
+			registered = true
+		} else {
+			result.Verdict = "FAIL"
+		}
+		result.Accounts = append(result.Accounts, account)
+	}
+	if !registered {
+		result.Verdict = "FAIL"
+	}
+	if len(accounts) == 0 {
+		result.Message = "Invoice contains no bank account"
+	}
+	return result
+}
+
+// 📌 Handle /verify/ksef API endpoint, verifying the seller of a KSeF invoice XML
+func ksefHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Use POST"})
+		return
+	}
+
+	var invoice ksefInvoice
+	if err := xml.NewDecoder(http.MaxBytesReader(w, r.Body, ksefMaxBytes)).Decode(&invoice); err != nil {
+		recordError("invalid_invoice")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Invalid KSeF invoice XML: " + err.Error()})
+		return
+	}
+
+	if problem := datasetProblem(); problem != "" {
+		status, result := unavailableResponse(problem)
+		if status != http.StatusOK {
+			recordError("dataset_unavailable")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(result)
+			return
+		}
+		json.NewEncoder(w).Encode(KSeFVerification{
+			Response:  "OK",
+			Verdict:   "UNVERIFIED",
+			SellerNIP: strings.TrimSpace(invoice.SellerNIP),
+			Seller:    result,
+			Accounts:  []KSeFAccount{},
+			Message:   result.Message,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(verifyInvoice(invoice, tenantFromRequest(r)))
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Annotation of the Lease holding the leader's advertised URL
+	leaseURLAnnotation = "pl-vatbank-checker/peer-url"
+	// How often followers ask the leader for a newer snapshot
+	followerPollInterval = time.Minute
+	// In-cluster service account files
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+var (
+	// Elect one replica through a Kubernetes Lease to download the dataset, the others copy its /snapshot
+	leaderElection = getEnvBool("LEADER_ELECTION", false)
+	leaseName      = getEnv("LEASE_NAME", "pl-vatbank-checker")
+	leaseNamespace = getEnv("LEASE_NAMESPACE", readServiceAccountFile("namespace"))
+	leaseDuration  = getEnvDuration("LEASE_DURATION", 15*time.Second)
+	// Identity written to the Lease, the pod name in Kubernetes
+	leaderIdentity = getEnv("POD_NAME", hostname())
+	// Base URL under which the other replicas reach this one, e.g. http://$(POD_IP):8080
+	leaderURL = strings.TrimSuffix(getEnv("LEADER_URL", ""), "/")
+
+	leaderMu      sync.Mutex
+	isLeader      bool
+	currentLeader string
+
+	kubeClient *http.Client
+)
+
+// Fields of a coordination.k8s.io/v1 Lease used for the election
+type lease struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name            string            `json:"name"`
+		Namespace       string            `json:"namespace"`
+		ResourceVersion string            `json:"resourceVersion,omitempty"`
+		Labels          map[string]string `json:"labels,omitempty"`
+		Annotations     map[string]string `json:"annotations,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		HolderIdentity       string `json:"holderIdentity,omitempty"`
+		LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+		AcquireTime          string `json:"acquireTime,omitempty"`
+		RenewTime            string `json:"renewTime,omitempty"`
+		LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+	} `json:"spec"`
+}
+
+// 📌 Read a file of the mounted service account, empty outside Kubernetes
+func readServiceAccountFile(name string) string {
+	content, _ := os.ReadFile(serviceAccountDir + "/" + name)
+	return strings.TrimSpace(string(content))
+}
+
+// 📌 Host name of the machine, the default leader identity
+func hostname() string {
+	name, _ := os.Hostname()
+	return name
+}
+
+// 📌 Report whether this replica holds the lease and the URL of the current leader
+func leadership() (bool, string) {
+	leaderMu.Lock()
+	defer leaderMu.Unlock()
+	return isLeader, currentLeader
+}
+
+// 📌 Build the API client trusting the cluster CA
+func newKubeClient() (*http.Client, error) {
+	pool := x509.NewCertPool()
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("no certificate in ca.crt")
+	}
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}, nil
+}
+
+// 📌 Send a request to the Lease API, returning the HTTP status
+func leaseRequest(method, path string, body *lease, target *lease) (int, error) {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return 0, err
+		}
+	}
+	host := net.JoinHostPort(os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT"))
+	req, err := http.NewRequest(method, "https://"+host+"/apis/coordination.k8s.io/v1/namespaces/"+leaseNamespace+"/leases"+path, &payload)
+	if err != nil {
+		return 0, err
+	}
+	// The projected token is rotated by the kubelet, read it for every request
+	req.Header.Set("Authorization", "Bearer "+readServiceAccountFile("token"))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := kubeClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
+		if target != nil {
+			return resp.StatusCode, json.NewDecoder(resp.Body).Decode(target)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// 📌 Try to acquire or renew the lease once, returning whether this replica leads
+func tryAcquireLease(now time.Time) (bool, string, error) {
+	stamp := now.UTC().Format("2006-01-02T15:04:05.000000Z07:00")
+
+	var current lease
+	status, err := leaseRequest(http.MethodGet, "/"+leaseName, nil, &current)
+	if err != nil {
+		return false, "", err
+	}
+	if status == http.StatusNotFound {
+		created := lease{APIVersion: "coordination.k8s.io/v1", Kind: "Lease"}
+		created.Metadata.Name, created.Metadata.Namespace = leaseName, leaseNamespace
+		created.Metadata.Annotations = map[string]string{leaseURLAnnotation: leaderURL}
+		created.Spec.HolderIdentity = leaderIdentity
+		created.Spec.LeaseDurationSeconds = int(leaseDuration.Seconds())
+		created.Spec.AcquireTime, created.Spec.RenewTime = stamp, stamp
+		status, err = leaseRequest(http.MethodPost, "", &created, nil)
+		if err != nil {
+			return false, "", err
+		}
+		if status != http.StatusCreated {
+			// Conflict: another replica created it first, its URL is read in the next round
+			return false, "", nil
+		}
+		return true, leaderURL, nil
+	}
+	if status != http.StatusOK {
+		return false, "", fmt.Errorf("reading lease returned %d", status)
+	}
+
+	holderURL := current.Metadata.Annotations[leaseURLAnnotation]
+	renewed, _ := time.Parse(time.RFC3339Nano, current.Spec.RenewTime)
+	expired := now.After(renewed.Add(time.Duration(current.Spec.LeaseDurationSeconds) * time.Second))
+	if current.Spec.HolderIdentity != leaderIdentity && !expired && current.Spec.HolderIdentity != "" {
+		return false, holderURL, nil
+	}
+
+	// Take over an expired lease or renew our own, resourceVersion makes a race lose with 409
+	if current.Spec.HolderIdentity != leaderIdentity {
+		current.Spec.HolderIdentity = leaderIdentity
+		current.Spec.AcquireTime = stamp
+		current.Spec.LeaseTransitions++
+	}
+	if current.Metadata.Annotations == nil {
+		current.Metadata.Annotations = make(map[string]string)
+	}
+	current.Metadata.Annotations[leaseURLAnnotation] = leaderURL
+	current.Spec.LeaseDurationSeconds = int(leaseDuration.Seconds())
+	current.Spec.RenewTime = stamp
+	status, err = leaseRequest(http.MethodPut, "/"+leaseName, &current, nil)
+	if err != nil {
+		return false, "", err
+	}
+	if status != http.StatusOK {
+		// Another replica changed the lease first, the winner is read in the next round
+		return false, "", nil
+	}
+	return true, leaderURL, nil
+}
+
+// 📌 Run one election round and record the outcome
+func electLeader() {
+	leading, url, err := tryAcquireLease(time.Now())
+	if err != nil {
+		// Without a renewal we cannot be sure we still lead
+		log.Printf("[WARNING] Leader election failed: %v", err)
+		leading = false
+	}
+
+	leaderMu.Lock()
+	defer leaderMu.Unlock()
+	if leading != isLeader {
+		if leading {
+			log.Printf("[INFO] Became the updater leader (%s)", leaderIdentity)
+		} else {
+			log.Printf("[WARNING] No longer the updater leader")
+		}
+	}
+	isLeader = leading
+	if err == nil {
+		currentLeader = url
+	}
+}
+
+// 📌 Join the election before the first update, then keep renewing; a leader that stops renewing is replaced after LEASE_DURATION
+func startLeaderElection() error {
+	client, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	kubeClient = client
+
+	electLeader()
+	go func() {
+		ticker := time.NewTicker(leaseDuration / 3)
+		defer ticker.Stop()
+		for range ticker.C {
+			electLeader()
+		}
+	}()
+	return nil
+}
+
+// 📌 Check whether this replica copies the dataset from an elected leader
+func following() bool {
+	leading, _ := leadership()
+	return leaderElection && !leading
+}
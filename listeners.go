@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How often the files of a served certificate are checked for a renewed one
+const certificateCheckInterval = time.Minute
+
+// One address of LISTEN_ADDR and the certificate it serves, plain HTTP without one
+type listener struct {
+	address  string
+	certFile string
+	keyFile  string
+}
+
+// Certificate of a listener, loaded again when its files change (a renewal or a rotated secret mount)
+type reloadingCertificate struct {
+	certFile    string
+	keyFile     string
+	certificate *tls.Certificate
+	modified    time.Time
+	checked     time.Time
+	mu          sync.Mutex
+}
+
+// 📌 Load a certificate and key in PEM for serving, failing when they are unreadable
+func loadCertificate(certFile string, keyFile string) (*reloadingCertificate, error) {
+	certificate := &reloadingCertificate{certFile: certFile, keyFile: keyFile, checked: time.Now()}
+	if err := certificate.reload(); err != nil {
+		return nil, err
+	}
+	return certificate, nil
+}
+
+// 📌 Load the pair again when either file changed since the last load, the caller holds mu or owns the value
+func (c *reloadingCertificate) reload() error {
+	var modified time.Time
+	for _, path := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+	}
+	if c.certificate != nil && modified.Equal(c.modified) {
+		return nil
+	}
+	certificate, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	if c.certificate != nil {
+		log.Printf("[INFO] Reloaded certificate %s", c.certFile)
+	}
+	c.certificate, c.modified = &certificate, modified
+	return nil
+}
+
+// 📌 Serve the current pair, looking for a renewed one at most every certificateCheckInterval
+func (c *reloadingCertificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.checked) >= certificateCheckInterval {
+		c.checked = time.Now()
+		if err := c.reload(); err != nil {
+			log.Printf("[WARNING] Reloading certificate %s failed, serving the current one: %v", c.certFile, err)
+		}
+	}
+	return c.certificate, nil
+}
+
+// 📌 Parse LISTEN_ADDR: comma-separated addresses, each optionally followed by =cert.pem|key.pem or =plain
+func parseListeners(value string) ([]listener, error) {
+	var listeners []listener
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		address, tlsFiles, hasTLS := strings.Cut(entry, "=")
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return nil, err
+		}
+		item := listener{address: address, certFile: tlsCertFile, keyFile: tlsKeyFile}
+		switch {
+		case tlsFiles == "plain":
+			item.certFile, item.keyFile = "", ""
+		case hasTLS:
+			var ok bool
+			if item.certFile, item.keyFile, ok = strings.Cut(tlsFiles, "|"); !ok || item.certFile == "" || item.keyFile == "" {
+				return nil, fmt.Errorf("TLS of %s must be cert.pem|key.pem or plain", address)
+			}
+		}
+		listeners = append(listeners, item)
+	}
+	if len(listeners) == 0 {
+		return nil, fmt.Errorf("no address given")
+	}
+	return listeners, nil
+}
+
+// 📌 Bind every listener, then serve them all until one fails
+func serveListeners(listeners []listener, handler http.Handler) error {
+	type bound struct {
+		net.Listener
+		server *http.Server
+		tls    bool
+	}
+	var servers []bound
+	for _, item := range listeners {
+		server := &http.Server{Handler: handler}
+		if item.certFile != "" {
+			certificate, err := loadCertificate(item.certFile, item.keyFile)
+			if err != nil {
+				return fmt.Errorf("loading the certificate of %s: %w", item.address, err)
+			}
+			server.TLSConfig = &tls.Config{GetCertificate: certificate.GetCertificate}
+		}
+		// IP literals bind their own family; the IPv6 wildcard stays dual-stack like an empty host
+		network := "tcp"
+		host, _, _ := net.SplitHostPort(item.address)
+		if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+			network = "tcp4"
+		} else if ip != nil && !ip.IsUnspecified() {
+			network = "tcp6"
+		}
+		ln, err := net.Listen(network, item.address)
+		if err != nil {
+			return err
+		}
+		servers = append(servers, bound{Listener: ln, server: server, tls: server.TLSConfig != nil})
+	}
+
+	failed := make(chan error, len(servers))
+	for _, item := range servers {
+		if item.tls {
+			log.Printf("[INFO] Server running at %s (HTTPS)", item.Addr())
+			go func() { failed <- item.server.ServeTLS(item.Listener, "", "") }()
+			continue
+		}
+		log.Printf("[INFO] Server running at %s", item.Addr())
+		go func() { failed <- item.server.Serve(item.Listener) }()
+	}
+	return <-failed
+}
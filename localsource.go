@@ -0,0 +1,131 @@
+package main
+
+import (
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+var (
+	// File, directory or file:// URL used by the "file" data source
+	dataPath      = getEnv("DATA_PATH", "")
+	watchInterval = getEnvDuration("WATCH_INTERVAL", time.Minute)
+
+	// Files picked up from watched directories
+	dataFileExtensions = map[string]bool{".7z": true, ".zip": true, ".gz": true, ".json": true}
+)
+
+// 📌 Resolve a configured path, accepting plain paths and file:// URLs
+func resolvePath(value string) (string, error) {
+	if !strings.HasPrefix(value, "file://") {
+		return filepath.Clean(value), nil
+	}
+
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return "", err
+	}
+	path := parsed.Path
+	// file:///C:/data/20250101.7z
+	if runtime.GOOS == "windows" && len(path) > 2 && path[0] == '/' && path[2] == ':' {
+		path = path[1:]
+	}
+	return filepath.FromSlash(path), nil
+}
+
+// 📌 Find the most recently modified flat file in a directory
+func newestDataFile(dir string) (string, time.Time, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	var newest string
+	var newestTime time.Time
+	for _, entry := range entries {
+		if entry.IsDir() || !dataFileExtensions[filepath.Ext(entry.Name())] {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if newest == "" || info.ModTime().After(newestTime) {
+			newest, newestTime = filepath.Join(dir, entry.Name()), info.ModTime()
+		}
+	}
+	return newest, newestTime, nil
+}
+
+// 📌 Prepare a local flat file (.json or an archive) for loading
+func fetchFromFile(path string) (string, func(), error) {
+	if filepath.Ext(path) == ".json" {
+		// Never delete files provided by the operator
+		if _, err := os.Stat(path); err != nil {
+			return "", nil, err
+		}
+		return path, func() {}, nil
+	}
+
+	return extractFile(path)
+}
+
+// 📌 Extract (if needed) and load a local flat file
+func loadLocalFile(path string) error {
+	jsonFile, cleanup, err := fetchFromFile(path)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	return loadData(jsonFile)
+}
+
+// 📌 Load the dataset from DATA_PATH (a file once, or a watched directory)
+func updateFromLocal() {
+	path, err := resolvePath(dataPath)
+	if err != nil {
+		log.Printf("[ERROR] Invalid DATA_PATH %s: %v", dataPath, err)
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Printf("[ERROR] DATA_PATH not accessible: %v", err)
+		return
+	}
+
+	if !info.IsDir() {
+		log.Printf("[INFO] Loading local flat file %s", path)
+		if err := loadLocalFile(path); err != nil {
+			log.Printf("[ERROR] Loading local flat file failed: %v", err)
+			return
+		}
+		log.Printf("[INFO] Data update completed successfully.")
+		return
+	}
+
+	log.Printf("[INFO] Watching %s for new flat files every %s", path, watchInterval)
+	var loadedFile string
+	var loadedTime time.Time
+	for {
+		file, modTime, err := newestDataFile(path)
+		switch {
+		case err != nil:
+			log.Printf("[ERROR] Scanning %s failed: %v", path, err)
+		case file != "" && (file != loadedFile || modTime.After(loadedTime)):
+			log.Printf("[INFO] New flat file detected: %s", file)
+			if err := loadLocalFile(file); err != nil {
+				log.Printf("[ERROR] Loading %s failed: %v", file, err)
+			} else {
+				log.Printf("[INFO] Data update completed successfully.")
+			}
+			// Do not retry a broken file until it changes again
+			loadedFile, loadedTime = file, modTime
+		}
+		time.Sleep(watchInterval)
+	}
+}
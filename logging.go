@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Native protocol socket of systemd-journald
+	journaldSocket = "/run/systemd/journal/socket"
+	// Log lines waiting for the receiver, further lines go to stderr while the queue is full
+	logQueueSize = 1000
+	// Longest wait for a connect or a send to the receiver
+	logSendTimeout = 5 * time.Second
+	// Longest pause between reconnects while the receiver is unreachable
+	logMaxBackoff = time.Minute
+	// How long an [ERROR] line waits for delivery, so log.Fatalf lines are sent before the exit
+	logErrorWait = time.Second
+)
+
+var (
+	// Where logs go: "stderr", "syslog" (RFC 5424) or "journald"
+	logOutput = getEnv("LOG_OUTPUT", "stderr")
+	// Syslog receiver: unix:///dev/log, udp://host:514 or tcp://host:601
+	syslogAddress  = getEnv("SYSLOG_ADDRESS", "unix:///dev/log")
+	syslogFacility = getEnv("SYSLOG_FACILITY", "daemon")
+	// APP-NAME (syslog) and SYSLOG_IDENTIFIER (journald) of the messages
+	logTag = getEnv("LOG_TAG", "pl-vatbank-checker")
+
+	// Writer of LOG_OUTPUT=syslog/journald, nil with stderr
+	systemLog *systemLogWriter
+)
+
+// Syslog facility codes by name
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// Sends every log line as a syslog or journald message, falling back to stderr while the receiver is unreachable
+//
+// Write only queues the line, a single goroutine sends it, so a slow or
+// unreachable receiver never blocks the goroutine that logs.
+type systemLogWriter struct {
+	network  string
+	address  string
+	facility int
+	format   func(priority int, message string) []byte
+	queue    chan queuedLog
+
+	// Only used by the sending goroutine after setup
+	conn    net.Conn
+	backoff time.Duration
+	retryAt time.Time
+}
+
+// Single log line waiting to be sent
+type queuedLog struct {
+	message string
+	at      time.Time
+	payload []byte
+	// Closed once the line was sent or written to stderr, only set for [ERROR] lines
+	done chan struct{}
+}
+
+// 📌 Severity of a log line from its [ERROR], [WARNING] or [INFO] prefix
+func logPriority(message string) int {
+	switch {
+	case strings.HasPrefix(message, "[ERROR]"):
+		return 3
+	case strings.HasPrefix(message, "[WARNING]"):
+		return 4
+	case strings.HasPrefix(message, "[INFO]"):
+		return 6
+	}
+	return 5
+}
+
+// 📌 Send logs to syslog or journald according to LOG_OUTPUT
+func configureLogging() error {
+	if logOutput == "stderr" {
+		return nil
+	}
+	facility, ok := syslogFacilities[strings.ToLower(syslogFacility)]
+	if !ok {
+		return fmt.Errorf("unknown SYSLOG_FACILITY %q", syslogFacility)
+	}
+	writer := &systemLogWriter{facility: facility, queue: make(chan queuedLog, logQueueSize)}
+	switch logOutput {
+	case "syslog":
+		network, address, ok := strings.Cut(syslogAddress, "://")
+		if !ok || (network != "unix" && network != "udp" && network != "tcp") {
+			return fmt.Errorf("invalid SYSLOG_ADDRESS %q, use unix://, udp:// or tcp://", syslogAddress)
+		}
+		if network == "unix" {
+			// /dev/log is a datagram socket
+			network = "unixgram"
+		}
+		writer.network, writer.address, writer.format = network, address, writer.rfc5424
+	case "journald":
+		writer.network, writer.address, writer.format = "unixgram", journaldSocket, writer.journald
+	default:
+		return fmt.Errorf("unknown LOG_OUTPUT %q", logOutput)
+	}
+	if err := writer.connect(); err != nil {
+		return err
+	}
+	systemLog = writer
+	go writer.run()
+	// The receiver timestamps every message
+	log.SetFlags(0)
+	log.SetOutput(writer)
+	return nil
+}
+
+// 📌 Open the connection to the log receiver, only called during setup and by the sending goroutine
+func (w *systemLogWriter) connect() error {
+	conn, err := net.DialTimeout(w.network, w.address, logSendTimeout)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+// 📌 RFC 5424 message, framed by octet counting over TCP (RFC 6587)
+func (w *systemLogWriter) rfc5424(priority int, message string) []byte {
+	host := hostname()
+	if host == "" {
+		host = "-"
+	}
+	line := fmt.Sprintf("<%d>1 %s %s %s %d - - %s", w.facility*8+priority,
+		time.Now().UTC().Format("2006-01-02T15:04:05.000000Z"), host, logTag, os.Getpid(), message)
+	if w.network == "tcp" {
+		return []byte(strconv.Itoa(len(line)) + " " + line)
+	}
+	return []byte(line)
+}
+
+// 📌 journald native protocol datagram, multi-line values use the length-prefixed form
+func (w *systemLogWriter) journald(priority int, message string) []byte {
+	var datagram bytes.Buffer
+	field := func(name, value string) {
+		if !strings.Contains(value, "\n") {
+			datagram.WriteString(name + "=" + value + "\n")
+			return
+		}
+		datagram.WriteString(name + "\n")
+		binary.Write(&datagram, binary.LittleEndian, uint64(len(value)))
+		datagram.WriteString(value + "\n")
+	}
+	field("MESSAGE", message)
+	field("PRIORITY", strconv.Itoa(priority))
+	field("SYSLOG_FACILITY", strconv.Itoa(w.facility))
+	field("SYSLOG_IDENTIFIER", logTag)
+	return datagram.Bytes()
+}
+
+func (w *systemLogWriter) Write(data []byte) (int, error) {
+	message := strings.TrimSuffix(string(data), "\n")
+	priority := logPriority(message)
+	line := queuedLog{message: message, at: time.Now(), payload: w.format(priority, message)}
+	if priority <= 3 {
+		line.done = make(chan struct{})
+	}
+
+	select {
+	case w.queue <- line:
+	default:
+		writeStderrLog(line)
+		return len(data), nil
+	}
+	if line.done != nil {
+		select {
+		case <-line.done:
+		case <-time.After(logErrorWait):
+		}
+	}
+	return len(data), nil
+}
+
+// 📌 Send queued log lines one by one, the only goroutine using the connection
+func (w *systemLogWriter) run() {
+	for line := range w.queue {
+		if line.payload != nil && !w.send(line.payload) {
+			writeStderrLog(line)
+		}
+		if line.done != nil {
+			close(line.done)
+		}
+	}
+}
+
+// 📌 Send one message, reconnecting once with a growing pause while the receiver stays unreachable
+func (w *systemLogWriter) send(payload []byte) bool {
+	if w.conn != nil {
+		w.conn.SetWriteDeadline(time.Now().Add(logSendTimeout))
+		if _, err := w.conn.Write(payload); err == nil {
+			return true
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	if time.Now().Before(w.retryAt) {
+		return false
+	}
+	// Reconnect, e.g. after the syslog daemon restarted
+	if err := w.connect(); err == nil {
+		w.conn.SetWriteDeadline(time.Now().Add(logSendTimeout))
+		if _, err := w.conn.Write(payload); err == nil {
+			w.backoff = 0
+			return true
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	w.backoff = min(max(2*w.backoff, time.Second), logMaxBackoff)
+	w.retryAt = time.Now().Add(w.backoff)
+	return false
+}
+
+// 📌 Wait until the queued log lines are sent, before the process exits
+func flushLogs() {
+	if systemLog == nil {
+		return
+	}
+	// An empty line is not sent, it only marks the end of the queue
+	marker := queuedLog{done: make(chan struct{})}
+	select {
+	case systemLog.queue <- marker:
+	case <-time.After(logErrorWait):
+		return
+	}
+	select {
+	case <-marker.done:
+	case <-time.After(logSendTimeout):
+	}
+}
+
+// 📌 Fallback for a line the receiver did not get
+func writeStderrLog(line queuedLog) {
+	fmt.Fprintf(os.Stderr, "%s %s\n", line.at.Format("2006/01/02 15:04:05"), line.message)
+}
@@ -1,14 +1,19 @@
 package main
 
 import (
-	"crypto/sha512"
-	"encoding/hex"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
@@ -16,11 +21,12 @@ import (
 	"time"
 
 	"github.com/cavaliergopher/grab/v3"
+
+	"pl-vatbank-checker/flatfile"
 )
 
 const (
-	dataURL       = "https://plikplaski.mf.gov.pl/pliki/{DATE}.7z"
-	serverAddress = ":8080"
+	dataURL = "https://plikplaski.mf.gov.pl/pliki/{DATE}.7z"
 )
 
 var (
@@ -29,7 +35,31 @@ var (
 	activeHashes map[string]bool
 	exemptHashes map[string]bool
 	masks        []string
-	mu           sync.RWMutex
+	// Content digest of the loaded dataset, the base of the /snapshot ETag
+	datasetDigest string
+	mu            sync.RWMutex
+	// Serializes dataset loads from the updater, reloads and other triggers
+	loadMu sync.Mutex
+
+	// Listen address, e.g. ":8080" or "127.0.0.1:8080" (overridden by -listen)
+	listenAddr = getEnv("LISTEN_ADDR", ":8080")
+
+	// Run mode: "serve" (verify against the dataset), "readonly" (serve published snapshots only), "serverless" (one snapshot per cold start, e.g. AWS Lambda) or "mock" (rule-based responses)
+	mode = getEnv("MODE", "serve")
+
+	// Where the dataset comes from: "mf" (Ministry of Finance), "file", "s3", "peer" or "sandbox"
+	dataSource = getEnv("DATA_SOURCE", "mf")
+
+	// Refresh period (0 refreshes on startup only) and backoff after a failed update
+	updateInterval = getEnvDuration("UPDATE_INTERVAL", 24*time.Hour)
+	retryInterval  = getEnvDuration("RETRY_INTERVAL", time.Hour)
+
+	// Persistent data lives in DATA_DIR, downloads and extraction in TMP_DIR
+	dataDir = getEnv("DATA_DIR", ".")
+	tmpDir  = getEnv("TMP_DIR", dataDir)
+
+	sevenZipPath   = getEnv("SEVENZIP_PATH", "7z")
+	extractTimeout = getEnvDuration("EXTRACT_TIMEOUT", 10*time.Minute)
 )
 
 // JSON Structure
@@ -50,13 +80,38 @@ type Response struct {
 	Bank     string `json:"bank,omitempty"`
 	Date     string `json:"date,omitempty"`
 	Message  string `json:"message,omitempty"`
+	// Offending input fields of a rejected request
+	Errors []FieldError `json:"errors,omitempty"`
+	// Reference of an internal error in the server log
+	Incident string `json:"incident,omitempty"`
+	// true for a direct or masked account match, false otherwise, null without an account (as the MF API)
+	AccountAssigned json.RawMessage `json:"accountAssigned,omitempty"`
+	// Hours since the start of the data date, with STALE_DATA warning past STALE_AFTER
+	DataAgeHours *int   `json:"dataAgeHours,omitempty"`
+	Warning      string `json:"warning,omitempty"`
+	// Payment verdict, only with ?amount=
+	Advisory *Advisory `json:"advisory,omitempty"`
+	// Client references of the request and the confirmation issued for them
+	Correlation  *Correlation `json:"correlation,omitempty"`
+	Confirmation string       `json:"confirmation,omitempty"`
+	// Checks performed, only with ?trace=true
+	Trace Trace `json:"trace,omitempty"`
+
+	// ID of the official MF API answer, only in MODE=proxy
+	RequestID string `json:"requestId,omitempty"`
+
+	// How the bank account matched: "direct", "masked" or "none"
+	match string
+	// HTTP status and Retry-After of a failed upstream lookup in MODE=proxy
+	code       int
+	retryAfter time.Duration
 }
 
 // 📌 Download the latest VAT file
 func downloadFile() (string, error) {
-	today := time.Now().Format("20060102")
-	url := strings.ReplaceAll(dataURL, "{DATE}", today)
-	fileName := today + ".7z"
+	date := today()
+	url := strings.ReplaceAll(dataURL, "{DATE}", date)
+	fileName := filepath.Join(tmpDir, date+".7z")
 
 	log.Printf("[INFO] Downloading: %s", url)
 	resp, err := grab.Get(fileName, url)
@@ -65,103 +120,205 @@ func downloadFile() (string, error) {
 		return "", err
 	}
 	log.Printf("[INFO] Downloaded: %s", resp.Filename)
+	noteMFDownload(date, resp.HTTPResponse, resp.Size())
 	return fileName, nil
 }
 
-// 📌 Extract the JSON file from the `.7z` archive
-func extractFile(file string) (string, error) {
-	log.Printf("[INFO] Extracting JSON file from %s", file)
+// 📌 Extract the JSON file from a downloaded archive (.7z, .zip, .gz or plain JSON)
+func extractFile(file string) (string, func(), error) {
+	format, err := detectArchiveFormat(file)
+	if err != nil {
+		log.Printf("[ERROR] Unable to detect archive format of %s: %v", file, err)
+		return "", nil, err
+	}
+	if format == "json" {
+		log.Printf("[INFO] %s is plain JSON, no extraction needed", file)
+		return file, func() {}, nil
+	}
+
+	log.Printf("[INFO] Extracting JSON file from %s (%s)", file, format)
 
-	cmd := exec.Command("7z", "x", file, "-y")
-	err := cmd.Run()
+	// Every extraction gets its own directory so leftovers never mix
+	workDir, err := os.MkdirTemp(tmpDir, "extract-")
 	if err != nil {
+		log.Printf("[ERROR] Creating extraction directory failed: %v", err)
+		return "", nil, err
+	}
+	cleanup := func() { _ = os.RemoveAll(workDir) }
+
+	// The JSON inside is named after the archive date (20250101.7z → 20250101.json)
+	jsonPath := filepath.Join(workDir, archiveBaseName(file)+".json")
+	switch format {
+	case "zip":
+		err = extractZip(file, jsonPath)
+	case "gzip":
+		err = extractGzip(file, jsonPath)
+	default:
+		err = extract7z(file, workDir)
+	}
+	if err != nil {
+		cleanup()
 		log.Printf("[ERROR] Extraction failed: %v", err)
-		return "", err
+		return "", nil, err
 	}
 
-	jsonPath := strings.Replace(file, ".7z", ".json", 1)
-	if _, err := os.Stat(jsonPath); os.IsNotExist(err) {
+	if _, err := os.Stat(jsonPath); err != nil {
+		cleanup()
 		log.Printf("[ERROR] Extracted JSON file not found: %s", jsonPath)
-		return "", err
+		return "", nil, err
 	}
 
 	log.Printf("[INFO] Extracted JSON file: %s", jsonPath)
-	return jsonPath, nil
+	return jsonPath, cleanup, nil
+}
+
+// 📌 Extract a `.7z` archive into a directory with the external 7z binary
+func extract7z(file string, workDir string) error {
+	archive, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	return runSevenZip(workDir, "x", archive, "-y", "-o"+workDir)
+}
+
+// 📌 Run the 7z binary with EXTRACT_TIMEOUT, reporting its stderr on failure
+func runSevenZip(dir string, args ...string) error {
+	binary, err := findSevenZip()
+	if err != nil {
+		return fmt.Errorf("7z binary not available: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), extractTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, binary, args...)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = 10 * time.Second
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s", extractTimeout)
+		}
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			err = fmt.Errorf("%w: %s", err, message)
+		}
+		return err
+	}
+	return nil
+}
+
+// 📌 Locate the 7z binary, falling back to the default install location on Windows
+func findSevenZip() (string, error) {
+	binary, err := exec.LookPath(sevenZipPath)
+	if err == nil || runtime.GOOS != "windows" || sevenZipPath != "7z" {
+		return binary, err
+	}
+
+	// The 7-Zip installer does not add itself to PATH
+	for _, programFiles := range []string{os.Getenv("ProgramFiles"), os.Getenv("ProgramFiles(x86)")} {
+		if programFiles == "" {
+			continue
+		}
+		candidate := filepath.Join(programFiles, "7-Zip", "7z.exe")
+		if _, statErr := os.Stat(candidate); statErr == nil {
+			return candidate, nil
+		}
+	}
+	return "", err
 }
 
 // 📌 Load and parse JSON file
 func loadData(jsonPath string) error {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+
 	log.Printf("[INFO] Loading data from JSON: %s", jsonPath)
+	loadStarted := time.Now()
+	heapBefore := liveHeapBytes()
 
-	data, err := os.ReadFile(jsonPath)
+	file, err := os.Open(jsonPath)
 	if err != nil {
 		log.Printf("[ERROR] Reading JSON file failed: %v", err)
 		return err
 	}
 
-	var structure DataStructure
-	if err := json.Unmarshal(data, &structure); err != nil {
+	structure, err := decodeDataFile(file)
+	file.Close()
+	if err != nil {
 		log.Printf("[ERROR] Parsing JSON failed: %v", err)
 		return err
 	}
-
-	mu.Lock()
-	defer mu.Unlock()
-
-	dataDate = structure.Header.DataDate
-	if parsedIterations, err := strconv.Atoi(structure.Header.TransformCount); err == nil && parsedIterations > 0 {
-		iterations = parsedIterations
-	} else {
-		log.Printf("[WARNING] Unable to parse TransformCount, using default (%d)", iterations)
+	if err := validateStructure(&structure); err != nil {
+		log.Printf("[ERROR] Flat file rejected, keeping the current dataset: %v", err)
+		return err
 	}
 
-	// Store data in memory
-	activeHashes = make(map[string]bool, len(structure.ActiveHashes))
+	// Build the new dataset before taking the lock
+	newActiveHashes := make(map[string]bool, len(structure.ActiveHashes))
 	for _, hash := range structure.ActiveHashes {
-		activeHashes[hash] = true
+		newActiveHashes[hash] = true
 	}
 
-	exemptHashes = make(map[string]bool, len(structure.ExemptHashes))
+	newExemptHashes := make(map[string]bool, len(structure.ExemptHashes))
 	for _, hash := range structure.ExemptHashes {
-		exemptHashes[hash] = true
+		newExemptHashes[hash] = true
 	}
+	// validateStructure already checked the count against TRANSFORM_COUNT_MIN/TRANSFORM_COUNT_MAX
+	transforms, _ := strconv.Atoi(structure.Header.TransformCount)
+	digest := digestDataset(structure.Header.DataDate, transforms, newActiveHashes, newExemptHashes, structure.Masks)
 
+	mu.Lock()
+	dataDate = structure.Header.DataDate
+	iterations = transforms
+
+	// Store data in memory
+	activeHashes = newActiveHashes
+	exemptHashes = newExemptHashes
 	masks = structure.Masks
+	datasetDigest = digest
+	datasetGeneration++
+	previousDatasetBytes := datasetHeapBytes
 
 	log.Printf("[INFO] Loaded %d active hashes, %d exempt hashes, %d masks. Data date: %s, Iterations: %d",
 		len(activeHashes), len(exemptHashes), len(masks), dataDate, iterations)
+	mu.Unlock()
+
+	// The previous dataset is unreachable now, so the heap delta is the new one
+	structure = DataStructure{}
+	newDatasetBytes := uint64(0)
+	if heapAfter := liveHeapBytes(); heapAfter+previousDatasetBytes > heapBefore {
+		newDatasetBytes = heapAfter + previousDatasetBytes - heapBefore
+	}
 
+	mu.Lock()
+	datasetHeapBytes = newDatasetBytes
+	mu.Unlock()
+	log.Printf("[INFO] Dataset occupies approximately %d MiB of heap", newDatasetBytes>>20)
+
+	confirmS3Download(jsonPath)
+	publishDatasetEvent()
+	go reportRefresh(time.Since(loadStarted))
+	go warmResultCache()
+	go refreshEntities()
+	go processScheduledPayments()
 	return nil
 }
 
 // 📌 Generate SHA-512 Hash
 func calculateHash(input string) string {
-	hash := []byte(input)
-
-	for i := 0; i < iterations; i++ {
-		hashSum := sha512.Sum512(hash)
-		hash = []byte(strings.ToLower(hex.EncodeToString(hashSum[:])))
-	}
+	return calculateHashRounds(input, iterations)
+}
 
-	return string(hash)
+// 📌 Generate SHA-512 Hash with an explicit number of iterations
+func calculateHashRounds(input string, rounds int) string {
+	return flatfile.Hash(input, rounds)
 }
 
 // 📌 Apply a mask to an account number
 func applyMask(bank string, mask string) string {
-	maskedResult := []rune(mask)
-	accountDigits := []rune(bank)
-
-	for i, char := range maskedResult {
-		if char == 'Y' {
-			// Replace 'Y' with the corresponding digit from the account number			
-			maskedResult[i] = accountDigits[i]
-		} else if char == 'X' {
-			// Keep 'X' as it represents a placeholder
-			maskedResult[i] = 'X'
-		}
-	}
-
-	return string(maskedResult)
+	return flatfile.ApplyMask(bank, mask)
 }
 
 // 📌 Handle /verify API endpoint
@@ -170,112 +327,273 @@ func verifyHandler(w http.ResponseWriter, r *http.Request) {
 	nip := query.Get("nip")
 	bank := query.Get("bank")
 
-	if nip == "" {
-		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Missing required parameters"})
+	if strings.Contains(nip, ",") {
+		multiNIPHandler(w, r, nip)
 		return
 	}
-	if bank != "" && len(bank) != 26 {
-		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Invalid bank account number"})
+
+	category, fields := validateInput(nip, bank)
+	amount, amountFields := parseAmount(query.Get("amount"), query.Get("currency"))
+	if category == "" && len(amountFields) > 0 {
+		category = "invalid_amount"
+	}
+	correlation := correlationFromQuery(query)
+	correlationFields := validateCorrelation(correlation)
+	if category == "" && len(correlationFields) > 0 {
+		category = "invalid_correlation"
+	}
+	if category != "" {
+		recordUsage(tenantFromRequest(r), "ERROR")
+		recordError(category)
+		json.NewEncoder(w).Encode(validationResponse(append(append(fields, amountFields...), correlationFields...)))
 		return
 	}
 
-	mu.RLock()
-	currentDataDate := dataDate
-	mu.RUnlock()
-
-	hashed := calculateHash(currentDataDate + nip)
-	// log.Printf("[INFO] Verifying NIP: %s, Hash: %s", nip, hashed)
+	watch := query.Get("watch") == "true"
+	if watch && tenantFromRequest(r) == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "watch=true requires an API key, set API_KEYS"})
+		return
+	}
 
-	mu.RLock()
-	_, isActive := activeHashes[hashed]
-	_, isExempt := exemptHashes[hashed]
-	mu.RUnlock()
+	if problem := datasetProblem(); problem != "" {
+		status, result := unavailableResponse(problem)
+		if status != http.StatusOK {
+			recordUsage(tenantFromRequest(r), "ERROR")
+			recordError("dataset_unavailable")
+		} else {
+			recordUsage(tenantFromRequest(r), result.Status)
+			recordStats(result, bank != "")
+			annotateAdvisory(&result, amount, bank != "")
+			result.Correlation = correlation
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(result)
+		return
+	}
 
-	if isActive {
-		json.NewEncoder(w).Encode(Response{Response: "OK", Status: "ACTIVE", Bank: "NA", Date: currentDataDate})
+	release, err := classOf(bank).enter(r.Context())
+	if err != nil {
+		recordUsage(tenantFromRequest(r), "ERROR")
+		recordError("overloaded")
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Too many verifications in progress, retry shortly"})
 		return
 	}
-	if isExempt {
-		json.NewEncoder(w).Encode(Response{Response: "OK", Status: "EXEMPT", Bank: "NA", Date: currentDataDate})
+	started := time.Now()
+	result := verifyTraced(nip, bank, query.Get("trace") == "true")
+	release()
+	if result.code != 0 {
+		recordUsage(tenantFromRequest(r), "ERROR")
+		recordError("mf_api")
+		if result.retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(result.retryAfter.Seconds())+1))
+		}
+		w.WriteHeader(result.code)
+		json.NewEncoder(w).Encode(result)
 		return
 	}
+	statsdSend("verify_duration", float64(time.Since(started).Milliseconds()), "ms", "")
+	if correlation != nil {
+		// References tie the answer to a document, so it is kept as a confirmation
+		result.Correlation = correlation
+		result.Confirmation = issueConfirmation(tenantFromRequest(r), "verify", nip, bank, result)
+	}
+	recordRequest(nip, bank, result)
+	shadowRequest(r, nip, bank, result)
+	recordUsage(tenantFromRequest(r), result.Status)
+	recordStats(result, bank != "")
+	if watch {
+		watchPair(tenantFromRequest(r), nip, bank, result)
+	}
+	annotateAdvisory(&result, amount, bank != "")
+	json.NewEncoder(w).Encode(result)
+}
 
-	if bank != "" {
-		hashed = calculateHash(currentDataDate + nip + bank)
-		// log.Printf("[INFO] Verifying NIP: %s, Bank: %s, Hash: %s", nip, bank, hashed)
+// 📌 Verify a NIP and optional bank account
+func verify(nip string, bank string) Response {
+	return verifyTraced(nip, bank, false)
+}
 
-		mu.RLock()
-		_, isActiveBank := activeHashes[hashed]
-		_, isExemptBank := exemptHashes[hashed]
-		mu.RUnlock()
+// 📌 Verify a NIP and optional bank account, optionally recording every check performed
+func verifyTraced(nip string, bank string, withTrace bool) Response {
+	var trace *Trace
+	if withTrace {
+		trace = &Trace{}
+	}
 
-		if isActiveBank {
-			json.NewEncoder(w).Encode(Response{Response: "OK", Status: "ACTIVE", Bank: "MATCHED", Date: currentDataDate})
-			return
-		}
-		if isExemptBank {
-			json.NewEncoder(w).Encode(Response{Response: "OK", Status: "EXEMPT", Bank: "MATCHED", Date: currentDataDate})
-			return
+	var result Response
+	if mode == "mock" {
+		result = mockVerify(nip, bank)
+		trace.add(TraceStep{Check: "mock", Outcome: result.Status})
+	} else if mode == "proxy" {
+		result = proxyVerify(nip, bank, trace)
+		if result.code != 0 {
+			return result
 		}
+	} else {
+		result = lookup(nip, bank, trace)
+	}
 
-		for _, mask := range masks {
-			masked := applyMask(bank, mask)
-			maskedHash := calculateHash(currentDataDate + nip + masked)
-			// log.Printf("[INFO] Verifying NIP: %s, Bank: %s, Mask: %s, Masked: %s, Hash: %s", nip, bank, mask, masked, maskedHash)
+	if trace != nil {
+		result.Trace = *trace
+	}
+	result.AccountAssigned = accountAssigned(bank, result.match)
+	annotateDataAge(&result)
+	return result
+}
 
-			mu.RLock()
-			_, isActiveMasked := activeHashes[maskedHash]
-			_, isExemptMasked := exemptHashes[maskedHash]
-			mu.RUnlock()
+// 📌 accountAssigned value for a verification, computed like the official MF API
+func accountAssigned(bank string, match string) json.RawMessage {
+	return flatfile.AccountAssigned(bank, match)
+}
 
-			if isActiveMasked {
-				json.NewEncoder(w).Encode(Response{Response: "OK", Status: "ACTIVE", Bank: "MATCHED", Date: currentDataDate})
-				return
-			}
-			if isExemptMasked {
-				json.NewEncoder(w).Encode(Response{Response: "OK", Status: "EXEMPT", Bank: "MATCHED", Date: currentDataDate})
-				return
-			}
-		}
+// 📌 Look up a NIP and optional bank account in the loaded dataset
+func lookup(nip string, bank string, trace *Trace) Response {
+	// Maps are replaced, never modified, so they can be read without the lock
+	mu.RLock()
+	dataset := flatfile.Dataset{Date: dataDate, Iterations: iterations, Active: activeHashes, Exempt: exemptHashes, Masks: masks}
+	generation := datasetGeneration
+	mu.RUnlock()
+
+	var result flatfile.Result
+	if trace == nil {
+		noteQuery(nip, bank)
+		result = cachedLookup(&dataset, generation, nip, bank)
+	} else {
+		result = dataset.Lookup(nip, bank, func(check flatfile.Check) {
+			trace.add(TraceStep{Check: check.Check, Mask: check.Mask, Input: check.Input, Outcome: traceOutcome(check.Active, check.Exempt)})
+		})
+	}
+	return Response{Response: "OK", Status: result.Status, Bank: result.Bank, Date: dataset.Date, match: result.Match}
+}
+
+// 📌 Fetch the flat file from the Ministry of Finance
+func fetchFromMF() (string, func(), error) {
+	file, err := downloadVerified(downloadFile)
+	if err != nil {
+		return "", nil, err
 	}
 
-	json.NewEncoder(w).Encode(Response{Response: "OK", Status: "NOT_FOUND", Bank: "NOT_FOUND", Date: currentDataDate})
+	jsonFile, cleanupExtracted, err := extractFile(file)
+	if err != nil {
+		_ = os.Remove(file)
+		return "", nil, err
+	}
+
+	noteUpdateSize(file, jsonFile)
+	cleanup := func() {
+		cleanupExtracted()
+		retainArchive(file)
+	}
+	return jsonFile, cleanup, nil
 }
 
-// 📌 Handle /health API endpoint
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	json.NewEncoder(w).Encode(Response{Response: "OK", Message: "Service is running"})
+// 📌 Fetch the dataset from the configured source
+func fetchData() (string, func(), error) {
+	if chaosUpdateFailure() {
+		return "", nil, errChaosUpdate
+	}
+	if err := checkDownloadSpace(); err != nil {
+		return "", nil, err
+	}
+	// Followers only copy the leader, they never download from DATA_SOURCE themselves
+	if leaderElection {
+		if leading, url := leadership(); !leading {
+			if url == "" {
+				return "", nil, errors.New("no updater leader elected yet")
+			}
+			return fetchFromPeer(url)
+		}
+	} else if peerURL != "" && dataSource != "peer" {
+		jsonFile, cleanup, err := fetchFromPeer(peerURL)
+		if err == nil || errors.Is(err, errNotModified) {
+			return jsonFile, cleanup, err
+		}
+		log.Printf("[WARNING] Peer unavailable, falling back to %s: %v", dataSource, err)
+	}
+
+	switch dataSource {
+	case "s3":
+		return fetchFromS3()
+	case "peer":
+		return fetchFromPeer(peerURL)
+	case "sandbox":
+		return writeSandboxData()
+	default:
+		return fetchFromMF()
+	}
 }
 
 // 📌 Periodic data update
 func updateData() {
+	if dataSource == "file" {
+		updateFromLocal()
+		return
+	}
+	if delay := updateDelay(); delay > 0 && !following() && mode != "readonly" {
+		log.Printf("[INFO] Delaying the first data update by %s (UPDATE_JITTER, UPDATE_SPREAD)", delay.Round(time.Second))
+		time.Sleep(delay)
+	}
+
 	for {
-		log.Printf("[INFO] Starting data update...")
-		file, err := downloadFile()
-		if err != nil {
-			log.Printf("[ERROR] Download failed: %s", err)
-			time.Sleep(1 * time.Hour)
+		polling := following() || mode == "readonly"
+		if !polling {
+			log.Printf("[INFO] Starting data update from %s...", dataSource)
+		}
+		fetchStarted := time.Now()
+		jsonFile, cleanup, err := fetchData()
+		if !polling {
+			noteFetchDuration(time.Since(fetchStarted))
+		}
+		if polling {
+			// Followers and read-only servers poll, snapshots are published elsewhere at any time
+			if err == nil {
+				err = loadData(jsonFile)
+				cleanup()
+			}
+			if err != nil && !errors.Is(err, errNotModified) {
+				log.Printf("[WARNING] Loading the published snapshot failed: %s", err)
+			}
+			if mode == "readonly" {
+				time.Sleep(watchInterval)
+			} else {
+				time.Sleep(followerPollInterval)
+			}
+			continue
+		}
+		if errors.Is(err, errNotModified) {
+			log.Printf("[INFO] Dataset is up to date.")
+			if updateInterval == 0 {
+				return
+			}
+			sleepUntilNextUpdate()
 			continue
 		}
-
-		jsonFile, err := extractFile(file)
 		if err != nil {
-			log.Printf("[ERROR] Extraction failed: %s", err)
-			time.Sleep(1 * time.Hour)
+			log.Printf("[ERROR] Fetching data failed: %s", err)
+			scheduleFetchRetry(time.Now().Add(retryInterval))
+			time.Sleep(retryInterval)
 			continue
 		}
 
-		if err := loadData(jsonFile); err != nil {
+		err = loadData(jsonFile)
+		cleanup()
+		if err != nil {
 			log.Printf("[ERROR] Loading failed: %s", err)
-			time.Sleep(1 * time.Hour)
+			scheduleFetchRetry(time.Now().Add(retryInterval))
+			time.Sleep(retryInterval)
 			continue
 		}
 
-		_ = os.Remove(file)
-		_ = os.Remove(jsonFile)
-
 		log.Printf("[INFO] Data update completed successfully.")
-		time.Sleep(24 * time.Hour)
+		pruneRetained()
+		if updateInterval == 0 {
+			log.Printf("[INFO] UPDATE_INTERVAL is 0, no further refreshes scheduled.")
+			return
+		}
+		sleepUntilNextUpdate()
 	}
 }
 
@@ -286,15 +604,149 @@ func handleShutdown() {
 
 	<-stop
 	log.Printf("[INFO] Shutting down server...")
+	flushHistory()
+	deregisterService()
+	flushLogs()
 	os.Exit(0)
 }
 
 func main() {
-	go updateData()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			os.Exit(runReplay(os.Args[2:]))
+		case "hash":
+			os.Exit(runHash(os.Args[2:]))
+		case "export-confirmations":
+			os.Exit(runConfirmationsExport(os.Args[2:]))
+		case "update":
+			os.Exit(runUpdate(os.Args[2:]))
+		case "bench":
+			os.Exit(runBench(os.Args[2:]))
+		case "config":
+			os.Exit(runConfig(os.Args[2:]))
+		}
+	}
+
+	flag.StringVar(&listenAddr, "listen", listenAddr, "listen addresses, e.g. :8080 or 127.0.0.1:8080,[::1]:8080")
+	flag.Parse()
+
+	if err := configureLogging(); err != nil {
+		log.Fatalf("[ERROR] Logging to %s unavailable: %v", logOutput, err)
+	}
+	configureMemoryLimit()
+
+	if mode == "serverless" {
+		listenAddr = serverlessListenAddr()
+	}
+	listeners, err := parseListeners(listenAddr)
+	if err != nil {
+		log.Fatalf("[ERROR] Invalid listen address %q: %v", listenAddr, err)
+	}
+	if problems := configErrors(); len(problems) > 0 {
+		for _, problem := range problems {
+			log.Printf("[ERROR] %s", problem)
+		}
+		os.Exit(1)
+	}
+	if err := enableRegistries(); err != nil {
+		log.Fatalf("[ERROR] Invalid REGISTRIES: %v", err)
+	}
+	if oidcIssuer != "" && oidcAudience == "" {
+		log.Fatalf("[ERROR] OIDC_AUDIENCE is required with OIDC_ISSUER, otherwise tokens issued for any service of %s would be accepted", oidcIssuer)
+	}
+
+	for _, dir := range []string{dataDir, tmpDir} {
+		if err := ensureDir(dir); err != nil {
+			log.Fatalf("[ERROR] Directory %s is not usable: %v", dir, err)
+		}
+	}
+	cleanTmpDir()
+	if err := openStore(); err != nil {
+		log.Fatalf("[ERROR] Opening the %s store failed: %v", storeBackend, err)
+	}
+	if err := loadManagedKeys(); err != nil {
+		log.Fatalf("[ERROR] Reading API keys failed: %v", err)
+	}
+	if err := loadHistory(); err != nil {
+		log.Fatalf("[ERROR] Status history %s is not readable: %v", historyFile, err)
+	}
+	if err := loadBankDirectory(); err != nil {
+		log.Fatalf("[ERROR] Bank directory %s is not readable: %v", bankDirectoryFile, err)
+	}
+	if err := loadEntities(); err != nil {
+		log.Fatalf("[ERROR] Entity mirror %s is not readable: %v", entityFile, err)
+	}
+	if err := loadScheduledPayments(); err != nil {
+		log.Fatalf("[ERROR] Scheduled payments %s are not readable: %v", scheduledFile, err)
+	}
+	if err := openRecorder(); err != nil {
+		log.Fatalf("[ERROR] Request recording unavailable: %v", err)
+	}
+	if err := startStatsD(); err != nil {
+		log.Fatalf("[ERROR] StatsD unavailable: %v", err)
+	}
+
+	for _, registry := range registries {
+		registry.Start()
+	}
+	if secretsRefreshInterval > 0 && usesSecretRefs() {
+		go runSecretsRefresh()
+	}
+	go runManagedKeysRefresh()
 	go handleShutdown()
+	go handleReloadSignal()
+	go exportUsage()
+	go runScheduledPayments()
+	go runIdempotencySweep()
+	if telegramToken != "" {
+		go runTelegramBot()
+	}
+	if serviceRegistry != "" {
+		if err := registerService(); err != nil {
+			log.Fatalf("[ERROR] Registering in %s failed: %v", serviceRegistry, err)
+		}
+	}
 
-	http.HandleFunc("/verify", verifyHandler)
+	for _, registry := range registries {
+		registry.Routes(http.DefaultServeMux)
+	}
+	http.HandleFunc("/registries", registriesHandler)
+	http.HandleFunc("/events", requireRole(roleVerify, eventsHandler))
+	http.HandleFunc("/watchlist", requireRole(roleVerify, watchlistHandler))
+	http.HandleFunc("/history/{nip}", requireRole(roleVerify, historyHandler))
+	http.HandleFunc("/payments/scheduled", requireRole(roleVerify, idempotent(scheduledHandler)))
+	if slackSigningSecret != "" {
+		http.HandleFunc("/slack", slackHandler)
+	}
 	http.HandleFunc("/health", healthHandler)
-	log.Printf("[INFO] Server running at %s", serverAddress)
-	log.Fatal(http.ListenAndServe(serverAddress, nil))
+	http.HandleFunc("/metrics", metricsHandler)
+	http.HandleFunc("/stats", statsHandler)
+	http.HandleFunc("/admin/usage", requireRole(roleAuditor, usageHandler))
+	http.HandleFunc("/admin/keys", requireRole(roleAdmin, keysHandler))
+	http.HandleFunc("/admin/confirmations/export", requireRole(roleAuditor, confirmationsExportHandler))
+	http.HandleFunc("/reports", requireRole(roleAuditor, reportsHandler))
+	http.HandleFunc("/reports/{date}", requireRole(roleAuditor, reportHandler))
+	if chaosEnabled {
+		log.Printf("[WARNING] CHAOS_ENABLED is set, faults can be injected through /admin/chaos")
+		http.HandleFunc("/admin/chaos", requireRole(roleAdmin, chaosHandler))
+	}
+	if metricsAddr != "" {
+		if err := startMetricsListener(); err != nil {
+			log.Fatalf("[ERROR] Metrics listener on %s unavailable: %v", metricsAddr, err)
+		}
+	}
+	handler := recoverPanics(publicOnly(http.DefaultServeMux))
+	if http3Addr != "" {
+		if handler, err = startHTTP3(handler); err != nil {
+			log.Fatalf("[ERROR] HTTP/3 listener on %s unavailable: %v", http3Addr, err)
+		}
+	}
+	if mode == "serverless" {
+		handler = serverlessRefresh(handler)
+		if lambdaRuntimeAPI != "" {
+			log.Fatal(serveLambda(handler))
+		}
+	}
+	log.Fatal(serveListeners(listeners, handler))
 }
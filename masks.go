@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// Masks sharing a bank sort code
+type MaskGroup struct {
+	SortCode string   `json:"sortCode"`
+	Masks    []string `json:"masks"`
+	// Account from the query with each mask applied
+	Masked []string `json:"masked,omitempty"`
+}
+
+// Loaded masks grouped by bank
+type MasksResponse struct {
+	Response string      `json:"response"`
+	Date     string      `json:"date"`
+	Count    int         `json:"count"`
+	Groups   []MaskGroup `json:"groups"`
+}
+
+// 📌 Bank sort code (digits 3-10 of the account) a mask or account belongs to
+func sortCode(value string) string {
+	if len(value) < 10 {
+		return ""
+	}
+	return value[2:10]
+}
+
+// 📌 Handle /admin/masks API endpoint
+func masksHandler(w http.ResponseWriter, r *http.Request) {
+	account := r.URL.Query().Get("bank")
+	if account != "" && len(account) != 26 {
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Invalid bank account number"})
+		return
+	}
+
+	mu.RLock()
+	currentDataDate, currentMasks := dataDate, masks
+	mu.RUnlock()
+
+	grouped := make(map[string][]string)
+	for _, mask := range currentMasks {
+		code := sortCode(mask)
+		if account != "" && code != sortCode(account) {
+			continue
+		}
+		grouped[code] = append(grouped[code], mask)
+	}
+
+	result := MasksResponse{Response: "OK", Date: currentDataDate, Count: len(currentMasks), Groups: []MaskGroup{}}
+	for code, group := range grouped {
+		entry := MaskGroup{SortCode: code, Masks: group}
+		if account != "" {
+			for _, mask := range group {
+				if len(mask) == len(account) {
+					entry.Masked = append(entry.Masked, applyMask(account, mask))
+				}
+			}
+		}
+		result.Groups = append(result.Groups, entry)
+	}
+	sort.Slice(result.Groups, func(i, j int) bool { return result.Groups[i].SortCode < result.Groups[j].SortCode })
+
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+var (
+	// cgroup files holding the container memory limit (v2 first, then v1)
+	cgroupMemoryFiles = []string{
+		"/sys/fs/cgroup/memory.max",
+		"/sys/fs/cgroup/memory/memory.limit_in_bytes",
+	}
+	datasetHeapBytes uint64
+)
+
+// 📌 Apply a soft memory limit derived from the container limit
+func configureMemoryLimit() {
+	if os.Getenv("GOMEMLIMIT") != "" {
+		log.Printf("[INFO] Soft memory limit set by GOMEMLIMIT: %d bytes", debug.SetMemoryLimit(-1))
+		return
+	}
+
+	ratio := getEnvFloat("MEMORY_LIMIT_RATIO", 0)
+	if ratio <= 0 {
+		return
+	}
+	if ratio > 1 {
+		log.Printf("[WARNING] MEMORY_LIMIT_RATIO must be between 0 and 1, got %v", ratio)
+		return
+	}
+
+	limit, err := cgroupMemoryLimit()
+	if err != nil {
+		log.Printf("[WARNING] Unable to apply MEMORY_LIMIT_RATIO: %v", err)
+		return
+	}
+
+	softLimit := int64(float64(limit) * ratio)
+	debug.SetMemoryLimit(softLimit)
+	log.Printf("[INFO] Soft memory limit set to %d bytes (%.0f%% of %d bytes container limit)", softLimit, ratio*100, limit)
+}
+
+// 📌 Read the memory limit of the current cgroup
+func cgroupMemoryLimit() (int64, error) {
+	for _, path := range cgroupMemoryFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		value := strings.TrimSpace(string(data))
+		if value == "max" {
+			return 0, errors.New("container has no memory limit")
+		}
+
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		// cgroup v1 reports a page-aligned max int64 when unlimited
+		if limit <= 0 || limit >= 1<<62 {
+			return 0, errors.New("container has no memory limit")
+		}
+		return limit, nil
+	}
+
+	return 0, errors.New("cgroup memory limit not found")
+}
+
+// 📌 Read the live heap size after a full collection
+func liveHeapBytes() uint64 {
+	runtime.GC()
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
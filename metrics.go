@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// Single sample exposed on /metrics and to StatsD
+type metric struct {
+	name  string
+	kind  string
+	help  string
+	value float64
+}
+
+// 📌 Write a single metric in the Prometheus text format
+func writeMetric(w io.Writer, name string, kind string, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", name, help, name, kind, name, value)
+}
+
+// 📌 Collect dataset, runtime memory, request class and shadowing metrics
+func collectMetrics() []metric {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	mu.RLock()
+	activeCount := len(activeHashes)
+	exemptCount := len(exemptHashes)
+	maskCount := len(masks)
+	datasetBytes := datasetHeapBytes
+	mu.RUnlock()
+
+	metrics := append([]metric{
+		{"vatbank_dataset_active_hashes", "gauge", "Number of loaded active taxpayer hashes.", float64(activeCount)},
+		{"vatbank_dataset_exempt_hashes", "gauge", "Number of loaded exempt taxpayer hashes.", float64(exemptCount)},
+		{"vatbank_dataset_masks", "gauge", "Number of loaded bank account masks.", float64(maskCount)},
+		{"vatbank_dataset_heap_bytes", "gauge", "Live heap bytes attributed to the loaded dataset.", float64(datasetBytes)},
+
+		{"vatbank_memory_limit_bytes", "gauge", "Soft memory limit of the Go runtime.", float64(debug.SetMemoryLimit(-1))},
+		{"vatbank_heap_alloc_bytes", "gauge", "Bytes of allocated heap objects.", float64(stats.HeapAlloc)},
+		{"vatbank_heap_inuse_bytes", "gauge", "Bytes in in-use heap spans.", float64(stats.HeapInuse)},
+		{"vatbank_heap_released_bytes", "gauge", "Bytes of heap memory returned to the OS.", float64(stats.HeapReleased)},
+		{"vatbank_sys_bytes", "gauge", "Bytes of memory obtained from the OS.", float64(stats.Sys)},
+		{"vatbank_gc_cycles_total", "counter", "Number of completed GC cycles.", float64(stats.NumGC)},
+		{"vatbank_gc_pause_seconds_total", "counter", "Cumulative GC stop-the-world pause time.", float64(stats.PauseTotalNs) / 1e9},
+		{"vatbank_gc_last_pause_seconds", "gauge", "Duration of the most recent GC pause.", float64(stats.PauseNs[(stats.NumGC+255)%256]) / 1e9},
+	}, classMetrics()...)
+	metrics = append(metrics, resultCacheMetrics()...)
+	return append(metrics, shadowMetrics()...)
+}
+
+// 📌 Handle /metrics API endpoint
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	for _, m := range collectMetrics() {
+		writeMetric(w, m.name, m.kind, m.help, m.value)
+	}
+}
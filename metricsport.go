@@ -0,0 +1,73 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	_ "net/http/pprof"
+	"strings"
+)
+
+var (
+	// Separate plain HTTP listener for /metrics, /health and pprof, e.g. :9090; /metrics leaves the public listeners
+	metricsAddr = getEnv("METRICS_ADDR", "")
+	// Move the /admin/ endpoints to METRICS_ADDR as well
+	metricsAdmin = getEnvBool("METRICS_ADMIN", false)
+)
+
+// 📌 Report whether a path belongs to the internal listener instead of the public API
+func internalPath(path string) bool {
+	switch {
+	case strings.HasPrefix(path, "/debug/pprof/"):
+		return true
+	case path == "/metrics":
+		return metricsAddr != ""
+	case adminPath(path):
+		return metricsAddr != "" && metricsAdmin
+	}
+	return false
+}
+
+// 📌 Report whether a path is an /admin/ endpoint, unprefixed or under a registry prefix such as /pl/admin/
+func adminPath(path string) bool {
+	if strings.HasPrefix(path, "/admin/") {
+		return true
+	}
+	for _, registry := range registries {
+		if strings.HasPrefix(path, "/"+registry.Name()+"/admin/") {
+			return true
+		}
+	}
+	return false
+}
+
+// 📌 Hide the internal endpoints from the public listeners, pprof registers itself on the default mux
+func publicOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if internalPath(r.URL.Path) {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// 📌 Serve /metrics, /health, pprof (and /admin/ with METRICS_ADMIN) on METRICS_ADDR
+func startMetricsListener() error {
+	ln, err := net.Listen("tcp", metricsAddr)
+	if err != nil {
+		return err
+	}
+	handler := recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !internalPath(r.URL.Path) && r.URL.Path != "/health" {
+			http.NotFound(w, r)
+			return
+		}
+		http.DefaultServeMux.ServeHTTP(w, r)
+	}))
+	log.Printf("[INFO] Metrics running at %s", ln.Addr())
+	go func() {
+		log.Fatalf("[ERROR] Metrics listener on %s stopped: %v", metricsAddr, http.Serve(ln, handler))
+	}()
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import "strings"
+
+// 📌 Derive a deterministic response from the NIP and account digits
+//
+// NIPs ending in 1 are ACTIVE, in 2 EXEMPT, anything else NOT_FOUND.
+// For found taxpayers an account ending in 9 is reported as not registered
+// (NOT_FOUND), any other account as MATCHED and no account as NA.
+func mockVerify(nip string, bank string) Response {
+	date := today()
+
+	var status string
+	switch {
+	case strings.HasSuffix(nip, "1"):
+		status = "ACTIVE"
+	case strings.HasSuffix(nip, "2"):
+		status = "EXEMPT"
+	default:
+		return Response{Response: "OK", Status: "NOT_FOUND", Bank: "NOT_FOUND", Date: date, match: "none"}
+	}
+
+	switch {
+	case bank == "":
+		return Response{Response: "OK", Status: status, Bank: "NA", Date: date, match: "none"}
+	case strings.HasSuffix(bank, "9"):
+		return Response{Response: "OK", Status: "NOT_FOUND", Bank: "NOT_FOUND", Date: date, match: "none"}
+	default:
+		return Response{Response: "OK", Status: status, Bank: "MATCHED", Date: date, match: "direct"}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Largest accepted number of NIPs in a single GET /verify?nip=a,b,c
+var multiNIPMax = getEnvInt("MULTI_NIP_MAX", 100)
+
+// 📌 Handle /verify with a comma-separated NIP list, answering with a JSON array in request order
+func multiNIPHandler(w http.ResponseWriter, r *http.Request, list string) {
+	tenant := tenantFromRequest(r)
+	if !hasRole(r, roleBatch) {
+		recordUsage(tenant, "ERROR")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "NIP lists require the batch role"})
+		return
+	}
+	if r.URL.Query().Get("bank") != "" {
+		recordUsage(tenant, "ERROR")
+		recordError("invalid_bank")
+		json.NewEncoder(w).Encode(validationResponse([]FieldError{{Field: "bank", Code: "NOT_SUPPORTED", Message: "Bank account cannot be combined with a NIP list, use POST /verify/batch"}}))
+		return
+	}
+
+	nips := strings.Split(list, ",")
+	if len(nips) > multiNIPMax {
+		recordUsage(tenant, "ERROR")
+		recordError("too_many_nips")
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Too many NIPs, use POST /verify/batch"})
+		return
+	}
+
+	problem := datasetProblem()
+	if problem != "" {
+		if status, result := unavailableResponse(problem); status != http.StatusOK {
+			recordUsage(tenant, "ERROR")
+			recordError("dataset_unavailable")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(result)
+			return
+		}
+	}
+
+	results := make([]BatchResult, len(nips))
+	var valid []BatchItem
+	var validIndexes []int
+	for i, nip := range nips {
+		nip = strings.TrimSpace(nip)
+		results[i] = BatchResult{Index: i, NIP: nip}
+		if category, fields := validateInput(nip, ""); category != "" {
+			recordUsage(tenant, "ERROR")
+			recordError(category)
+			results[i].Response = validationResponse(fields)
+			continue
+		}
+		if problem != "" {
+			_, results[i].Response = unavailableResponse(problem)
+			recordUsage(tenant, results[i].Status)
+			continue
+		}
+		valid = append(valid, BatchItem{NIP: nip})
+		validIndexes = append(validIndexes, i)
+	}
+
+	// Every index is written by exactly one worker, no locking needed
+	verifyBatch(valid, func(indexes []int, result Response) {
+		for _, index := range indexes {
+			results[validIndexes[index]].Response = result
+		}
+	})
+	for _, index := range validIndexes {
+		result := results[index].Response
+		recordRequest(results[index].NIP, "", result)
+		recordUsage(tenant, result.Status)
+		recordStats(result, false)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Keys of an unknown kid are looked up again at most this often
+const jwksRefreshInterval = time.Minute
+
+var (
+	// Issuer of accepted JWT bearer tokens, JWT authentication is disabled when empty
+	oidcIssuer = strings.TrimSuffix(getEnv("OIDC_ISSUER", ""), "/")
+	// Required "aud" value, tokens issued for other services are rejected
+	oidcAudience = getEnv("OIDC_AUDIENCE", "")
+	// Claim naming the tenant and claim listing the roles of a token
+	oidcTenantClaim = getEnv("OIDC_TENANT_CLAIM", "sub")
+	oidcRolesClaim  = getEnv("OIDC_ROLES_CLAIM", "roles")
+	// Tolerated clock difference for exp and nbf
+	oidcLeeway = getEnvDuration("OIDC_LEEWAY", time.Minute)
+
+	oidcClient  = &http.Client{Timeout: 10 * time.Second}
+	jwksKeys    map[string]crypto.PublicKey
+	jwksFetched time.Time
+	// Closed when the running JWKS fetch finishes, nil without one
+	jwksFetching chan struct{}
+	jwksMu       sync.Mutex
+)
+
+// Single key of a JSON Web Key Set
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Verified identity of a bearer token
+type tokenIdentity struct {
+	Tenant string
+	Roles  map[string]bool
+}
+
+// 📌 Check whether a bearer token is a JWT (three dot-separated parts)
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// 📌 Download the issuer's signing keys through OIDC discovery
+func fetchJWKS() (map[string]crypto.PublicKey, error) {
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := getJSON(oidcIssuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != oidcIssuer || discovery.JWKSURI == "" {
+		return nil, errors.New("discovery document does not match OIDC_ISSUER")
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(discovery.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("JWKS: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		if public, err := key.publicKey(); err == nil {
+			keys[key.Kid] = public
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS has no usable signing keys")
+	}
+	return keys, nil
+}
+
+// 📌 GET a JSON document
+func getJSON(url string, target any) error {
+	resp, err := oidcClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(http.MaxBytesReader(nil, resp.Body, 1<<20)).Decode(target)
+}
+
+// 📌 Convert an RSA or EC JSON Web Key into a public key
+func (key jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := func(value string) (*big.Int, error) {
+		raw, err := base64.RawURLEncoding.DecodeString(value)
+		return new(big.Int).SetBytes(raw), err
+	}
+	switch key.Kty {
+	case "RSA":
+		n, err := decode(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(key.E)
+		if err != nil || !e.IsInt64() {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch key.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", key.Crv)
+		}
+		x, err := decode(key.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(key.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", key.Kty)
+}
+
+// 📌 Find the signing key of a kid, refreshing the JWKS once when it is unknown (key rotation)
+func signingKey(kid string) (crypto.PublicKey, error) {
+	jwksMu.Lock()
+	if key, ok := jwksKeys[kid]; ok {
+		jwksMu.Unlock()
+		return key, nil
+	}
+	if fetching := jwksFetching; fetching != nil {
+		// Another request is fetching already, wait for its keys instead of holding the lock over the call
+		jwksMu.Unlock()
+		<-fetching
+		jwksMu.Lock()
+		key, ok := jwksKeys[kid]
+		jwksMu.Unlock()
+		if !ok {
+			return nil, errors.New("unknown signing key")
+		}
+		return key, nil
+	}
+	if time.Since(jwksFetched) < jwksRefreshInterval {
+		jwksMu.Unlock()
+		return nil, errors.New("unknown signing key")
+	}
+	fetching := make(chan struct{})
+	jwksFetched, jwksFetching = time.Now(), fetching
+	jwksMu.Unlock()
+
+	keys, err := fetchJWKS()
+	jwksMu.Lock()
+	defer jwksMu.Unlock()
+	jwksFetching = nil
+	close(fetching)
+	if err != nil {
+		return nil, err
+	}
+	jwksKeys = keys
+	if key, ok := jwksKeys[kid]; ok {
+		return key, nil
+	}
+	return nil, errors.New("unknown signing key")
+}
+
+// 📌 Verify a JWT signature, issuer, audience and lifetime, and read its tenant and roles
+func verifyJWT(token string) (tokenIdentity, error) {
+	parts := strings.Split(token, ".")
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return tokenIdentity{}, errors.New("malformed header")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return tokenIdentity{}, errors.New("malformed signature")
+	}
+
+	// Only asymmetric algorithms, "none" and HMAC are never accepted
+	hashes := map[string]crypto.Hash{"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+		"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512, "ES256": crypto.SHA256, "ES384": crypto.SHA384}
+	hash, ok := hashes[header.Alg]
+	if !ok {
+		return tokenIdentity{}, fmt.Errorf("unsupported algorithm %q", header.Alg)
+	}
+	key, err := signingKey(header.Kid)
+	if err != nil {
+		return tokenIdentity{}, err
+	}
+	digest := hash.New()
+	digest.Write([]byte(parts[0] + "." + parts[1]))
+	sum := digest.Sum(nil)
+
+	switch public := key.(type) {
+	case *rsa.PublicKey:
+		if strings.HasPrefix(header.Alg, "PS") {
+			err = rsa.VerifyPSS(public, hash, sum, signature, nil)
+		} else if strings.HasPrefix(header.Alg, "RS") {
+			err = rsa.VerifyPKCS1v15(public, hash, sum, signature)
+		} else {
+			err = errors.New("algorithm does not match the key")
+		}
+	case *ecdsa.PublicKey:
+		size := (public.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(header.Alg, "ES") || len(signature) != 2*size {
+			err = errors.New("algorithm does not match the key")
+		} else if !ecdsa.Verify(public, sum, new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])) {
+			err = errors.New("invalid signature")
+		}
+	}
+	if err != nil {
+		return tokenIdentity{}, errors.New("invalid signature")
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return tokenIdentity{}, errors.New("malformed claims")
+	}
+	if issuer, _ := claims["iss"].(string); strings.TrimSuffix(issuer, "/") != oidcIssuer {
+		return tokenIdentity{}, errors.New("wrong issuer")
+	}
+	if !containsClaim(claims["aud"], oidcAudience) {
+		return tokenIdentity{}, errors.New("wrong audience")
+	}
+	now := time.Now()
+	expires, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(expires), 0).Add(oidcLeeway)) {
+		return tokenIdentity{}, errors.New("token expired")
+	}
+	if notBefore, ok := claims["nbf"].(float64); ok && now.Add(oidcLeeway).Before(time.Unix(int64(notBefore), 0)) {
+		return tokenIdentity{}, errors.New("token not yet valid")
+	}
+
+	identity := tokenIdentity{Roles: make(map[string]bool)}
+	identity.Tenant, _ = claims[oidcTenantClaim].(string)
+	if identity.Tenant == "" {
+		return tokenIdentity{}, fmt.Errorf("missing %s claim", oidcTenantClaim)
+	}
+	// A token without the roles claim gets no role, the IdP must grant access explicitly
+	for _, role := range claimValues(claims[oidcRolesClaim]) {
+		switch role {
+		case roleVerify, roleBatch, roleAuditor, roleAdmin:
+			identity.Roles[role] = true
+		}
+	}
+	return identity, nil
+}
+
+// 📌 Decode a base64url JSON segment of a JWT
+func decodeSegment(segment string, target any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, target)
+}
+
+// 📌 Values of a claim that is a string list, or a space-separated string like "scope"
+func claimValues(value any) []string {
+	switch typed := value.(type) {
+	case string:
+		return strings.Fields(typed)
+	case []any:
+		values := make([]string, 0, len(typed))
+		for _, item := range typed {
+			if text, ok := item.(string); ok {
+				values = append(values, text)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// 📌 Check whether a string or string-list claim contains a value
+func containsClaim(value any, expected string) bool {
+	for _, item := range claimValues(value) {
+		if item == expected {
+			return true
+		}
+	}
+	return false
+}
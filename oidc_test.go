@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// 📌 Sign claims as an RS256 JWT with the test key
+func signTestJWT(t *testing.T, key *rsa.PrivateKey, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatalf("signing: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestVerifyJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	oidcIssuer, oidcAudience = "https://idp.example.com", "vatbank"
+	jwksMu.Lock()
+	jwksKeys, jwksFetched = map[string]crypto.PublicKey{"test": &key.PublicKey}, time.Now()
+	jwksMu.Unlock()
+
+	expires := float64(time.Now().Add(time.Hour).Unix())
+	tests := []struct {
+		name    string
+		claims  map[string]any
+		wantErr string
+		roles   []string
+	}{
+		{"roles granted", map[string]any{"iss": "https://idp.example.com/", "aud": "vatbank", "sub": "erp", "exp": expires, "roles": []any{"verify", "batch", "unknown"}}, "", []string{"verify", "batch"}},
+		{"audience list", map[string]any{"iss": "https://idp.example.com", "aud": []any{"other", "vatbank"}, "sub": "erp", "exp": expires, "roles": "verify"}, "", []string{"verify"}},
+		{"missing roles claim", map[string]any{"iss": "https://idp.example.com", "aud": "vatbank", "sub": "erp", "exp": expires}, "", nil},
+		{"wrong audience", map[string]any{"iss": "https://idp.example.com", "aud": "other", "sub": "erp", "exp": expires, "roles": "admin"}, "wrong audience", nil},
+		{"missing audience", map[string]any{"iss": "https://idp.example.com", "sub": "erp", "exp": expires, "roles": "admin"}, "wrong audience", nil},
+		{"wrong issuer", map[string]any{"iss": "https://evil.example.com", "aud": "vatbank", "sub": "erp", "exp": expires}, "wrong issuer", nil},
+		{"expired", map[string]any{"iss": "https://idp.example.com", "aud": "vatbank", "sub": "erp", "exp": float64(time.Now().Add(-time.Hour).Unix())}, "token expired", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			identity, err := verifyJWT(signTestJWT(t, key, test.claims))
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Fatalf("verifyJWT error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifyJWT: %v", err)
+			}
+			if identity.Tenant != "erp" {
+				t.Errorf("tenant = %q, want erp", identity.Tenant)
+			}
+			if len(identity.Roles) != len(test.roles) {
+				t.Errorf("roles = %v, want %v", identity.Roles, test.roles)
+			}
+			for _, role := range test.roles {
+				if !identity.Roles[role] {
+					t.Errorf("roles = %v, missing %s", identity.Roles, role)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Largest accepted payment package
+const paymentsMaxBytes = 32 << 20
+
+// Single transfer of a payment package with its pass/block decision
+type TransferDecision struct {
+	Line     int    `json:"line"`
+	Decision string `json:"decision"`
+	// Why a transfer is blocked: NOT_MATCHED, NO_NIP, NO_ACCOUNT, FOREIGN_ACCOUNT, INVALID or UNVERIFIED
+	Reason       string    `json:"reason,omitempty"`
+	NIP          string    `json:"nip,omitempty"`
+	Account      string    `json:"account"`
+	Amount       string    `json:"amount,omitempty"`
+	Name         string    `json:"name,omitempty"`
+	Title        string    `json:"title,omitempty"`
+	Confirmation string    `json:"confirmation,omitempty"`
+	Result       *Response `json:"result,omitempty"`
+	// Client references from the CSV, stored with the confirmation
+	Correlation
+}
+
+// Pre-validation of a payment package, Passed + Blocked = Transfers
+type PaymentsReport struct {
+	Response  string             `json:"response"`
+	Format    string             `json:"format"`
+	Transfers int                `json:"transfers"`
+	Passed    int                `json:"passed"`
+	Blocked   int                `json:"blocked"`
+	Decisions []TransferDecision `json:"decisions"`
+}
+
+// Header names accepted for each column of a generic transfer CSV
+var paymentColumns = map[string][]string{
+	"nip":     {"nip"},
+	"account": {"account", "bank", "iban", "nrb", "rachunek"},
+	"amount":  {"amount", "kwota"},
+	"name":    {"name", "nazwa", "beneficiary", "odbiorca"},
+	"title":   {"title", "tytul", "tytuł", "reference"},
+	"invoice": {"invoiceid", "invoice_id", "invoice", "faktura"},
+	"payment": {"paymentid", "payment_id"},
+	"cost":    {"costcenter", "cost_center", "mpk"},
+}
+
+// 📌 Read the transfers of an Elixir-O (PLI) package or a CSV with a header row
+func parsePayments(r io.Reader) (string, []TransferDecision, error) {
+	input := bufio.NewReader(r)
+	firstLine, _ := input.Peek(4096)
+	reader := csv.NewReader(input)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	if line, _, _ := strings.Cut(string(firstLine), "\n"); strings.Count(line, ";") > strings.Count(line, ",") {
+		reader.Comma = ';'
+	}
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return "", nil, err
+	}
+	if len(records) == 0 {
+		return "", nil, errors.New("no transfers")
+	}
+
+	// Elixir-O records start with a three-digit transaction type, e.g. 110
+	if first := strings.TrimSpace(records[0][0]); len(first) == 3 && isDigits(first) && len(records[0]) >= 12 {
+		transfers := make([]TransferDecision, 0, len(records))
+		for i, record := range records {
+			if len(record) < 12 {
+				continue
+			}
+			title := strings.ReplaceAll(record[11], "|", " ")
+			transfers = append(transfers, TransferDecision{
+				Line:    i + 1,
+				Account: record[6],
+				Amount:  elixirAmount(record[2]),
+				Name:    strings.TrimSpace(strings.ReplaceAll(record[8], "|", " ")),
+				Title:   strings.TrimSpace(title),
+				NIP:     extractNIP(record[11]),
+			})
+		}
+		return "Elixir-O", transfers, nil
+	}
+
+	columns := map[string]int{}
+	for index, name := range records[0] {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		for column, names := range paymentColumns {
+			for _, candidate := range names {
+				if name == candidate {
+					columns[column] = index
+				}
+			}
+		}
+	}
+	if _, ok := columns["account"]; !ok {
+		return "", nil, errors.New("CSV header needs an account column (account, bank, iban, nrb or rachunek)")
+	}
+
+	field := func(record []string, column string) string {
+		if index, ok := columns[column]; ok && index < len(record) {
+			return strings.TrimSpace(record[index])
+		}
+		return ""
+	}
+	transfers := make([]TransferDecision, 0, len(records)-1)
+	for i, record := range records[1:] {
+		transfer := TransferDecision{
+			Line:    i + 2,
+			NIP:     strings.ReplaceAll(field(record, "nip"), "-", ""),
+			Account: field(record, "account"),
+			Amount:  field(record, "amount"),
+			Name:    field(record, "name"),
+			Title:   field(record, "title"),
+			Correlation: Correlation{
+				InvoiceID:  field(record, "invoice"),
+				PaymentID:  field(record, "payment"),
+				CostCenter: field(record, "cost"),
+			},
+		}
+		if transfer.NIP == "" {
+			transfer.NIP = extractNIP(transfer.Title)
+		}
+		transfers = append(transfers, transfer)
+	}
+	return "CSV", transfers, nil
+}
+
+// 📌 Format an Elixir amount in grosze as złoty (12345 → 123.45)
+func elixirAmount(value string) string {
+	grosze, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return strings.TrimSpace(value)
+	}
+	return strconv.FormatInt(grosze/100, 10) + "." + strconv.FormatInt(100+grosze%100, 10)[1:]
+}
+
+// 📌 Handle /verify/payments API endpoint, deciding pass or block for every transfer of a package
+func paymentsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Use POST"})
+		return
+	}
+
+	format, transfers, err := parsePayments(http.MaxBytesReader(w, r.Body, paymentsMaxBytes))
+	if err != nil {
+		recordError("invalid_payments")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Invalid payment package: " + err.Error()})
+		return
+	}
+
+	problem := datasetProblem()
+	if problem != "" {
+		if status, result := unavailableResponse(problem); status != http.StatusOK {
+			recordError("dataset_unavailable")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(result)
+			return
+		}
+	}
+
+	tenant := tenantFromRequest(r)
+	var items []BatchItem
+	var itemIndexes []int
+	results := make([]Response, len(transfers))
+	for i := range transfers {
+		transfer := &transfers[i]
+		transfer.Decision = "BLOCK"
+		transfer.Account = strings.TrimPrefix(normalizeAccount(transfer.Account), "PL")
+		switch {
+		case transfer.Account == "":
+			transfer.Reason = "NO_ACCOUNT"
+		case !isDigits(transfer.Account):
+			transfer.Reason = "FOREIGN_ACCOUNT"
+		case transfer.NIP == "":
+			transfer.Reason = "NO_NIP"
+		case problem != "":
+			transfer.Reason = "UNVERIFIED"
+		}
+		if transfer.Reason != "" {
+			continue
+		}
+		category, fields := validateInput(transfer.NIP, transfer.Account)
+		if correlationFields := validateCorrelation(transfer.Correlation.orNil()); category == "" && len(correlationFields) > 0 {
+			category, fields = "invalid_correlation", correlationFields
+		}
+		if category != "" {
+			recordError(category)
+			transfer.Reason = "INVALID"
+			result := validationResponse(fields)
+			transfer.Result = &result
+			continue
+		}
+		items = append(items, BatchItem{NIP: transfer.NIP, Bank: transfer.Account})
+		itemIndexes = append(itemIndexes, i)
+	}
+	verifyBatch(items, func(indexes []int, result Response) {
+		// Every transfer index belongs to exactly one unique item
+		for _, index := range indexes {
+			results[itemIndexes[index]] = result
+		}
+	})
+
+	report := PaymentsReport{Response: "OK", Format: format, Transfers: len(transfers), Decisions: transfers}
+	for _, index := range itemIndexes {
+		transfer := &transfers[index]
+		result := results[index]
+		transfer.Result = &result
+		if result.Bank == "MATCHED" {
+			transfer.Decision = "PASS"
+		} else {
+			transfer.Reason = "NOT_MATCHED"
+		}
+		confirmed := result
+		confirmed.Correlation = transfer.Correlation.orNil()
+		transfer.Confirmation = issueConfirmation(tenant, "payments", transfer.NIP, transfer.Account, confirmed)
+		recordRequest(transfer.NIP, transfer.Account, result)
+		recordUsage(tenant, result.Status)
+		recordStats(result, true)
+	}
+	for _, transfer := range transfers {
+		if transfer.Decision == "PASS" {
+			report.Passed++
+		} else {
+			report.Blocked++
+		}
+	}
+
+	if wantsXLSX(r) {
+		startXLSXDownload(w, "payments.xlsx")
+		writeXLSX(w, paymentsWorkbook(report))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// 📌 Summary and per-transfer sheets of a payment package pre-validation
+func paymentsWorkbook(report PaymentsReport) []xlsxSheet {
+	summary := [][]any{{"Summary", ""}, {"Format", report.Format}, {"Transfers", report.Transfers}, {"Passed", report.Passed}, {"Blocked", report.Blocked}}
+	rows := [][]any{{"Line", "Decision", "Reason", "NIP", "Account", "Amount", "Name", "Title", "Invoice ID", "Payment ID", "Cost Center", "Status", "Bank", "Date", "Confirmation"}}
+	for _, transfer := range report.Decisions {
+		status, bank, date := "", "", ""
+		if transfer.Result != nil {
+			status, bank, date = transfer.Result.Status, transfer.Result.Bank, transfer.Result.Date
+			if status == "" {
+				status = transfer.Result.Message
+			}
+		}
+		rows = append(rows, []any{transfer.Line, transfer.Decision, transfer.Reason, transfer.NIP, transfer.Account, transfer.Amount, transfer.Name, transfer.Title, transfer.InvoiceID, transfer.PaymentID, transfer.CostCenter, status, bank, date, transfer.Confirmation})
+	}
+	return []xlsxSheet{{Name: "Summary", Rows: summary}, {Name: "Transfers", Rows: rows}}
+}
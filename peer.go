@@ -0,0 +1,80 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// Base URL of a peer instance whose /snapshot is preferred over DATA_SOURCE
+	peerURL   = strings.TrimSuffix(getEnv("PEER_URL", ""), "/")
+	peerToken = getSecret("PEER_TOKEN", adminToken)
+
+	peerClient = &http.Client{Timeout: 30 * time.Minute}
+
+	errNotModified = errors.New("dataset not modified")
+)
+
+// 📌 Fetch the processed dataset from a peer's /snapshot endpoint
+func fetchFromPeer(baseURL string) (string, func(), error) {
+	log.Printf("[INFO] Downloading snapshot from peer %s", baseURL)
+
+	req, err := http.NewRequest(http.MethodGet, baseURL+"/snapshot", nil)
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+readSecret(&peerToken))
+	req.Header.Set("If-None-Match", datasetETag())
+
+	resp, err := peerClient.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return "", nil, errNotModified
+	default:
+		return "", nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	date := resp.Header.Get("X-Data-Date")
+	if len(date) != 8 || strings.Trim(date, "0123456789") != "" {
+		return "", nil, fmt.Errorf("invalid data date %q", date)
+	}
+
+	workDir, err := os.MkdirTemp(tmpDir, "peer-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { _ = os.RemoveAll(workDir) }
+
+	jsonPath := filepath.Join(workDir, date+".json")
+	if err := writeDecompressed(resp.Body, jsonPath); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	log.Printf("[INFO] Downloaded snapshot for %s from peer", date)
+	return jsonPath, cleanup, nil
+}
+
+// 📌 Decompress a gzip stream into a file
+func writeDecompressed(r io.Reader, path string) error {
+	decompressed, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer decompressed.Close()
+	return writeStream(decompressed, path)
+}
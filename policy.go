@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+var (
+	// Behavior without a usable dataset: "closed" refuses with 503, "open" answers UNVERIFIED
+	unavailablePolicy = getEnv("UNAVAILABLE_POLICY", "closed")
+	// Datasets older than this are treated as unusable, 0 disables the check
+	maxDataAge = getEnvDuration("MAX_DATA_AGE", 0)
+)
+
+// 📌 Describe why the loaded dataset cannot be used, empty when it can
+func datasetProblem() string {
+	if problem := chaosStaleProblem(); problem != "" {
+		return problem
+	}
+	if mode == "mock" || mode == "proxy" {
+		return ""
+	}
+
+	mu.RLock()
+	loaded := activeHashes != nil
+	currentDataDate := dataDate
+	mu.RUnlock()
+
+	if !loaded {
+		return "No dataset loaded yet"
+	}
+	if age, ok := dataAge(currentDataDate); maxDataAge > 0 && ok && age > maxDataAge {
+		return "Dataset is older than " + maxDataAge.String()
+	}
+	return ""
+}
+
+// 📌 Response for an unusable dataset according to UNAVAILABLE_POLICY
+func unavailableResponse(problem string) (int, Response) {
+	if unavailablePolicy == "open" {
+		mu.RLock()
+		currentDataDate := dataDate
+		loaded := activeHashes != nil
+		mu.RUnlock()
+
+		result := Response{Response: "OK", Status: "UNVERIFIED", Bank: "UNVERIFIED", Message: problem, AccountAssigned: json.RawMessage("null"), match: "none"}
+		if loaded {
+			result.Date = currentDataDate
+			annotateDataAge(&result)
+		}
+		return http.StatusOK, result
+	}
+
+	return http.StatusServiceUnavailable, Response{Response: "ERROR", Message: problem}
+}
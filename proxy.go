@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// Official whitelist API answering MODE=proxy requests
+	mfAPIURL = getEnv("MF_API_URL", "https://wl-api.mf.gov.pl")
+	// Calls to the MF API per day (Europe/Warsaw), 0 for no local quota
+	mfAPIQuota = getEnvInt("MF_API_QUOTA", 0)
+
+	mfAPIClient = &http.Client{Timeout: 30 * time.Second}
+
+	proxyCache    = make(map[string]*proxyCall)
+	proxyDay      string
+	proxyCalls    int
+	proxyBlocked  time.Time
+	proxyMu       sync.Mutex
+	errMFQuota    = errors.New("MF API quota exhausted")
+	errMFThrottle = errors.New("MF API is throttling requests")
+)
+
+// Single MF API lookup, shared by concurrent requests for the same key and cached for the day
+type proxyCall struct {
+	done   chan struct{}
+	result mfSubject
+	err    error
+}
+
+// Outcome of an MF API search or account check
+type mfSubject struct {
+	Found          bool
+	StatusVat      string
+	Accounts       map[string]bool
+	HasVirtual     bool
+	AccountChecked bool
+	RequestID      string
+}
+
+// 📌 Call the MF API, counting the call against MF_API_QUOTA and honoring its throttling
+func mfAPIGet(path string, target any) error {
+	proxyMu.Lock()
+	now := time.Now()
+	if now.Before(proxyBlocked) {
+		proxyMu.Unlock()
+		return errMFThrottle
+	}
+	if mfAPIQuota > 0 && proxyCalls >= mfAPIQuota {
+		proxyMu.Unlock()
+		return errMFQuota
+	}
+	proxyCalls++
+	proxyMu.Unlock()
+
+	resp, err := mfAPIClient.Get(mfAPIURL + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var reply struct {
+		Code    string          `json:"code"`
+		Message string          `json:"message"`
+		Result  json.RawMessage `json:"result"`
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		wait := time.Minute
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			wait = time.Duration(seconds) * time.Second
+		}
+		proxyMu.Lock()
+		proxyBlocked = time.Now().Add(wait)
+		proxyMu.Unlock()
+		log.Printf("[WARNING] MF API throttled requests, pausing calls for %s", wait)
+		return errMFThrottle
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(nil, resp.Body, 1<<20)).Decode(&reply); err != nil {
+		return fmt.Errorf("MF API returned %s", resp.Status)
+	}
+	if reply.Code != "" || resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("MF API error %s: %s", reply.Code, reply.Message)
+	}
+	return json.Unmarshal(reply.Result, target)
+}
+
+// 📌 Search a NIP in the MF API: VAT status, registered accounts and whether virtual accounts exist
+func mfSearch(nip string, date string) (mfSubject, error) {
+	var result struct {
+		Subject *struct {
+			StatusVat          string   `json:"statusVat"`
+			AccountNumbers     []string `json:"accountNumbers"`
+			HasVirtualAccounts bool     `json:"hasVirtualAccounts"`
+		} `json:"subject"`
+		RequestID string `json:"requestId"`
+	}
+	if err := mfAPIGet("/api/search/nip/"+url.PathEscape(nip)+"?date="+date, &result); err != nil {
+		return mfSubject{}, err
+	}
+	subject := mfSubject{RequestID: result.RequestID, Accounts: make(map[string]bool)}
+	if result.Subject != nil {
+		subject.Found, subject.StatusVat, subject.HasVirtual = true, result.Subject.StatusVat, result.Subject.HasVirtualAccounts
+		for _, account := range result.Subject.AccountNumbers {
+			subject.Accounts[account] = true
+		}
+	}
+	return subject, nil
+}
+
+// 📌 Check a NIP and account pair in the MF API, which also resolves virtual accounts
+func mfCheck(nip string, bank string, date string) (mfSubject, error) {
+	var result struct {
+		AccountAssigned string `json:"accountAssigned"`
+		RequestID       string `json:"requestId"`
+	}
+	if err := mfAPIGet("/api/check/nip/"+url.PathEscape(nip)+"/bank-account/"+url.PathEscape(bank)+"?date="+date, &result); err != nil {
+		return mfSubject{}, err
+	}
+	return mfSubject{AccountChecked: result.AccountAssigned == "TAK", RequestID: result.RequestID}, nil
+}
+
+// 📌 Run an MF API lookup once per key and day, concurrent requests for the key wait for the same call
+func proxyCached(key string, date string, fetch func() (mfSubject, error)) (mfSubject, error) {
+	proxyMu.Lock()
+	if proxyDay != date {
+		// Answers are valid for their date only, and the MF quota is daily
+		proxyCache = make(map[string]*proxyCall)
+		proxyDay, proxyCalls = date, 0
+	}
+	if call, ok := proxyCache[key]; ok {
+		proxyMu.Unlock()
+		<-call.done
+		return call.result, call.err
+	}
+	call := &proxyCall{done: make(chan struct{})}
+	proxyCache[key] = call
+	proxyMu.Unlock()
+
+	call.result, call.err = fetch()
+	if call.err != nil {
+		// Failures are not cached, the next request tries again
+		proxyMu.Lock()
+		if proxyCache[key] == call {
+			delete(proxyCache, key)
+		}
+		proxyMu.Unlock()
+	}
+	close(call.done)
+	return call.result, call.err
+}
+
+// 📌 Verify through the MF API (MODE=proxy) and normalize the answer to this service's schema
+func proxyVerify(nip string, bank string, trace *Trace) Response {
+	now := time.Now().In(warsaw)
+	date := now.Format("20060102")
+	apiDate := now.Format("2006-01-02")
+
+	subject, err := proxyCached(nip, date, func() (mfSubject, error) { return mfSearch(nip, apiDate) })
+	if err != nil {
+		return proxyError(err, now)
+	}
+	trace.add(TraceStep{Check: "mf-search", Input: nip, Outcome: subject.StatusVat})
+
+	result := Response{Response: "OK", Date: date, RequestID: subject.RequestID, match: "none"}
+	switch {
+	case !subject.Found:
+		result.Status, result.Bank = "NOT_FOUND", "NOT_FOUND"
+		return result
+	case subject.StatusVat == "Czynny":
+		result.Status = "ACTIVE"
+	case subject.StatusVat == "Zwolniony":
+		result.Status = "EXEMPT"
+	default:
+		result.Status, result.Bank = "NOT_FOUND", "NOT_FOUND"
+		return result
+	}
+
+	result.Bank = "NA"
+	if bank == "" {
+		return result
+	}
+	if subject.Accounts[bank] {
+		result.Bank, result.match = "MATCHED", "direct"
+		return result
+	}
+	result.Bank = "NOT_FOUND"
+	if subject.HasVirtual {
+		// Virtual (masked) accounts are not listed, only the check endpoint resolves them
+		checked, err := proxyCached(nip+"/"+bank, date, func() (mfSubject, error) { return mfCheck(nip, bank, apiDate) })
+		if err != nil {
+			return proxyError(err, now)
+		}
+		trace.add(TraceStep{Check: "mf-check", Input: nip + bank, Outcome: strconv.FormatBool(checked.AccountChecked)})
+		result.RequestID = checked.RequestID
+		if checked.AccountChecked {
+			result.Bank, result.match = "MATCHED", "masked"
+		}
+	}
+	return result
+}
+
+// 📌 Error answer of a failed MF API call, 429 with Retry-After when quota or throttling stopped it
+func proxyError(err error, now time.Time) Response {
+	log.Printf("[WARNING] MF API lookup failed: %v", err)
+	switch {
+	case errors.Is(err, errMFQuota):
+		midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, warsaw)
+		return Response{Response: "ERROR", Message: "Daily MF API quota of " + strconv.Itoa(mfAPIQuota) + " calls is used up", code: http.StatusTooManyRequests, retryAfter: midnight.Sub(now)}
+	case errors.Is(err, errMFThrottle):
+		proxyMu.Lock()
+		wait := time.Until(proxyBlocked)
+		proxyMu.Unlock()
+		return Response{Response: "ERROR", Message: "MF API is throttling requests, retry later", code: http.StatusTooManyRequests, retryAfter: wait}
+	}
+	return Response{Response: "ERROR", Message: "MF API unavailable", code: http.StatusBadGateway}
+}
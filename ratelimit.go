@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Retry-After of a 503 while no download retry is scheduled, e.g. during the first download
+const unavailableRetryAfter = time.Minute
+
+var (
+	// Requests per RATE_LIMIT_WINDOW for each API key (or client IP without keys), 0 disables the limit
+	rateLimit       = getEnvInt("RATE_LIMIT", 0)
+	rateLimitWindow = getEnvDuration("RATE_LIMIT_WINDOW", time.Minute)
+
+	rateWindows    = make(map[string]*rateWindow)
+	rateLastSweep  time.Time
+	rateLimitMu    sync.Mutex
+	nextFetchRetry time.Time
+	nextFetchMu    sync.Mutex
+)
+
+// Fixed window of a single client
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// Adds rate limit headers to every answer of the wrapped handler, and Retry-After to 429 and 503 answers
+type backoffWriter struct {
+	http.ResponseWriter
+	rate        *rateStatus
+	wroteHeader bool
+}
+
+// Rate limit state of a client at the time of its request
+type rateStatus struct {
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+func (w *backoffWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if status == http.StatusServiceUnavailable || status == http.StatusTooManyRequests {
+			setBackoffHeaders(w.Header(), status, w.rate, time.Now())
+		} else {
+			// Batch clients pace themselves on the remaining count of successful answers too
+			setRateHeaders(w.Header(), w.rate)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *backoffWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *backoffWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// 📌 Remember when the failed download is retried, so 503 answers can tell clients when to come back
+func scheduleFetchRetry(at time.Time) {
+	nextFetchMu.Lock()
+	defer nextFetchMu.Unlock()
+	nextFetchRetry = at
+}
+
+// 📌 Set the X-RateLimit-* headers of a caller, nothing without RATE_LIMIT
+func setRateHeaders(header http.Header, rate *rateStatus) {
+	if rate != nil {
+		header.Set("X-RateLimit-Limit", strconv.Itoa(rate.limit))
+		header.Set("X-RateLimit-Remaining", strconv.Itoa(rate.remaining))
+		header.Set("X-RateLimit-Reset", strconv.FormatInt(rate.reset.Unix(), 10))
+	}
+}
+
+// 📌 Set Retry-After and, with RATE_LIMIT, the X-RateLimit-* headers of a caller
+func setBackoffHeaders(header http.Header, status int, rate *rateStatus, now time.Time) {
+	setRateHeaders(header, rate)
+	if header.Get("Retry-After") != "" {
+		return
+	}
+
+	wait := unavailableRetryAfter
+	if status == http.StatusTooManyRequests && rate != nil {
+		wait = rate.reset.Sub(now)
+	} else {
+		nextFetchMu.Lock()
+		if nextFetchRetry.After(now) {
+			wait = nextFetchRetry.Sub(now)
+		}
+		nextFetchMu.Unlock()
+	}
+	header.Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+}
+
+// 📌 Count a request of a client in its current window
+func takeRequest(client string, now time.Time) (rateStatus, bool) {
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+
+	// Drop windows of clients that went quiet, at most once per window length
+	if now.Sub(rateLastSweep) > rateLimitWindow {
+		for key, window := range rateWindows {
+			if now.Sub(window.start) >= rateLimitWindow {
+				delete(rateWindows, key)
+			}
+		}
+		rateLastSweep = now
+	}
+
+	window, ok := rateWindows[client]
+	if !ok || now.Sub(window.start) >= rateLimitWindow {
+		window = &rateWindow{start: now}
+		rateWindows[client] = window
+	}
+	status := rateStatus{limit: rateLimit, reset: window.start.Add(rateLimitWindow)}
+	if window.count >= rateLimit {
+		return status, false
+	}
+	window.count++
+	status.remaining = rateLimit - window.count
+	return status, true
+}
+
+// 📌 Client a request is counted for: the tenant, or the remote IP when the endpoint is open
+func rateLimitClient(r *http.Request) string {
+	if tenant := tenantFromRequest(r); tenant != "" {
+		return "tenant:" + tenant
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// 📌 Reject requests over RATE_LIMIT with 429, and tell clients of 429 and 503 answers when to retry
+func limitRate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writer := &backoffWriter{ResponseWriter: w}
+		if rateLimit > 0 {
+			rate, ok := takeRequest(rateLimitClient(r), time.Now())
+			writer.rate = &rate
+			if !ok {
+				recordUsage(tenantFromRequest(r), "ERROR")
+				recordError("rate_limited")
+				writer.WriteHeader(http.StatusTooManyRequests)
+				json.NewEncoder(writer).Encode(Response{Response: "ERROR", Message: "Rate limit of " + strconv.Itoa(rateLimit) + " requests per " + rateLimitWindow.String() + " exceeded"})
+				return
+			}
+		}
+		next(writer, r)
+	}
+}
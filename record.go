@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// Verification requests are appended to RECORD_FILE when set
+	recordFile = getEnv("RECORD_FILE", "")
+	// "anonymized" stores SHA-256 digests of NIP/account, "raw" stores them as sent
+	recordMode = getEnv("RECORD_MODE", "anonymized")
+
+	recorder   *os.File
+	recorderMu sync.Mutex
+)
+
+// Recorded verification request with the response it received
+type RecordedRequest struct {
+	Time     time.Time `json:"time"`
+	NIP      string    `json:"nip"`
+	Bank     string    `json:"bank,omitempty"`
+	Raw      bool      `json:"raw"`
+	Response Response  `json:"response"`
+}
+
+// 📌 Open the record file for appending
+func openRecorder() error {
+	if recordFile == "" {
+		return nil
+	}
+	if recordMode != "raw" && recordMode != "anonymized" {
+		return fmt.Errorf("unknown RECORD_MODE: %s", recordMode)
+	}
+	if err := initEncryption(); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(recordFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	recorder = file
+
+	log.Printf("[INFO] Recording verification requests (%s) to %s", recordMode, recordFile)
+	return nil
+}
+
+// 📌 Digest a value so it can be correlated but not read back
+func anonymize(value string) string {
+	if value == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// 📌 Append a verification request to the record file
+func recordRequest(nip string, bank string, result Response) {
+	if recorder == nil {
+		return
+	}
+
+	entry := RecordedRequest{Time: time.Now(), NIP: nip, Bank: bank, Raw: true, Response: result}
+	if recordMode == "anonymized" {
+		entry.NIP, entry.Bank, entry.Raw = anonymize(nip), anonymize(bank), false
+	}
+
+	line, err := json.Marshal(entry)
+	if err == nil {
+		line, err = sealRecord(line)
+	}
+	if err == nil {
+		recorderMu.Lock()
+		_, err = recorder.Write(append(line, '\n'))
+		recorderMu.Unlock()
+	}
+	if err != nil {
+		log.Printf("[ERROR] Recording request failed: %v", err)
+	}
+}
+
+// 📌 Replay recorded requests against a target instance and report differences
+func runReplay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	file := flags.String("file", recordFile, "recorded requests file")
+	target := flags.String("target", "http://localhost:8080", "base URL of the instance to replay against")
+	concurrency := flags.Int("concurrency", 4, "number of parallel requests")
+	flags.Parse(args)
+
+	input, err := os.Open(*file)
+	if err != nil {
+		log.Printf("[ERROR] Opening recorded requests failed: %v", err)
+		return 1
+	}
+	defer input.Close()
+
+	var (
+		total, matched, differed, skipped, failed int
+		countMu                                   sync.Mutex
+		wg                                        sync.WaitGroup
+	)
+	jobs := make(chan RecordedRequest)
+	client := &http.Client{Timeout: 5 * time.Minute}
+
+	for i := 0; i < max(*concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range jobs {
+				query := url.Values{"nip": {entry.NIP}}
+				if entry.Bank != "" {
+					query.Set("bank", entry.Bank)
+				}
+
+				var replayed Response
+				resp, err := client.Get(*target + "/verify?" + query.Encode())
+				if err == nil {
+					err = json.NewDecoder(resp.Body).Decode(&replayed)
+					resp.Body.Close()
+				}
+
+				countMu.Lock()
+				switch {
+				case err != nil:
+					failed++
+					log.Printf("[ERROR] Replaying NIP %s failed: %v", entry.NIP, err)
+				case replayed.Response == entry.Response.Response && replayed.Status == entry.Response.Status && replayed.Bank == entry.Response.Bank:
+					matched++
+				default:
+					differed++
+					log.Printf("[WARNING] Difference for NIP %s, bank %s: recorded %s/%s (date %s), replayed %s/%s (date %s)",
+						entry.NIP, entry.Bank, entry.Response.Status, entry.Response.Bank, entry.Response.Date,
+						replayed.Status, replayed.Bank, replayed.Date)
+				}
+				countMu.Unlock()
+			}
+		}()
+	}
+
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		var entry RecordedRequest
+		line, err := openRecord(scanner.Bytes())
+		if err == nil {
+			err = json.Unmarshal(line, &entry)
+		}
+		if err != nil {
+			log.Printf("[WARNING] Skipping unreadable record: %v", err)
+			skipped++
+			continue
+		}
+		total++
+		// Anonymized records cannot be sent again
+		if !entry.Raw {
+			skipped++
+			continue
+		}
+		jobs <- entry
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := scanner.Err(); err != nil {
+		log.Printf("[ERROR] Reading recorded requests failed: %v", err)
+		return 1
+	}
+
+	log.Printf("[INFO] Replayed %d records: %d matched, %d differed, %d skipped, %d failed",
+		total, matched, differed, skipped, failed)
+	if matched+differed+failed == 0 {
+		log.Printf("[ERROR] No record could be replayed, record with RECORD_MODE=raw (anonymized records hold only digests)")
+		return 1
+	}
+	if differed > 0 || failed > 0 {
+		return 1
+	}
+	return 0
+}
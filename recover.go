@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"strings"
+)
+
+// 📌 Random reference that links an error response to its log line
+func newIncidentID() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// 📌 Log a recovered panic on a single line and return its incident ID
+func logPanic(value any, context string) string {
+	incident := newIncidentID()
+	log.Printf("[ERROR] Panic in %s at %s (incident %s): %v", context, panicLocation(), incident, value)
+	recordError("internal")
+	return incident
+}
+
+// 📌 File and line of the code that panicked, skipping runtime and recovery frames
+func panicLocation() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "runtime.") && !strings.HasSuffix(frame.File, "/recover.go") {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return "unknown location"
+		}
+	}
+}
+
+// 📌 Turn handler panics into a 500 JSON error with an incident ID
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			value := recover()
+			if value == nil {
+				return
+			}
+			// ErrAbortHandler is the documented way to abort a response
+			if value == http.ErrAbortHandler {
+				panic(value)
+			}
+
+			incident := logPanic(value, r.Method+" "+r.URL.Path)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("X-Incident-ID", incident)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Internal error", Incident: incident})
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// 📌 Verify on a worker goroutine, where a panic would otherwise stop the whole server
+func verifyRecovered(nip, bank string) (result Response) {
+	defer func() {
+		if value := recover(); value != nil {
+			result = Response{Response: "ERROR", Message: "Internal error", Incident: logPanic(value, "batch verification")}
+		}
+	}()
+	return verify(nip, bank)
+}
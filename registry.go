@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// National registry served by this instance, e.g. the Polish VAT whitelist
+//
+// A new country is added as a type implementing Registry in its own file,
+// listed in availableRegistries and enabled through REGISTRIES. Its data
+// source, refresh loop and endpoints stay private to the implementation.
+type Registry interface {
+	// Short lowercase code, also the URL prefix of the registry's endpoints (/pl/verify)
+	Name() string
+	Description() string
+	// Start loading and refreshing the data in the background
+	Start()
+	// Register the endpoints of the registry on mux
+	Routes(mux *http.ServeMux)
+	// Readiness and data date of the loaded data
+	Status() RegistryStatus
+}
+
+// Public state of a registry, returned by /registries
+type RegistryStatus struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Ready       bool   `json:"ready"`
+	DataDate    string `json:"dataDate,omitempty"`
+	Problem     string `json:"problem,omitempty"`
+}
+
+var (
+	// Every registry compiled into the binary
+	availableRegistries = map[string]Registry{
+		"pl": polishRegistry{},
+	}
+	// Registries enabled by REGISTRIES (comma-separated codes)
+	registryNames = getEnv("REGISTRIES", "pl")
+	registries    []Registry
+)
+
+// 📌 Resolve REGISTRIES into the enabled registries
+func enableRegistries() error {
+	registries = nil
+	for _, name := range strings.Split(registryNames, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		registry, ok := availableRegistries[name]
+		if !ok {
+			return fmt.Errorf("unknown registry %q", name)
+		}
+		registries = append(registries, registry)
+	}
+	if len(registries) == 0 {
+		return fmt.Errorf("no registry enabled")
+	}
+	return nil
+}
+
+// 📌 Register a handler at the registry prefix, and also unprefixed when legacy paths apply
+func registryRoute(mux *http.ServeMux, registry Registry, legacy bool, path string, handler http.HandlerFunc) {
+	mux.HandleFunc("/"+registry.Name()+path, handler)
+	if legacy {
+		mux.HandleFunc(path, handler)
+	}
+}
+
+// 📌 Handle /registries API endpoint
+func registriesHandler(w http.ResponseWriter, r *http.Request) {
+	statuses := make([]RegistryStatus, 0, len(registries))
+	for _, registry := range registries {
+		statuses = append(statuses, registry.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log"
+	"net/http"
+)
+
+// Polish VAT taxpayer whitelist (Biała lista podatników VAT) from the Ministry of Finance flat file
+type polishRegistry struct{}
+
+func (polishRegistry) Name() string { return "pl" }
+
+func (polishRegistry) Description() string {
+	return "Polish VAT taxpayer whitelist (Ministry of Finance flat file)"
+}
+
+// 📌 Start the dataset updater, mock and proxy modes need no data
+func (polishRegistry) Start() {
+	if mode == "mock" {
+		log.Printf("[INFO] Mock mode enabled, responses are derived from NIP and account rules")
+		return
+	}
+	if mode == "proxy" {
+		log.Printf("[INFO] Proxy mode enabled, verifications are answered by %s", mfAPIURL)
+		return
+	}
+	if mode == "serverless" {
+		startServerless()
+		return
+	}
+	if leaderElection {
+		if err := startLeaderElection(); err != nil {
+			log.Fatalf("[ERROR] Leader election is not possible: %v", err)
+		}
+	}
+	go updateData()
+}
+
+// 📌 Register the whitelist endpoints, unprefixed paths are kept while it is the first registry
+func (registry polishRegistry) Routes(mux *http.ServeMux) {
+	legacy := registries[0].Name() == registry.Name()
+	registryRoute(mux, registry, legacy, "/verify", requireRole(roleVerify, selectFields(verifyHandler)))
+	registryRoute(mux, registry, legacy, "/verify/hash", requireRole(roleVerify, hashLookupHandler))
+	registryRoute(mux, registry, legacy, "/verify/batch", requireRole(roleBatch, selectFields(idempotent(batchHandler))))
+	registryRoute(mux, registry, legacy, "/verify/ksef", requireRole(roleBatch, ksefHandler))
+	registryRoute(mux, registry, legacy, "/verify/jpk", requireRole(roleBatch, jpkHandler))
+	registryRoute(mux, registry, legacy, "/verify/statement", requireRole(roleBatch, statementHandler))
+	registryRoute(mux, registry, legacy, "/verify/payments", requireRole(roleBatch, idempotent(paymentsHandler)))
+	registryRoute(mux, registry, legacy, "/hash", requireRole(roleVerify, hashHandler))
+	registryRoute(mux, registry, legacy, "/account", requireRole(roleVerify, accountHandler))
+	registryRoute(mux, registry, legacy, "/entity/{nip}", requireRole(roleVerify, entityHandler))
+	registryRoute(mux, registry, legacy, "/snapshot", requireRole(roleAdmin, snapshotHandler))
+	registryRoute(mux, registry, legacy, "/admin/reload", requireRole(roleAdmin, reloadHandler))
+	registryRoute(mux, registry, legacy, "/admin/masks", requireRole(roleAdmin, masksHandler))
+}
+
+// 📌 Readiness of the loaded whitelist dataset
+func (registry polishRegistry) Status() RegistryStatus {
+	mu.RLock()
+	date, loaded := dataDate, activeHashes != nil
+	mu.RUnlock()
+
+	status := RegistryStatus{Name: registry.Name(), Description: registry.Description()}
+	if loaded {
+		status.DataDate = date
+	}
+	if mode == "mock" || mode == "proxy" {
+		status.Ready = true
+		return status
+	}
+	status.Problem = datasetProblem()
+	status.Ready = status.Problem == ""
+	return status
+}
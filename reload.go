@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Flat file or directory activated on SIGHUP or POST /admin/reload
+var reloadPath = getEnv("RELOAD_PATH", dataPath)
+
+// 📌 Load the flat file at RELOAD_PATH (or the newest one in that directory)
+func reloadFromDisk() error {
+	if reloadPath == "" {
+		return errors.New("RELOAD_PATH is not set")
+	}
+
+	path, err := resolvePath(reloadPath)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		newest, _, err := newestDataFile(path)
+		if err != nil {
+			return err
+		}
+		if newest == "" {
+			return errors.New("no flat file found in " + path)
+		}
+		path = newest
+	}
+
+	log.Printf("[INFO] Reloading dataset from %s", path)
+	return loadLocalFile(path)
+}
+
+// 📌 Reload the dataset from disk on SIGHUP
+func handleReloadSignal() {
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
+	for range reload {
+		if err := reloadFromDisk(); err != nil {
+			log.Printf("[ERROR] Reload failed: %v", err)
+			continue
+		}
+		log.Printf("[INFO] Reload completed successfully.")
+	}
+}
+
+// 📌 Handle /admin/reload API endpoint
+func reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Use POST"})
+		return
+	}
+
+	if err := reloadFromDisk(); err != nil {
+		log.Printf("[ERROR] Reload failed: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Reload failed: " + err.Error()})
+		return
+	}
+
+	mu.RLock()
+	currentDataDate := dataDate
+	mu.RUnlock()
+	json.NewEncoder(w).Encode(Response{Response: "OK", Date: currentDataDate, Message: "Dataset reloaded"})
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// Write a report to DATA_DIR/reports after every dataset load
+	dailyReports = getEnvBool("DAILY_REPORTS", true)
+	reportsDir   = filepath.Join(dataDir, "reports")
+	// Receives every report as a JSON POST, signed like scheduled payment callbacks when CALLBACK_SECRET is set
+	reportWebhookURL = getEnv("REPORT_WEBHOOK_URL", "")
+	// The webhook is set by the operator and may be internal, unlike client-given callback URLs
+	reportClient = &http.Client{Timeout: 30 * time.Second}
+	// Mails every report through this SMTP server (host:port) to REPORT_MAIL_TO
+	reportSMTPAddr     = getEnv("REPORT_SMTP_ADDR", "")
+	reportSMTPUsername = getSecret("REPORT_SMTP_USERNAME", "")
+	reportSMTPPassword = getSecret("REPORT_SMTP_PASSWORD", "")
+	reportMailFrom     = getEnv("REPORT_MAIL_FROM", "")
+	reportMailTo       = splitList(getEnv("REPORT_MAIL_TO", ""))
+
+	// Download time of the dataset being loaded, set by the update loop
+	lastFetchDuration time.Duration
+	reportMu          sync.Mutex
+)
+
+// Summary of a data date for the compliance file, updated by every load of that date
+type DailyReport struct {
+	DataDate    string    `json:"dataDate"`
+	GeneratedAt time.Time `json:"generatedAt"`
+	Dataset     struct {
+		ActiveHashes int `json:"activeHashes"`
+		ExemptHashes int `json:"exemptHashes"`
+		Masks        int `json:"masks"`
+	} `json:"dataset"`
+	// Verifications in the 24 hours before the report
+	Checks struct {
+		Total uint64 `json:"total"`
+		StatsWindow
+	} `json:"checks"`
+	Updates          []ReportUpdate `json:"updates"`
+	WatchlistChanges []WatchEntry   `json:"watchlistChanges"`
+}
+
+// A load of the data date and how long it took
+type ReportUpdate struct {
+	LoadedAt time.Time `json:"loadedAt"`
+	Source   string    `json:"source"`
+	// Download and extraction, absent when the file was read from disk
+	FetchSeconds float64 `json:"fetchSeconds,omitempty"`
+	LoadSeconds  float64 `json:"loadSeconds"`
+}
+
+// 📌 Remember how long fetching the dataset took, for the report of its load
+func noteFetchDuration(duration time.Duration) {
+	reportMu.Lock()
+	lastFetchDuration = duration
+	reportMu.Unlock()
+}
+
+// 📌 Recheck the watchlist after a load, then write and deliver the report of the data date
+func reportRefresh(loadDuration time.Duration) {
+	changes := recheckWatchlist()
+	if !dailyReports {
+		return
+	}
+
+	mu.RLock()
+	date, active, exempt, maskCount := dataDate, len(activeHashes), len(exemptHashes), len(masks)
+	mu.RUnlock()
+
+	reportMu.Lock()
+	fetchDuration := lastFetchDuration
+	lastFetchDuration = 0
+	report, err := readReport(date)
+	if err != nil {
+		report = &DailyReport{DataDate: date, Updates: []ReportUpdate{}, WatchlistChanges: []WatchEntry{}}
+	}
+	report.GeneratedAt = time.Now().UTC()
+	report.Dataset.ActiveHashes, report.Dataset.ExemptHashes, report.Dataset.Masks = active, exempt, maskCount
+	report.Checks.StatsWindow = statsWindow(24 * 60)
+	report.Checks.Total = 0
+	for _, count := range report.Checks.Results {
+		report.Checks.Total += count
+	}
+	report.Updates = append(report.Updates, ReportUpdate{
+		LoadedAt:     report.GeneratedAt,
+		Source:       dataSource,
+		FetchSeconds: fetchDuration.Seconds(),
+		LoadSeconds:  loadDuration.Seconds(),
+	})
+	report.WatchlistChanges = append(report.WatchlistChanges, changes...)
+	err = writeReport(report)
+	reportMu.Unlock()
+	if err != nil {
+		log.Printf("[ERROR] Writing the report of %s failed: %v", date, err)
+		return
+	}
+	log.Printf("[INFO] Report of %s written: %d checks, %d watchlist changes", date, report.Checks.Total, len(changes))
+
+	body, _ := json.MarshalIndent(report, "", "  ")
+	if reportWebhookURL != "" {
+		if err := postReport(body); err != nil {
+			log.Printf("[WARNING] Delivering the report of %s to REPORT_WEBHOOK_URL failed: %v", date, err)
+		}
+	}
+	if reportSMTPAddr != "" && len(reportMailTo) > 0 {
+		if err := mailReport(report, body); err != nil {
+			log.Printf("[WARNING] Mailing the report of %s failed: %v", date, err)
+		}
+	}
+}
+
+// 📌 Path of the report of a data date
+func reportPath(date string) string {
+	return filepath.Join(reportsDir, date+".json")
+}
+
+// 📌 Read the report of a data date
+func readReport(date string) (*DailyReport, error) {
+	data, err := os.ReadFile(reportPath(date))
+	if err != nil {
+		return nil, err
+	}
+	if data, err = openRecord(data); err != nil {
+		return nil, err
+	}
+	var report DailyReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// 📌 Write a report under a temporary name and rename it, sealed as its watchlist changes name accounts
+func writeReport(report *DailyReport) error {
+	if err := os.MkdirAll(reportsDir, 0o750); err != nil {
+		return err
+	}
+	return writeSealedJSONFile(reportPath(report.DataDate), report)
+}
+
+// 📌 POST a report to REPORT_WEBHOOK_URL
+func postReport(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, reportWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret := readSecret(&callbackSecret); secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Signature-Timestamp", timestamp)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(hmacSHA256([]byte(secret), timestamp+"."+string(body))))
+	}
+
+	resp, err := reportClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// 📌 Mail a report as a plain text summary with the JSON attached inline
+func mailReport(report *DailyReport, body []byte) error {
+	var message strings.Builder
+	fmt.Fprintf(&message, "From: %s\r\nTo: %s\r\nSubject: VAT whitelist report %s\r\n", reportMailFrom, strings.Join(reportMailTo, ", "), report.DataDate)
+	message.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&message, "Data date: %s\r\nHashes: %d active, %d exempt, %d masks\r\nChecks in the last 24 hours: %d\r\n",
+		report.DataDate, report.Dataset.ActiveHashes, report.Dataset.ExemptHashes, report.Dataset.Masks, report.Checks.Total)
+	statuses := make([]string, 0, len(report.Checks.Results))
+	for status := range report.Checks.Results {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	for _, status := range statuses {
+		fmt.Fprintf(&message, "  %s: %d\r\n", status, report.Checks.Results[status])
+	}
+	fmt.Fprintf(&message, "Watchlist changes: %d\r\n", len(report.WatchlistChanges))
+	for _, change := range report.WatchlistChanges {
+		fmt.Fprintf(&message, "  %s %s %s: %s -> %s/%s\r\n", change.Tenant, change.NIP, change.Bank, change.PreviousStatus, change.Status, change.BankStatus)
+	}
+	for _, update := range report.Updates {
+		fmt.Fprintf(&message, "Loaded %s from %s (fetch %.1fs, load %.1fs)\r\n",
+			update.LoadedAt.Format(time.RFC3339), update.Source, update.FetchSeconds, update.LoadSeconds)
+	}
+	message.WriteString("\r\n")
+	message.Write(bytes.ReplaceAll(body, []byte("\n"), []byte("\r\n")))
+	message.WriteString("\r\n")
+
+	var auth smtp.Auth
+	if reportSMTPUsername != "" {
+		host, _, _ := strings.Cut(reportSMTPAddr, ":")
+		auth = smtp.PlainAuth("", reportSMTPUsername, readSecret(&reportSMTPPassword), host)
+	}
+	return smtp.SendMail(reportSMTPAddr, auth, reportMailFrom, reportMailTo, []byte(message.String()))
+}
+
+// 📌 Handle /reports API endpoint, lists the data dates with a report
+func reportsHandler(w http.ResponseWriter, r *http.Request) {
+	entries, err := os.ReadDir(reportsDir)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("[ERROR] Reading %s failed: %v", reportsDir, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Reading reports failed"})
+		return
+	}
+	dates := []string{}
+	for _, entry := range entries {
+		if date, ok := strings.CutSuffix(entry.Name(), ".json"); ok && !entry.IsDir() {
+			dates = append(dates, date)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(dates)))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"dates": dates})
+}
+
+// 📌 Handle /reports/{date} API endpoint, "latest" is the newest report
+func reportHandler(w http.ResponseWriter, r *http.Request) {
+	date := r.PathValue("date")
+	if date == "latest" {
+		mu.RLock()
+		date = dataDate
+		mu.RUnlock()
+	}
+	if !isDigits(date) || len(date) != 8 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Date must be YYYYMMDD or latest"})
+		return
+	}
+
+	reportMu.Lock()
+	report, err := readReport(date)
+	reportMu.Unlock()
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "No report for " + date})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Validators of a downloaded file, compared against a HEAD request to spot a republish
+type fileValidators struct {
+	date         string
+	etag         string
+	lastModified string
+	size         int64
+}
+
+var (
+	// How often today's file is checked for a corrected republish between updates, 0 disables
+	republishCheckInterval = getEnvDuration("REPUBLISH_CHECK_INTERVAL", 0)
+
+	// Last MF download, only touched by the update loop
+	mfDownloaded fileValidators
+
+	republishClient = &http.Client{Timeout: 30 * time.Second}
+)
+
+// 📌 Remember the validators of today's MF file after downloading it
+func noteMFDownload(date string, resp *http.Response, size int64) {
+	if resp == nil {
+		return
+	}
+	mfDownloaded = fileValidators{
+		date:         date,
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		size:         size,
+	}
+}
+
+// 📌 Report whether the source now offers a different file for the loaded data date
+func republished() bool {
+	mu.RLock()
+	currentDataDate := dataDate
+	mu.RUnlock()
+	date := today()
+	if currentDataDate != date || following() || mode == "readonly" {
+		return false
+	}
+
+	var req *http.Request
+	var err error
+	known := mfDownloaded
+	switch dataSource {
+	case "mf":
+		if known.date != date {
+			// Loaded from a peer or before a restart, nothing to compare against
+			return false
+		}
+		req, err = http.NewRequest(http.MethodHead, strings.ReplaceAll(dataURL, "{DATE}", date), nil)
+		if err != nil {
+			return false
+		}
+		if known.etag != "" {
+			req.Header.Set("If-None-Match", known.etag)
+		} else if known.lastModified != "" {
+			req.Header.Set("If-Modified-Since", known.lastModified)
+		}
+	case "s3":
+		key := strings.ReplaceAll(s3Key, "{DATE}", date)
+		objectURL, urlErr := s3ObjectURL(key)
+		if urlErr != nil || s3ETags[key] == "" {
+			return false
+		}
+		known = fileValidators{etag: s3ETags[key]}
+		if req, err = http.NewRequest(http.MethodHead, objectURL.String(), nil); err != nil {
+			return false
+		}
+		req.Header.Set("If-None-Match", known.etag)
+		if s3AccessKey != "" && s3SecretKey != "" {
+			signS3Request(req, time.Now())
+		}
+	default:
+		// Peers and local files are polled or watched already
+		return false
+	}
+
+	resp, err := republishClient.Do(req)
+	if err != nil {
+		log.Printf("[WARNING] Checking %s for a republished file failed: %v", dataSource, err)
+		return false
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// 304 when unchanged; errors are retried at the next check
+		return false
+	}
+
+	size, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	switch {
+	case known.etag != "" && resp.Header.Get("ETag") != "" && resp.Header.Get("ETag") != known.etag:
+	case known.lastModified != "" && resp.Header.Get("Last-Modified") != "" && resp.Header.Get("Last-Modified") != known.lastModified:
+	case known.size > 0 && size > 0 && size != known.size:
+	default:
+		return false
+	}
+	log.Printf("[INFO] %s republished the file of %s, updating now", dataSource, date)
+	return true
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"log"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pl-vatbank-checker/flatfile"
+)
+
+var (
+	// Verification results kept for the loaded dataset, 0 disables the cache and warming
+	resultCacheSize = getEnvInt("RESULT_CACHE_SIZE", 100000)
+	// Most frequently queried pairs verified again right after every dataset swap, 0 disables warming
+	warmCachePairs = getEnvInt("WARM_CACHE_PAIRS", 1000)
+
+	// Bumped under mu for every dataset swap, so results of a replaced dataset are never served
+	datasetGeneration uint64
+
+	resultCache   = make(map[string]flatfile.Result)
+	resultCacheOf uint64
+	// How often each pair was asked for, halved at every warming so old favourites fade
+	queryCounts   = make(map[string]uint32)
+	resultCacheMu sync.Mutex
+
+	resultCacheHits   atomic.Int64
+	resultCacheMisses atomic.Int64
+)
+
+// 📌 Key of a NIP and optional bank account in the result cache
+func resultKey(nip string, bank string) string {
+	return nip + "/" + bank
+}
+
+// 📌 Count a requested pair for warming, only the first 10 × WARM_CACHE_PAIRS distinct pairs are tracked
+func noteQuery(nip string, bank string) {
+	if resultCacheSize <= 0 || warmCachePairs <= 0 {
+		return
+	}
+	key := resultKey(nip, bank)
+	resultCacheMu.Lock()
+	defer resultCacheMu.Unlock()
+	if _, ok := queryCounts[key]; ok || len(queryCounts) < warmCachePairs*10 {
+		queryCounts[key]++
+	}
+}
+
+// 📌 Look up a pair in a dataset of the given generation, answering repeated pairs from the cache
+func cachedLookup(dataset *flatfile.Dataset, generation uint64, nip string, bank string) flatfile.Result {
+	if resultCacheSize <= 0 {
+		return dataset.Lookup(nip, bank, nil)
+	}
+	key := resultKey(nip, bank)
+
+	resultCacheMu.Lock()
+	if generation > resultCacheOf {
+		resultCache, resultCacheOf = make(map[string]flatfile.Result), generation
+	}
+	result, ok := resultCache[key]
+	ok = ok && resultCacheOf == generation
+	resultCacheMu.Unlock()
+	if ok {
+		resultCacheHits.Add(1)
+		return result
+	}
+
+	resultCacheMisses.Add(1)
+	result = dataset.Lookup(nip, bank, nil)
+
+	resultCacheMu.Lock()
+	defer resultCacheMu.Unlock()
+	if resultCacheOf != generation {
+		// The dataset was swapped during the lookup
+		return result
+	}
+	if len(resultCache) >= resultCacheSize {
+		// Evict an arbitrary entry, map iteration order is random
+		for evicted := range resultCache {
+			delete(resultCache, evicted)
+			break
+		}
+	}
+	resultCache[key] = result
+	return result
+}
+
+// 📌 Verify the most frequently queried pairs against a freshly loaded dataset in the background
+func warmResultCache() {
+	if resultCacheSize <= 0 || warmCachePairs <= 0 {
+		return
+	}
+
+	resultCacheMu.Lock()
+	pairs := make([]string, 0, len(queryCounts))
+	counts := make(map[string]uint32, len(queryCounts))
+	for key, count := range queryCounts {
+		pairs = append(pairs, key)
+		counts[key] = count
+		// Decay so pairs nobody asks for any more drop out
+		if count /= 2; count == 0 {
+			delete(queryCounts, key)
+		} else {
+			queryCounts[key] = count
+		}
+	}
+	resultCacheMu.Unlock()
+
+	sort.Slice(pairs, func(i, j int) bool { return counts[pairs[i]] > counts[pairs[j]] })
+	pairs = pairs[:min(len(pairs), warmCachePairs, resultCacheSize)]
+	if len(pairs) == 0 {
+		return
+	}
+
+	mu.RLock()
+	dataset := &flatfile.Dataset{Date: dataDate, Iterations: iterations, Active: activeHashes, Exempt: exemptHashes, Masks: masks}
+	generation := datasetGeneration
+	mu.RUnlock()
+
+	started := time.Now()
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	// Half the CPUs, so the first requests of the morning are not queued behind the warming
+	for i := 0; i < max(runtime.GOMAXPROCS(0)/2, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range jobs {
+				nip, bank, _ := strings.Cut(key, "/")
+				cachedLookup(dataset, generation, nip, bank)
+			}
+		}()
+	}
+	for _, key := range pairs {
+		jobs <- key
+	}
+	close(jobs)
+	wg.Wait()
+	log.Printf("[INFO] Warmed the result cache with %d frequent pairs in %s", len(pairs), time.Since(started).Round(time.Millisecond))
+}
+
+// 📌 Result cache hit and miss counters, none without RESULT_CACHE_SIZE
+func resultCacheMetrics() []metric {
+	if resultCacheSize <= 0 {
+		return nil
+	}
+	resultCacheMu.Lock()
+	entries := len(resultCache)
+	resultCacheMu.Unlock()
+	return []metric{
+		{"vatbank_result_cache_entries", "gauge", "Verification results cached for the loaded dataset.", float64(entries)},
+		{"vatbank_result_cache_hits_total", "counter", "Verifications answered from the result cache.", float64(resultCacheHits.Load())},
+		{"vatbank_result_cache_misses_total", "counter", "Verifications that computed the hash chain.", float64(resultCacheMisses.Load())},
+	}
+}
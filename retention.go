@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// Days downloaded archives (DATA_DIR/archives) and update snapshots (DATA_DIR/snapshots) are kept, 0 deletes archives once loaded
+	archiveRetentionDays = getEnvInt("ARCHIVE_RETENTION_DAYS", 0)
+	archivesDir          = filepath.Join(dataDir, "archives")
+	snapshotsDir         = filepath.Join(dataDir, "snapshots")
+	// Free bytes TMP_DIR needs before a download starts
+	downloadMinFree = int64(getEnvInt("DOWNLOAD_MIN_FREE", 1<<30))
+
+	// Archive and extracted JSON size of the last update, a download needs room for both again
+	lastUpdateBytes atomic.Int64
+)
+
+// 📌 Refuse to download when TMP_DIR cannot hold the archive and its extraction
+func checkDownloadSpace() error {
+	floor := downloadMinFree
+	if mode == "serverless" {
+		// Snapshots are far smaller than the MF archive and a default Lambda /tmp has 512 MB, the last size still applies
+		floor = 0
+	}
+	required := max(floor, lastUpdateBytes.Load()+lastUpdateBytes.Load()/5)
+	if required <= 0 {
+		return nil
+	}
+	free, err := freeDiskSpace(tmpDir)
+	if err != nil {
+		return fmt.Errorf("checking free space of %s: %w", tmpDir, err)
+	}
+	if int64(free) < required {
+		return fmt.Errorf("only %d MiB free in %s, a download needs %d MiB (DOWNLOAD_MIN_FREE or the last update's size plus 20%%)",
+			free>>20, tmpDir, required>>20)
+	}
+	return nil
+}
+
+// 📌 Remember how much disk space an update took, the archive and the extracted JSON
+func noteUpdateSize(archive string, jsonFile string) {
+	paths := []string{archive}
+	if jsonFile != archive {
+		// Plain JSON downloads need no extraction
+		paths = append(paths, jsonFile)
+	}
+	var total int64
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			total += info.Size()
+		}
+	}
+	lastUpdateBytes.Store(total)
+}
+
+// 📌 Keep a loaded archive in DATA_DIR/archives under ARCHIVE_RETENTION_DAYS, otherwise delete it
+func retainArchive(file string) {
+	if archiveRetentionDays <= 0 {
+		_ = os.Remove(file)
+		return
+	}
+	if err := os.MkdirAll(archivesDir, 0o750); err == nil {
+		if err = os.Rename(file, filepath.Join(archivesDir, filepath.Base(file))); err == nil {
+			return
+		}
+		// TMP_DIR on another filesystem than DATA_DIR
+		log.Printf("[WARNING] Keeping archive %s failed: %v", filepath.Base(file), err)
+	}
+	_ = os.Remove(file)
+}
+
+// 📌 Delete archives and snapshots older than ARCHIVE_RETENTION_DAYS
+func pruneRetained() {
+	if archiveRetentionDays <= 0 {
+		return
+	}
+	cutoff := time.Now().AddDate(0, 0, -archiveRetentionDays)
+	for _, dir := range []string{archivesDir, snapshotsDir} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		// The newest file stays even when updates stopped for longer than the retention
+		var files []os.FileInfo
+		for _, entry := range entries {
+			if info, err := entry.Info(); err == nil && !entry.IsDir() {
+				files = append(files, info)
+			}
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i].ModTime().After(files[j].ModTime()) })
+		for i, info := range files {
+			if i == 0 || !info.ModTime().Before(cutoff) {
+				continue
+			}
+			path := filepath.Join(dir, info.Name())
+			if err := os.Remove(path); err != nil {
+				log.Printf("[WARNING] Deleting %s failed: %v", path, err)
+				continue
+			}
+			log.Printf("[INFO] Deleted %s, older than %d days", path, archiveRetentionDays)
+		}
+	}
+}
+
+// 📌 Remove extraction directories left in TMP_DIR by an earlier crash or kill
+func cleanTmpDir() {
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		// Only the directories created with os.MkdirTemp, TMP_DIR defaults to DATA_DIR and may hold other files
+		name := entry.Name()
+		if !entry.IsDir() || !(strings.HasPrefix(name, "extract-") || strings.HasPrefix(name, "peer-")) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(tmpDir, name)); err == nil {
+			log.Printf("[INFO] Removed leftover %s from %s", name, tmpDir)
+		}
+	}
+}
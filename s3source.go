@@ -0,0 +1,235 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// S3-compatible object storage holding mirrored flat files
+	s3Endpoint  = getEnv("S3_ENDPOINT", "")
+	s3Region    = getEnv("S3_REGION", getEnv("AWS_REGION", "us-east-1"))
+	s3Bucket    = getEnv("S3_BUCKET", "")
+	s3Key       = getEnv("S3_KEY", "{DATE}.7z")
+	s3PathStyle = getEnvBool("S3_PATH_STYLE", s3Endpoint != "")
+	s3AccessKey = getSecret("S3_ACCESS_KEY_ID", getSecret("AWS_ACCESS_KEY_ID", ""))
+	s3SecretKey = getSecret("S3_SECRET_ACCESS_KEY", getSecret("AWS_SECRET_ACCESS_KEY", ""))
+	s3Token     = getSecret("S3_SESSION_TOKEN", getSecret("AWS_SESSION_TOKEN", ""))
+
+	s3Client = &http.Client{Timeout: 30 * time.Minute}
+	// ETag of the last loaded object per key, only touched by the update loop
+	s3ETags = make(map[string]string)
+	// ETag of the downloaded object, recorded once the dataset extracted from it loads
+	s3Pending   struct{ key, etag, jsonFile string }
+	s3PendingMu sync.Mutex
+)
+
+// 📌 Build the object URL for path-style or virtual-hosted-style access
+func s3ObjectURL(key string) (*url.URL, error) {
+	endpoint := s3Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + s3Region + ".amazonaws.com"
+	}
+
+	base, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if s3PathStyle {
+		base.Path = path.Join("/", base.Path, s3Bucket, key)
+	} else {
+		base.Host = s3Bucket + "." + base.Host
+		base.Path = path.Join("/", base.Path, key)
+	}
+	base.RawPath = s3EscapePath(base.Path)
+	return base, nil
+}
+
+// 📌 URI-encode an object path the way SigV4 expects (every byte but unreserved and '/')
+func s3EscapePath(value string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', b == '/':
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+// 📌 HMAC-SHA256 helper for request signing
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// AWS access key, signing S3 and KMS requests
+type awsCredentials struct {
+	accessKey string
+	secretKey string
+	token     string
+}
+
+// 📌 Sign a GET request with AWS Signature Version 4
+func signS3Request(req *http.Request, now time.Time) {
+	signAWSRequest(req, "s3", s3Region, "UNSIGNED-PAYLOAD", awsCredentials{s3AccessKey, s3SecretKey, s3Token}, now)
+}
+
+// 📌 Sign a request to an AWS service with Signature Version 4
+func signAWSRequest(req *http.Request, service, region, payloadHash string, credentials awsCredentials, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	shortDate := now.UTC().Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\nx-amz-content-sha256:" + payloadHash + "\nx-amz-date:" + amzDate + "\n"
+	if credentials.token != "" {
+		req.Header.Set("x-amz-security-token", credentials.token)
+		signedHeaders += ";x-amz-security-token"
+		canonicalHeaders += "x-amz-security-token:" + credentials.token + "\n"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := shortDate + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+credentials.secretKey), shortDate)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		credentials.accessKey, scope, signedHeaders, signature))
+}
+
+// 📌 Download an object from S3-compatible storage into a file
+func downloadS3Object(key string, destination string) error {
+	objectURL, err := s3ObjectURL(key)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, objectURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	// An unchanged object (e.g. a polled latest.json.gz snapshot) is not downloaded again
+	if etag := s3ETags[key]; etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	// Public buckets are read without credentials
+	if s3AccessKey != "" && s3SecretKey != "" {
+		signS3Request(req, time.Now())
+	}
+
+	log.Printf("[INFO] Downloading: s3://%s/%s", s3Bucket, key)
+	resp, err := s3Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return errNotModified
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	file, err := os.OpenFile(destination, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	s3PendingMu.Lock()
+	s3Pending.key, s3Pending.etag, s3Pending.jsonFile = key, resp.Header.Get("ETag"), ""
+	s3PendingMu.Unlock()
+	return nil
+}
+
+// 📌 Record the ETag of the downloaded object once its dataset loaded, a rejected object is downloaded again
+func confirmS3Download(jsonFile string) {
+	s3PendingMu.Lock()
+	defer s3PendingMu.Unlock()
+	if s3Pending.jsonFile != "" && s3Pending.jsonFile == jsonFile {
+		s3ETags[s3Pending.key] = s3Pending.etag
+		s3Pending.jsonFile = ""
+	}
+}
+
+// 📌 Fetch the flat file mirrored in object storage
+func fetchFromS3() (string, func(), error) {
+	date := today()
+	key := strings.ReplaceAll(s3Key, "{DATE}", date)
+	// Keep the date-based name so the extracted JSON can be located
+	fileName := filepath.Join(tmpDir, date+path.Ext(key))
+
+	_, err := downloadVerified(func() (string, error) {
+		if err := downloadS3Object(key, fileName); err != nil {
+			_ = os.Remove(fileName)
+			if errors.Is(err, errNotModified) {
+				return "", err
+			}
+			log.Printf("[ERROR] Download failed: %v", err)
+			return "", err
+		}
+		log.Printf("[INFO] Downloaded: %s", fileName)
+		return fileName, nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	jsonFile, cleanup, err := fetchFromFile(fileName)
+	if err != nil {
+		_ = os.Remove(fileName)
+		return "", nil, err
+	}
+	noteUpdateSize(fileName, jsonFile)
+	s3PendingMu.Lock()
+	if s3Pending.key == key {
+		s3Pending.jsonFile = jsonFile
+	}
+	s3PendingMu.Unlock()
+	return jsonFile, func() {
+		cleanup()
+		retainArchive(fileName)
+	}, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+//go:embed fixtures/sandbox.json
+var sandboxFixture []byte
+
+// Sandbox fixture with plain NIPs and accounts, hashed on load
+type SandboxFixture struct {
+	Masks   []string `json:"masks"`
+	Entries []struct {
+		NIP    string `json:"nip"`
+		Bank   string `json:"bank"`
+		Status string `json:"status"`
+	} `json:"entries"`
+}
+
+// 📌 Generate a flat file from the bundled sandbox fixture
+func writeSandboxData() (string, func(), error) {
+	var fixture SandboxFixture
+	if err := json.Unmarshal(sandboxFixture, &fixture); err != nil {
+		return "", nil, err
+	}
+
+	var structure DataStructure
+	structure.Header.DataDate = today()
+	structure.Header.TransformCount = strconv.Itoa(iterations)
+	structure.Masks = fixture.Masks
+
+	for _, entry := range fixture.Entries {
+		hash := calculateHash(structure.Header.DataDate + entry.NIP + entry.Bank)
+		if entry.Status == "EXEMPT" {
+			structure.ExemptHashes = append(structure.ExemptHashes, hash)
+		} else {
+			structure.ActiveHashes = append(structure.ActiveHashes, hash)
+		}
+	}
+
+	workDir, err := os.MkdirTemp(tmpDir, "sandbox-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { _ = os.RemoveAll(workDir) }
+
+	data, err := json.Marshal(structure)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	jsonPath := filepath.Join(workDir, structure.Header.DataDate+".json")
+	if err := os.WriteFile(jsonPath, data, 0o640); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	return jsonPath, cleanup, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"hash/fnv"
+	"log"
+	"math/rand/v2"
+	"time"
+	_ "time/tzdata"
+)
+
+var (
+	// MF publishes the flat file for each day shortly after midnight Polish time
+	prefetchEnabled = getEnvBool("PREFETCH_ENABLED", true)
+	prefetchOffset  = getEnvDuration("PREFETCH_OFFSET", 30*time.Minute)
+	// Random delay of up to UPDATE_JITTER before each download, so replicas started together do not hit MF at once
+	updateJitter = getEnvDuration("UPDATE_JITTER", 0)
+	// Fixed offset within UPDATE_SPREAD derived from the replica's identity, spreading a fleet evenly over the window
+	updateSpread = getEnvDuration("UPDATE_SPREAD", 0)
+
+	warsaw = loadWarsaw()
+)
+
+// 📌 Load the Europe/Warsaw time zone (embedded tzdata, so it works on minimal images)
+func loadWarsaw() *time.Location {
+	location, err := time.LoadLocation("Europe/Warsaw")
+	if err != nil {
+		log.Printf("[WARNING] Europe/Warsaw time zone unavailable, using local time: %v", err)
+		return time.Local
+	}
+	return location
+}
+
+// 📌 Current date in Poland as YYYYMMDD, the date of the flat file published today
+func today() string {
+	return time.Now().In(warsaw).Format("20060102")
+}
+
+// 📌 Time of the next refresh: after UPDATE_INTERVAL or at the prefetch time after midnight in Warsaw, whichever comes first
+func nextUpdate(now time.Time) time.Time {
+	next := now.Add(updateInterval)
+	if !prefetchEnabled {
+		return next
+	}
+
+	local := now.In(warsaw)
+	prefetch := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, warsaw).Add(prefetchOffset)
+	if !prefetch.After(now) {
+		prefetch = time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, warsaw).Add(prefetchOffset)
+	}
+
+	if prefetch.Before(next) {
+		return prefetch
+	}
+	return next
+}
+
+// 📌 Delay of this replica's downloads: its offset within UPDATE_SPREAD plus a random UPDATE_JITTER
+func updateDelay() time.Duration {
+	var delay time.Duration
+	if updateSpread > 0 {
+		hash := fnv.New64a()
+		hash.Write([]byte(leaderIdentity))
+		delay = time.Duration(hash.Sum64() % uint64(updateSpread))
+	}
+	if updateJitter > 0 {
+		delay += rand.N(updateJitter)
+	}
+	return delay
+}
+
+// 📌 Sleep until the next scheduled refresh
+func sleepUntilNextUpdate() {
+	next := nextUpdate(time.Now()).Add(updateDelay())
+	log.Printf("[INFO] Next data update at %s", next.In(warsaw).Format(time.RFC3339))
+	// Wake up early when today's file is corrected during the day
+	for republishCheckInterval > 0 && time.Until(next) > republishCheckInterval {
+		time.Sleep(republishCheckInterval)
+		if republished() {
+			return
+		}
+	}
+	time.Sleep(time.Until(next))
+}
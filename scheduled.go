@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// Deliveries per payment before it is marked FAILED
+	callbackMaxAttempts = 10
+	// How often pending payments and failed deliveries are looked at
+	scheduledCheckInterval = time.Minute
+)
+
+var (
+	// Registered payments survive restarts in this file
+	scheduledFile = getEnv("SCHEDULED_FILE", filepath.Join(dataDir, "scheduled.json"))
+	// HMAC-SHA256 key of the X-Signature callback header, scheduling is disabled without it
+	callbackSecret = getSecret("CALLBACK_SECRET", "")
+	// Only these callback hosts are accepted, they may be internal; without the list any public host is
+	callbackAllowedHosts = splitList(getEnv("CALLBACK_ALLOWED_HOSTS", ""))
+
+	scheduledPayments = make(map[string]*ScheduledPayment)
+	scheduledMu       sync.Mutex
+	// Serializes processing runs so a callback is never delivered twice in parallel
+	scheduledRunMu sync.Mutex
+	callbackClient = newCallbackClient()
+)
+
+// Payment registered for verification on its payment date
+type ScheduledPayment struct {
+	ID          string    `json:"id"`
+	Tenant      string    `json:"tenant,omitempty"`
+	NIP         string    `json:"nip"`
+	Bank        string    `json:"bankAccount"`
+	PaymentDate string    `json:"paymentDate"`
+	CallbackURL string    `json:"callbackUrl"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// Client references, echoed in the result and stored with the confirmation
+	Correlation
+	// PENDING until verified, then DELIVERING until the callback succeeds (DELIVERED) or gives up (FAILED)
+	State        string     `json:"state"`
+	VerifiedAt   *time.Time `json:"verifiedAt,omitempty"`
+	Confirmation string     `json:"confirmation,omitempty"`
+	Result       *Response  `json:"result,omitempty"`
+	Attempts     int        `json:"attempts,omitempty"`
+	NextAttempt  *time.Time `json:"nextAttempt,omitempty"`
+	LastError    string     `json:"lastError,omitempty"`
+	DeliveredAt  *time.Time `json:"deliveredAt,omitempty"`
+}
+
+// Body POSTed to the callback URL
+type ScheduledCallback struct {
+	ID           string    `json:"id"`
+	NIP          string    `json:"nip"`
+	Bank         string    `json:"bankAccount"`
+	PaymentDate  string    `json:"paymentDate"`
+	VerifiedAt   time.Time `json:"verifiedAt"`
+	Confirmation string    `json:"confirmation,omitempty"`
+	Result       Response  `json:"result"`
+}
+
+// 📌 Load the persisted scheduled payments, a missing file means none
+func loadScheduledPayments() error {
+	var payments []*ScheduledPayment
+	if err := readSealedJSONFile(scheduledFile, &payments); err != nil {
+		return err
+	}
+
+	scheduledMu.Lock()
+	defer scheduledMu.Unlock()
+	for _, payment := range payments {
+		scheduledPayments[payment.ID] = payment
+	}
+	if len(payments) > 0 {
+		log.Printf("[INFO] Loaded %d scheduled payments", len(payments))
+	}
+	return nil
+}
+
+// 📌 Persist the scheduled payments, the caller holds scheduledMu
+func saveScheduledPayments() {
+	payments := make([]*ScheduledPayment, 0, len(scheduledPayments))
+	for _, payment := range scheduledPayments {
+		payments = append(payments, payment)
+	}
+	sort.Slice(payments, func(i, j int) bool { return payments[i].ID < payments[j].ID })
+
+	if err := writeSealedJSONFile(scheduledFile, payments); err != nil {
+		log.Printf("[ERROR] Saving scheduled payments failed: %v", err)
+	}
+}
+
+// 📌 Verify payments whose date has come and deliver pending callbacks, runs every minute and after each dataset load
+func processScheduledPayments() {
+	if readSecret(&callbackSecret) == "" {
+		return
+	}
+	scheduledRunMu.Lock()
+	defer scheduledRunMu.Unlock()
+
+	// The dataset of the payment date (or a later one) decides, never an older one
+	mu.RLock()
+	date := dataDate
+	mu.RUnlock()
+	usable := datasetProblem() == ""
+
+	scheduledMu.Lock()
+	var verifiable []ScheduledPayment
+	for _, payment := range scheduledPayments {
+		if payment.State == "PENDING" && usable && payment.PaymentDate <= date {
+			verifiable = append(verifiable, *payment)
+		}
+	}
+	scheduledMu.Unlock()
+
+	// Verify outside the lock, in MODE=proxy every payment is an MF API call
+	now := time.Now().UTC()
+	verified := make(map[string]*ScheduledPayment, len(verifiable))
+	for _, payment := range verifiable {
+		result := verify(payment.NIP, payment.Bank)
+		result.Correlation = payment.Correlation.orNil()
+		payment.Result = &result
+		payment.VerifiedAt = &now
+		payment.Confirmation = issueConfirmation(payment.Tenant, "scheduled", payment.NIP, payment.Bank, result)
+		recordStats(result, true)
+		verified[payment.ID] = &payment
+	}
+
+	scheduledMu.Lock()
+	var due []*ScheduledPayment
+	changed := false
+	for _, payment := range scheduledPayments {
+		// Cancelled payments are gone from the map and are not revived
+		if result, ok := verified[payment.ID]; ok && payment.State == "PENDING" {
+			payment.Result, payment.VerifiedAt, payment.Confirmation, payment.State = result.Result, result.VerifiedAt, result.Confirmation, "DELIVERING"
+			changed = true
+		}
+		if payment.State == "DELIVERING" && (payment.NextAttempt == nil || !now.Before(*payment.NextAttempt)) {
+			copied := *payment
+			due = append(due, &copied)
+		}
+	}
+	if changed {
+		saveScheduledPayments()
+	}
+	scheduledMu.Unlock()
+
+	// Deliver outside the lock, a slow callback must not block registrations
+	for _, payment := range due {
+		err := deliverCallback(payment)
+
+		scheduledMu.Lock()
+		if stored, ok := scheduledPayments[payment.ID]; ok {
+			stored.Attempts++
+			finished := time.Now().UTC()
+			switch {
+			case err == nil:
+				stored.State, stored.DeliveredAt, stored.NextAttempt, stored.LastError = "DELIVERED", &finished, nil, ""
+			case stored.Attempts >= callbackMaxAttempts:
+				stored.State, stored.NextAttempt, stored.LastError = "FAILED", nil, err.Error()
+				log.Printf("[ERROR] Callback of scheduled payment %s failed %d times, giving up: %v", stored.ID, stored.Attempts, err)
+			default:
+				// Exponential backoff from one minute, capped at an hour
+				next := finished.Add(min(time.Minute<<stored.Attempts, time.Hour))
+				stored.NextAttempt, stored.LastError = &next, err.Error()
+				log.Printf("[WARNING] Callback of scheduled payment %s failed (attempt %d), retrying at %s: %v", stored.ID, stored.Attempts, next.Format(time.RFC3339), err)
+			}
+			saveScheduledPayments()
+		}
+		scheduledMu.Unlock()
+	}
+}
+
+// 📌 Reason a callback URL is refused, empty when it is https on an allowed host
+func callbackURLProblem(raw string) string {
+	callback, err := url.Parse(raw)
+	if err != nil || callback.Scheme != "https" || callback.Hostname() == "" {
+		return "Callback URL must be an absolute https URL"
+	}
+	host := callback.Hostname()
+	if len(callbackAllowedHosts) > 0 {
+		if !slices.ContainsFunc(callbackAllowedHosts, func(allowed string) bool { return strings.EqualFold(allowed, host) }) {
+			return "Callback host " + host + " is not in CALLBACK_ALLOWED_HOSTS"
+		}
+		return ""
+	}
+	if ip := net.ParseIP(host); ip != nil && !publicAddress(ip) {
+		return "Callback URL must not point to a private, loopback or link-local address"
+	}
+	return ""
+}
+
+// 📌 Check that an address is publicly routable, not private, loopback, link-local or multicast
+func publicAddress(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate()
+}
+
+// 📌 HTTP client for callbacks, without CALLBACK_ALLOWED_HOSTS it only connects to public addresses
+//
+// The check runs on the resolved address, so a public name that resolves to
+// an internal one (DNS rebinding) is refused as well.
+func newCallbackClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be the address checked, not the receiver
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network string, address string) (net.Conn, error) {
+		dialer := &net.Dialer{Timeout: 30 * time.Second}
+		if len(callbackAllowedHosts) == 0 {
+			dialer.Control = func(_ string, resolved string, _ syscall.RawConn) error {
+				host, _, _ := net.SplitHostPort(resolved)
+				if ip := net.ParseIP(host); ip == nil || !publicAddress(ip) {
+					return fmt.Errorf("callback address %s is not public", host)
+				}
+				return nil
+			}
+		}
+		return dialer.DialContext(ctx, network, address)
+	}
+	return &http.Client{Timeout: 30 * time.Second, Transport: transport}
+}
+
+// 📌 POST the signed verification result to the payment's callback URL
+func deliverCallback(payment *ScheduledPayment) error {
+	// Payments registered before the URL rules tightened fail instead of reaching internal hosts
+	if problem := callbackURLProblem(payment.CallbackURL); problem != "" {
+		return errors.New(problem)
+	}
+	body, err := json.Marshal(ScheduledCallback{
+		ID:           payment.ID,
+		NIP:          payment.NIP,
+		Bank:         payment.Bank,
+		PaymentDate:  payment.PaymentDate,
+		VerifiedAt:   *payment.VerifiedAt,
+		Confirmation: payment.Confirmation,
+		Result:       *payment.Result,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, payment.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	// The receiver recomputes HMAC-SHA256(CALLBACK_SECRET, timestamp + "." + body)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Signature-Timestamp", timestamp)
+	req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(hmacSHA256([]byte(readSecret(&callbackSecret)), timestamp+"."+string(body))))
+
+	resp, err := callbackClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("callback returned %s", resp.Status)
+	}
+	return nil
+}
+
+// 📌 Check scheduled payments every minute
+func runScheduledPayments() {
+	ticker := time.NewTicker(scheduledCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		processScheduledPayments()
+	}
+}
+
+// 📌 Handle /payments/scheduled API endpoint: register (POST), list (GET) or cancel (DELETE ?id=) payments
+func scheduledHandler(w http.ResponseWriter, r *http.Request) {
+	if readSecret(&callbackSecret) == "" {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Scheduled verification is disabled, set CALLBACK_SECRET"})
+		return
+	}
+	tenant := tenantFromRequest(r)
+
+	switch r.Method {
+	case http.MethodPost:
+		var payment ScheduledPayment
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&payment); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Invalid payment, expected {\"nip\", \"bankAccount\", \"paymentDate\", \"callbackUrl\"}"})
+			return
+		}
+
+		_, fields := validateInput(payment.NIP, payment.Bank)
+		if payment.Bank == "" {
+			fields = append(fields, FieldError{Field: "bankAccount", Code: "MISSING", Message: "Bank account is required"})
+		}
+		paymentDate, err := time.ParseInLocation("2006-01-02", payment.PaymentDate, warsaw)
+		switch {
+		case err != nil:
+			fields = append(fields, FieldError{Field: "paymentDate", Code: "INVALID_DATE", Message: "Payment date must be YYYY-MM-DD"})
+		case paymentDate.Format("20060102") < today():
+			fields = append(fields, FieldError{Field: "paymentDate", Code: "IN_THE_PAST", Message: "Payment date must be today or later"})
+		}
+		if problem := callbackURLProblem(payment.CallbackURL); problem != "" {
+			fields = append(fields, FieldError{Field: "callbackUrl", Code: "INVALID_URL", Message: problem})
+		}
+		fields = append(fields, validateCorrelation(payment.Correlation.orNil())...)
+		if len(fields) > 0 {
+			recordError("invalid_scheduled_payment")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(validationResponse(fields))
+			return
+		}
+
+		registered := &ScheduledPayment{
+			ID:          newIncidentID(),
+			Tenant:      tenant,
+			NIP:         payment.NIP,
+			Bank:        payment.Bank,
+			PaymentDate: paymentDate.Format("20060102"),
+			CallbackURL: payment.CallbackURL,
+			Correlation: payment.Correlation,
+			CreatedAt:   time.Now().UTC(),
+			State:       "PENDING",
+		}
+		scheduledMu.Lock()
+		scheduledPayments[registered.ID] = registered
+		saveScheduledPayments()
+		scheduledMu.Unlock()
+		log.Printf("[INFO] Scheduled payment %s registered for %s", registered.ID, registered.PaymentDate)
+
+		// Payments due today are verified right away when today's dataset is loaded
+		go processScheduledPayments()
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(registered)
+	case http.MethodGet:
+		scheduledMu.Lock()
+		payments := []ScheduledPayment{}
+		for _, payment := range scheduledPayments {
+			if payment.Tenant == tenant {
+				payments = append(payments, *payment)
+			}
+		}
+		scheduledMu.Unlock()
+		sort.Slice(payments, func(i, j int) bool { return payments[i].CreatedAt.Before(payments[j].CreatedAt) })
+		json.NewEncoder(w).Encode(payments)
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		scheduledMu.Lock()
+		payment, ok := scheduledPayments[id]
+		if ok && payment.Tenant == tenant {
+			delete(scheduledPayments, id)
+			saveScheduledPayments()
+		}
+		scheduledMu.Unlock()
+		if !ok || payment.Tenant != tenant {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Unknown scheduled payment"})
+			return
+		}
+		json.NewEncoder(w).Encode(Response{Response: "OK", Message: "Scheduled payment cancelled"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Use POST, GET or DELETE"})
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"pl-vatbank-checker/flatfile"
+)
+
+// Header fields of the flat file this version understands
+var knownHeaderFields = map[string]bool{
+	"dataGenerowaniaDanych": true,
+	"liczbaTransformacji":   true,
+	"schemat":               true,
+}
+
+var (
+	// Accepted liczbaTransformacji range; every verification runs this many SHA-512 rounds per hash,
+	// so a corrupted header must not be able to turn requests into a CPU bomb
+	transformCountMin = getEnvInt("TRANSFORM_COUNT_MIN", 1)
+	transformCountMax = getEnvInt("TRANSFORM_COUNT_MAX", flatfile.DefaultMaxIterations)
+)
+
+// Top-level fields that must be present in every flat file
+var requiredFields = []string{"naglowek", "skrotyPodatnikowCzynnych", "skrotyPodatnikowZwolnionych", "maski"}
+
+// 📌 Decode a flat file field by field, reporting fields this version does not know
+func decodeDataFile(r io.Reader) (DataStructure, error) {
+	var structure DataStructure
+	decoder := json.NewDecoder(bufio.NewReaderSize(r, 1<<20))
+
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return structure, errors.New("flat file is not a JSON object")
+	}
+
+	seen := make(map[string]bool)
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return structure, err
+		}
+		key, _ := token.(string)
+		seen[key] = true
+
+		switch key {
+		case "naglowek":
+			var header map[string]json.RawMessage
+			if err := decoder.Decode(&header); err != nil {
+				return structure, fmt.Errorf("field naglowek: %w", err)
+			}
+			if err := decodeHeader(header, &structure); err != nil {
+				return structure, err
+			}
+		case "skrotyPodatnikowCzynnych":
+			err = decoder.Decode(&structure.ActiveHashes)
+		case "skrotyPodatnikowZwolnionych":
+			err = decoder.Decode(&structure.ExemptHashes)
+		case "maski":
+			err = decoder.Decode(&structure.Masks)
+		default:
+			var ignored json.RawMessage
+			err = decoder.Decode(&ignored)
+			log.Printf("[WARNING] Flat file contains unknown field %q (%d bytes), ignoring it. The MF file format may have changed.", key, len(ignored))
+		}
+		if err != nil {
+			return structure, fmt.Errorf("field %s: %w", key, err)
+		}
+	}
+
+	for _, field := range requiredFields {
+		if !seen[field] {
+			return structure, fmt.Errorf("required field %s is missing, the MF file format may have changed", field)
+		}
+	}
+	return structure, nil
+}
+
+// 📌 Decode the header, reporting unknown header fields
+func decodeHeader(header map[string]json.RawMessage, structure *DataStructure) error {
+	for key := range header {
+		if !knownHeaderFields[key] {
+			log.Printf("[WARNING] Flat file header contains unknown field %q, ignoring it", key)
+		}
+	}
+
+	for key, target := range map[string]*string{
+		"dataGenerowaniaDanych": &structure.Header.DataDate,
+		"liczbaTransformacji":   &structure.Header.TransformCount,
+	} {
+		value, ok := header[key]
+		if !ok {
+			return fmt.Errorf("header field %s is missing", key)
+		}
+		if err := json.Unmarshal(value, target); err != nil {
+			// Tolerate numbers where strings are expected
+			var number json.Number
+			if json.Unmarshal(value, &number) != nil {
+				return fmt.Errorf("header field %s has unexpected value %s", key, value)
+			}
+			*target = number.String()
+		}
+	}
+	return nil
+}
+
+// 📌 Check that a value is a 26-character mask of digits, X and Y
+func isMaskValue(value string) bool {
+	return len(value) == 26 && strings.Trim(value, "0123456789XY") == ""
+}
+
+// 📌 Drop invalid entries from a list, logging how many were dropped
+func filterValid(name string, values []string, valid func(string) bool) []string {
+	kept := values[:0]
+	var invalid int
+	var sample string
+	for _, value := range values {
+		if valid(value) {
+			kept = append(kept, value)
+			continue
+		}
+		if invalid == 0 {
+			sample = value
+		}
+		invalid++
+	}
+
+	if invalid > 0 {
+		if len(sample) > 40 {
+			sample = sample[:40] + "..."
+		}
+		log.Printf("[WARNING] Skipped %d invalid entries in %s (e.g. %q)", invalid, name, sample)
+	}
+	return kept
+}
+
+// 📌 Validate a decoded flat file, dropping malformed entries
+func validateStructure(structure *DataStructure) error {
+	if _, err := time.Parse("20060102", structure.Header.DataDate); err != nil {
+		return fmt.Errorf("invalid data date %q in header", structure.Header.DataDate)
+	}
+	count, err := strconv.Atoi(structure.Header.TransformCount)
+	if err != nil {
+		return fmt.Errorf("invalid transform count %q in header", structure.Header.TransformCount)
+	}
+	if count < transformCountMin || count > transformCountMax {
+		return fmt.Errorf("transform count %d in header is outside %d-%d (TRANSFORM_COUNT_MIN/TRANSFORM_COUNT_MAX)", count, transformCountMin, transformCountMax)
+	}
+
+	structure.ActiveHashes = filterValid("skrotyPodatnikowCzynnych", structure.ActiveHashes, isHashValue)
+	structure.ExemptHashes = filterValid("skrotyPodatnikowZwolnionych", structure.ExemptHashes, isHashValue)
+	structure.Masks = filterValid("maski", structure.Masks, isMaskValue)
+
+	if len(structure.ActiveHashes) == 0 {
+		return errors.New("flat file contains no valid active taxpayer hashes, the MF file format may have changed")
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// Vault server of vault: references, read raw because getEnv depends on them
+	vaultAddr      = strings.TrimSuffix(rawSetting("VAULT_ADDR"), "/")
+	vaultToken     = rawSetting("VAULT_TOKEN")
+	vaultNamespace = rawSetting("VAULT_NAMESPACE")
+	// Kubernetes auth, used when no VAULT_TOKEN is set
+	vaultRole     = rawSetting("VAULT_ROLE")
+	vaultAuthPath = rawSettingOr("VAULT_AUTH_PATH", "kubernetes")
+	vaultJWTFile  = rawSettingOr("VAULT_JWT_FILE", "/var/run/secrets/kubernetes.io/serviceaccount/token")
+
+	vaultClient = &http.Client{Timeout: 10 * time.Second}
+	// Token obtained through Kubernetes auth
+	vaultSession string
+	vaultMu      sync.Mutex
+
+	// How often credentials given as secret references are fetched again, 0 disables it
+	secretsRefreshInterval = getEnvDuration("SECRETS_REFRESH_INTERVAL", 5*time.Minute)
+	// Guards the settings re-fetched by refreshSecrets
+	secretsMu sync.RWMutex
+)
+
+// 📌 Read a raw setting with a default
+func rawSettingOr(key, fallback string) string {
+	if value := rawSetting(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// 📌 Check whether a setting refers to a secret (vault:<path>#<field> or file:<path>) instead of holding it
+func isSecretRef(value string) bool {
+	// file:// URLs are plain paths of DATA_PATH and similar settings, not secrets
+	return strings.HasPrefix(value, "vault:") || (strings.HasPrefix(value, "file:") && !strings.HasPrefix(value, "file://"))
+}
+
+// 📌 Fetch the value of a secret reference
+func resolveSecret(ref string) (string, error) {
+	if path, ok := strings.CutPrefix(ref, "file:"); ok {
+		// Secrets mounted by a CSI driver or an agent sidecar (Vault, AWS, GCP, Azure)
+		content, err := os.ReadFile(path)
+		return strings.TrimSpace(string(content)), err
+	}
+
+	path, field, _ := strings.Cut(strings.TrimPrefix(ref, "vault:"), "#")
+	if field == "" {
+		field = "value"
+	}
+	return readVaultSecret(strings.Trim(path, "/"), field)
+}
+
+// 📌 Read one field of a Vault KV secret (version 1 or 2)
+func readVaultSecret(path, field string) (string, error) {
+	if vaultAddr == "" {
+		return "", errors.New("VAULT_ADDR is not set")
+	}
+	token, err := vaultLogin()
+	if err != nil {
+		return "", err
+	}
+
+	var secret struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := vaultRequest(http.MethodGet, "/v1/"+path, token, nil, &secret); err != nil {
+		return "", err
+	}
+	data := secret.Data
+	// KV version 2 nests the fields under data.data
+	if nested, ok := data["data"].(map[string]any); ok {
+		if _, versioned := data["metadata"]; versioned {
+			data = nested
+		}
+	}
+	value, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no field %q", path, field)
+	}
+	return value, nil
+}
+
+// 📌 Token for Vault requests: VAULT_TOKEN or a Kubernetes auth login
+func vaultLogin() (string, error) {
+	if vaultToken != "" {
+		return vaultToken, nil
+	}
+	if vaultRole == "" {
+		return "", errors.New("set VAULT_TOKEN or VAULT_ROLE")
+	}
+
+	vaultMu.Lock()
+	defer vaultMu.Unlock()
+	if vaultSession != "" {
+		return vaultSession, nil
+	}
+	jwt, err := os.ReadFile(vaultJWTFile)
+	if err != nil {
+		return "", err
+	}
+	var login struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	body := map[string]string{"role": vaultRole, "jwt": strings.TrimSpace(string(jwt))}
+	if err := vaultRequest(http.MethodPost, "/v1/auth/"+strings.Trim(vaultAuthPath, "/")+"/login", "", body, &login); err != nil {
+		return "", fmt.Errorf("vault login: %w", err)
+	}
+	vaultSession = login.Auth.ClientToken
+	return vaultSession, nil
+}
+
+// 📌 Send a JSON request to Vault
+func vaultRequest(method, path, token string, body any, target any) error {
+	var payload io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = strings.NewReader(string(encoded))
+	}
+	req, err := http.NewRequest(method, vaultAddr+path, payload)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if vaultNamespace != "" {
+		req.Header.Set("X-Vault-Namespace", vaultNamespace)
+	}
+
+	resp, err := vaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusForbidden && token != "" && token != vaultToken {
+			// Expired Kubernetes auth token, log in again on the next read
+			vaultMu.Lock()
+			vaultSession = ""
+			vaultMu.Unlock()
+		}
+		return fmt.Errorf("vault returned %s for %s", resp.Status, path)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(target)
+}
+
+// 📌 Read a setting re-fetched by refreshSecrets
+func readSecret(value *string) string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	return *value
+}
+
+// Credentials re-fetched by refreshSecrets, in the order they are applied
+var rotatedSecrets = []string{"API_KEYS", "ADMIN_TOKEN", "PEER_TOKEN", "CALLBACK_SECRET", "TELEGRAM_BOT_TOKEN", "SLACK_SIGNING_SECRET", "REPORT_SMTP_PASSWORD"}
+
+// 📌 Fetch the credentials given as secret references again and apply the rotated ones
+func refreshSecrets() {
+	apply := map[string]func(string){
+		"API_KEYS":             func(value string) { apiKeys = parseAPIKeys(value) },
+		"ADMIN_TOKEN":          func(value string) { adminToken = value },
+		"PEER_TOKEN":           func(value string) { peerToken = value },
+		"CALLBACK_SECRET":      func(value string) { callbackSecret = value },
+		"TELEGRAM_BOT_TOKEN":   func(value string) { telegramToken = value },
+		"SLACK_SIGNING_SECRET": func(value string) { slackSigningSecret = value },
+		"REPORT_SMTP_PASSWORD": func(value string) { reportSMTPPassword = value },
+	}
+	for _, key := range rotatedSecrets {
+		set := apply[key]
+		ref := rawSetting(key)
+		if key == "PEER_TOKEN" && ref == "" {
+			// The peer token defaults to the admin token
+			ref = rawSetting("ADMIN_TOKEN")
+		}
+		if !isSecretRef(ref) {
+			continue
+		}
+		value, err := resolveSecret(ref)
+		if err != nil || value == "" {
+			log.Printf("[WARNING] Re-fetching secret of %s failed, keeping the current value: %v", key, err)
+			continue
+		}
+		secretsMu.Lock()
+		set(value)
+		secretsMu.Unlock()
+	}
+}
+
+// 📌 Check whether any re-fetchable credential is a secret reference
+func usesSecretRefs() bool {
+	for _, key := range rotatedSecrets {
+		if isSecretRef(rawSetting(key)) {
+			return true
+		}
+	}
+	return false
+}
+
+// 📌 Re-fetch secrets periodically so rotated credentials apply without a restart
+func runSecretsRefresh() {
+	ticker := time.NewTicker(secretsRefreshInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		refreshSecrets()
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	// Set by the Lambda runtime, MODE=serverless without it serves HTTP on PORT (Cloud Functions, Cloud Run)
+	lambdaRuntimeAPI = getEnv("AWS_LAMBDA_RUNTIME_API", "")
+
+	// Loaded snapshots are checked for a newer one at most every WATCH_INTERVAL, in the background of a request
+	serverlessCheckedAt  time.Time
+	serverlessRefreshing bool
+	serverlessMu         sync.Mutex
+
+	lambdaClient = &http.Client{}
+)
+
+// API Gateway (REST and HTTP API), Lambda function URL or ALB request event
+type lambdaEvent struct {
+	Version                         string              `json:"version"`
+	RawPath                         string              `json:"rawPath"`
+	RawQueryString                  string              `json:"rawQueryString"`
+	Cookies                         []string            `json:"cookies"`
+	HTTPMethod                      string              `json:"httpMethod"`
+	Path                            string              `json:"path"`
+	QueryStringParameters           map[string]string   `json:"queryStringParameters"`
+	MultiValueQueryStringParameters map[string][]string `json:"multiValueQueryStringParameters"`
+	Headers                         map[string]string   `json:"headers"`
+	MultiValueHeaders               map[string][]string `json:"multiValueHeaders"`
+	Body                            string              `json:"body"`
+	IsBase64Encoded                 bool                `json:"isBase64Encoded"`
+	RequestContext                  struct {
+		HTTP struct {
+			Method   string `json:"method"`
+			SourceIP string `json:"sourceIp"`
+		} `json:"http"`
+		Identity struct {
+			SourceIP string `json:"sourceIp"`
+		} `json:"identity"`
+	} `json:"requestContext"`
+}
+
+// Response to an HTTP event, the payload format follows the event
+type lambdaResponse struct {
+	StatusCode        int                 `json:"statusCode"`
+	Headers           map[string]string   `json:"headers,omitempty"`
+	MultiValueHeaders map[string][]string `json:"multiValueHeaders,omitempty"`
+	Cookies           []string            `json:"cookies,omitempty"`
+	Body              string              `json:"body"`
+	IsBase64Encoded   bool                `json:"isBase64Encoded"`
+}
+
+// 📌 Load the published snapshot once on cold start, there is no updater loop to retry later
+func startServerless() {
+	serverlessCheckedAt = time.Now()
+	if err := loadServerlessSnapshot(); err != nil {
+		log.Fatalf("[ERROR] Loading the snapshot failed: %v", err)
+	}
+}
+
+// 📌 Download and load the published snapshot, unless it is unchanged
+func loadServerlessSnapshot() error {
+	jsonFile, cleanup, err := fetchData()
+	if errors.Is(err, errNotModified) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	return loadData(jsonFile)
+}
+
+// 📌 Look for a newer snapshot in the background, unless one was checked within WATCH_INTERVAL or a check is running
+func refreshServerlessDataset() {
+	serverlessMu.Lock()
+	if serverlessRefreshing || time.Since(serverlessCheckedAt) < watchInterval {
+		serverlessMu.Unlock()
+		return
+	}
+	serverlessCheckedAt, serverlessRefreshing = time.Now(), true
+	serverlessMu.Unlock()
+
+	// Requests keep being answered from the loaded dataset; on Lambda the download only progresses during invocations
+	go func() {
+		if err := loadServerlessSnapshot(); err != nil {
+			log.Printf("[WARNING] Loading the published snapshot failed, serving the loaded one: %v", err)
+		}
+		serverlessMu.Lock()
+		serverlessRefreshing = false
+		serverlessMu.Unlock()
+	}()
+}
+
+// 📌 Start a check for a newer snapshot with requests, a warm environment may live for hours
+func serverlessRefresh(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		refreshServerlessDataset()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// 📌 Address to listen on outside Lambda, the platform passes the port in PORT
+func serverlessListenAddr() string {
+	if port := os.Getenv("PORT"); port != "" && os.Getenv("LISTEN_ADDR") == "" {
+		return ":" + port
+	}
+	return listenAddr
+}
+
+// 📌 Serve invocations of the Lambda runtime API until the environment is shut down
+func serveLambda(handler http.Handler) error {
+	base := "http://" + lambdaRuntimeAPI + "/2018-06-01/runtime/invocation/"
+	log.Printf("[INFO] Serving Lambda invocations from %s", lambdaRuntimeAPI)
+	for {
+		resp, err := lambdaClient.Get(base + "next")
+		if err != nil {
+			return err
+		}
+		payload, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("Lambda runtime API answered %s", resp.Status)
+		}
+		requestID := resp.Header.Get("Lambda-Runtime-Aws-Request-Id")
+
+		ctx := context.Background()
+		cancel := func() {}
+		if deadline, err := strconv.ParseInt(resp.Header.Get("Lambda-Runtime-Deadline-Ms"), 10, 64); err == nil {
+			// Streams such as /events end before Lambda cuts the invocation off
+			ctx, cancel = context.WithDeadline(ctx, time.UnixMilli(deadline).Add(-time.Second))
+		}
+		reply, err := invokeLambda(ctx, handler, payload)
+		cancel()
+
+		if err != nil {
+			log.Printf("[ERROR] Lambda invocation %s failed: %v", requestID, err)
+			body, _ := json.Marshal(map[string]string{"errorMessage": err.Error(), "errorType": "InvalidEvent"})
+			err = postLambda(base+requestID+"/error", body)
+		} else {
+			err = postLambda(base+requestID+"/response", reply)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// 📌 Post an invocation result to the Lambda runtime API
+func postLambda(target string, body []byte) error {
+	resp, err := lambdaClient.Post(target, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("Lambda runtime API answered %s", resp.Status)
+	}
+	return nil
+}
+
+// 📌 Serve one HTTP event through the handler and encode the response in the event's format
+func invokeLambda(ctx context.Context, handler http.Handler, payload []byte) ([]byte, error) {
+	var event lambdaEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	req, err := event.request(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	result := recorder.Result()
+	body := recorder.Body.Bytes()
+
+	if result.Header.Get("Content-Type") == "" && len(body) > 0 {
+		// net/http sniffs it on the first write, the recorder only before WriteHeader
+		result.Header.Set("Content-Type", http.DetectContentType(body))
+	}
+	reply := lambdaResponse{StatusCode: result.StatusCode}
+	if utf8.Valid(body) {
+		reply.Body = string(body)
+	} else {
+		reply.Body, reply.IsBase64Encoded = base64.StdEncoding.EncodeToString(body), true
+	}
+	if event.Version == "2.0" {
+		reply.Headers = make(map[string]string, len(result.Header))
+		for name, values := range result.Header {
+			if name == "Set-Cookie" {
+				reply.Cookies = values
+				continue
+			}
+			reply.Headers[name] = strings.Join(values, ", ")
+		}
+	} else {
+		reply.MultiValueHeaders = result.Header
+	}
+	return json.Marshal(reply)
+}
+
+// 📌 Build the HTTP request of an event, payload format 2.0 or 1.0
+func (event lambdaEvent) request(ctx context.Context) (*http.Request, error) {
+	method, path, sourceIP := event.RequestContext.HTTP.Method, event.RawPath, event.RequestContext.HTTP.SourceIP
+	query := event.RawQueryString
+	if event.Version != "2.0" {
+		method, path, sourceIP = event.HTTPMethod, event.Path, event.RequestContext.Identity.SourceIP
+		values := url.Values{}
+		for name, value := range event.QueryStringParameters {
+			values.Set(name, value)
+		}
+		for name, list := range event.MultiValueQueryStringParameters {
+			values[name] = list
+		}
+		query = values.Encode()
+	}
+	if method == "" || path == "" {
+		return nil, errors.New("not an HTTP event (API Gateway, function URL or ALB)")
+	}
+
+	body := []byte(event.Body)
+	if event.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(event.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = decoded
+	}
+	target := path
+	if query != "" {
+		target += "?" + query
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range event.Headers {
+		req.Header.Set(name, value)
+	}
+	for name, list := range event.MultiValueHeaders {
+		req.Header[http.CanonicalHeaderKey(name)] = list
+	}
+	for _, cookie := range event.Cookies {
+		req.Header.Add("Cookie", cookie)
+	}
+	req.Host = req.Header.Get("Host")
+	req.RemoteAddr = net.JoinHostPort(sourceIP, "0")
+	return req, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// Second instance receiving a copy of live /verify traffic, responses are compared and never returned
+	shadowURL = strings.TrimSuffix(getEnv("SHADOW_URL", ""), "/")
+	// Share of /verify requests mirrored, 0 to 100
+	shadowPercent = getEnvFloat("SHADOW_PERCENT", 100)
+	// X-API-Key sent to the shadow instance
+	shadowAPIKey = getSecret("SHADOW_API_KEY", "")
+	// Mirrored requests in flight at most, further ones are dropped so live traffic never waits
+	shadowSlots = make(chan struct{}, max(1, getEnvInt("SHADOW_CONCURRENCY", 16)))
+
+	shadowClient = &http.Client{Timeout: 30 * time.Second}
+
+	shadowMatched  atomic.Int64
+	shadowDiffered atomic.Int64
+	shadowFailed   atomic.Int64
+	shadowDropped  atomic.Int64
+)
+
+// 📌 Send a copy of a served /verify request to SHADOW_URL and log a difference in the answer
+func shadowRequest(r *http.Request, nip string, bank string, live Response) {
+	if shadowURL == "" || rand.Float64()*100 >= shadowPercent {
+		return
+	}
+	select {
+	case shadowSlots <- struct{}{}:
+	default:
+		shadowDropped.Add(1)
+		return
+	}
+
+	// The copy must not watch pairs or trace on the shadow's side
+	query := url.Values{"nip": {nip}}
+	if bank != "" {
+		query.Set("bank", bank)
+	}
+	target := shadowURL + r.URL.Path + "?" + query.Encode()
+	go func() {
+		defer func() { <-shadowSlots }()
+		req, err := http.NewRequest(http.MethodGet, target, nil)
+		if err != nil {
+			shadowFailed.Add(1)
+			return
+		}
+		if shadowAPIKey != "" {
+			req.Header.Set("X-API-Key", shadowAPIKey)
+		}
+
+		var shadow Response
+		resp, err := shadowClient.Do(req)
+		if err == nil {
+			err = json.NewDecoder(resp.Body).Decode(&shadow)
+			resp.Body.Close()
+		}
+		switch {
+		case err != nil:
+			if shadowFailed.Add(1) == 1 {
+				// The request URL carries the NIP and account, log only the cause
+				var urlErr *url.Error
+				if errors.As(err, &urlErr) {
+					err = urlErr.Err
+				}
+				log.Printf("[WARNING] Shadow request to %s failed: %v", shadowURL, err)
+			}
+		case shadow.Response == live.Response && shadow.Status == live.Status && shadow.Bank == live.Bank &&
+			bytes.Equal(shadow.AccountAssigned, live.AccountAssigned):
+			shadowMatched.Add(1)
+		default:
+			shadowDiffered.Add(1)
+			log.Printf("[WARNING] Shadow difference for NIP %s, bank %s: live %s/%s/%s (date %s), shadow %s/%s/%s (date %s)",
+				anonymize(nip), anonymize(bank), live.Response, live.Status, live.Bank, live.Date, shadow.Response, shadow.Status, shadow.Bank, shadow.Date)
+		}
+	}()
+}
+
+// 📌 Outcomes of mirrored requests for /metrics
+func shadowMetrics() []metric {
+	if shadowURL == "" {
+		return nil
+	}
+	return []metric{
+		{"vatbank_shadow_matched_total", "counter", "Mirrored requests answered like the live instance.", float64(shadowMatched.Load())},
+		{"vatbank_shadow_differed_total", "counter", "Mirrored requests answered differently than the live instance.", float64(shadowDiffered.Load())},
+		{"vatbank_shadow_failed_total", "counter", "Mirrored requests that got no readable answer.", float64(shadowFailed.Load())},
+		{"vatbank_shadow_dropped_total", "counter", "Requests not mirrored because SHADOW_CONCURRENCY was reached.", float64(shadowDropped.Load())},
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Requests signed longer ago are rejected as replays
+const slackMaxRequestAge = 5 * time.Minute
+
+// Host of the response_url Slack sends with a slash command, answers are posted nowhere else
+const slackResponseHost = "hooks.slack.com"
+
+var (
+	// Signing secret of the Slack app, /slack is disabled when empty
+	slackSigningSecret = getSecret("SLACK_SIGNING_SECRET", "")
+	// "ephemeral" answers only the caller, "in_channel" posts the answer for the whole channel
+	slackResponseType = getEnv("SLACK_RESPONSE_TYPE", "ephemeral")
+
+	slackClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// 📌 Check the X-Slack-Signature of a request: v0=HMAC-SHA256("v0:<timestamp>:<body>")
+func validSlackSignature(r *http.Request, body []byte, now time.Time) bool {
+	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > slackMaxRequestAge || age < -slackMaxRequestAge {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(readSecret(&slackSigningSecret)))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Slack-Signature")))
+}
+
+// 📌 Handle /slack API endpoint: a slash command such as "/vat 5270103391 26..." sent by Slack
+func slackHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Use POST"})
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 64*1024))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Request body too large"})
+		return
+	}
+	if !validSlackSignature(r, body, time.Now()) {
+		log.Printf("[WARNING] Rejected a Slack request with an invalid or expired signature")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Invalid Slack signature"})
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Invalid slash command payload"})
+		return
+	}
+
+	tenant, text := "slack:"+form.Get("team_id")+"/"+form.Get("user_id"), form.Get("text")
+	if _, _, ok := parseChatQuery(text); !ok {
+		// Slack shows the message itself, replying 200 even for a failed check
+		w.Header().Set("Content-Type", "application/json")
+		usage := "Usage: " + form.Get("command") + " NIP [bank account], e.g. " + form.Get("command") + " 1111111111 61 1090 1014 0000 0712 1981 2874"
+		json.NewEncoder(w).Encode(map[string]string{"response_type": "ephemeral", "text": usage})
+		return
+	}
+
+	// Slack gives up after 3 seconds, a proxied or queued check may take longer
+	responseURL, err := url.Parse(form.Get("response_url"))
+	if err != nil || responseURL.Scheme != "https" || responseURL.Host != slackResponseHost {
+		answer, _ := chatAnswer(tenant, "slack", text)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"response_type": slackResponseType, "text": answer})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	go func() {
+		answer, _ := chatAnswer(tenant, "slack", text)
+		if err := postSlackResponse(responseURL.String(), answer); err != nil {
+			log.Printf("[ERROR] Posting the Slack answer failed: %v", err)
+		}
+	}()
+}
+
+// 📌 Post a slash command answer to its response_url
+func postSlackResponse(target string, text string) error {
+	payload, err := json.Marshal(map[string]string{"response_type": slackResponseType, "text": text})
+	if err != nil {
+		return err
+	}
+	resp, err := slackClient.Post(target, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Slack returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// 📌 Version tag of the loaded dataset, a republished file with the same date and counts still gets a new one
+func datasetETag() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return fmt.Sprintf(`"%s-%s"`, dataDate, datasetDigest)
+}
+
+// 📌 Digest of the dataset content, independent of the order of the hashes so a snapshot digests like its source file
+func digestDataset(date string, transforms int, active map[string]bool, exempt map[string]bool, datasetMasks []string) string {
+	digest := sha256.New()
+	fmt.Fprintf(digest, "%s\x00%d\x00", date, transforms)
+	for _, hashes := range []map[string]bool{active, exempt} {
+		// Per-hash digests are summed lane by lane, so map order does not matter
+		var lanes [4]uint64
+		for hash := range hashes {
+			sum := sha256.Sum256([]byte(hash))
+			for i := range lanes {
+				lanes[i] += binary.BigEndian.Uint64(sum[i*8:])
+			}
+		}
+		fmt.Fprintf(digest, "%d-%x-", len(hashes), lanes)
+	}
+	sortedMasks := slices.Clone(datasetMasks)
+	slices.Sort(sortedMasks)
+	fmt.Fprint(digest, strings.Join(sortedMasks, ","))
+	return hex.EncodeToString(digest.Sum(nil))[:32]
+}
+
+// 📌 Write the loaded dataset as gzip-compressed flat-file JSON
+func writeSnapshot(w io.Writer) error {
+	// Maps are replaced, never modified, so they can be read without the lock
+	mu.RLock()
+	date, transforms := dataDate, iterations
+	active, exempt, currentMasks := activeHashes, exemptHashes, masks
+	mu.RUnlock()
+
+	compressed := gzip.NewWriter(w)
+	buffered := bufio.NewWriterSize(compressed, 1<<20)
+
+	var structure DataStructure
+	structure.Header.DataDate = date
+	structure.Header.TransformCount = strconv.Itoa(transforms)
+	header, _ := json.Marshal(structure.Header)
+	maskList, _ := json.Marshal(currentMasks)
+
+	buffered.WriteString(`{"naglowek":`)
+	buffered.Write(header)
+	writeHashList(buffered, "skrotyPodatnikowCzynnych", active)
+	writeHashList(buffered, "skrotyPodatnikowZwolnionych", exempt)
+	buffered.WriteString(`,"maski":`)
+	buffered.Write(maskList)
+	buffered.WriteString("}\n")
+
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	return compressed.Close()
+}
+
+// 📌 Write a JSON array of hashes (hex strings need no escaping)
+func writeHashList(w *bufio.Writer, name string, hashes map[string]bool) {
+	w.WriteString(`,"` + name + `":[`)
+	first := true
+	for hash := range hashes {
+		if !first {
+			w.WriteByte(',')
+		}
+		first = false
+		w.WriteByte('"')
+		w.WriteString(hash)
+		w.WriteByte('"')
+	}
+	w.WriteByte(']')
+}
+
+// 📌 Handle /snapshot API endpoint
+func snapshotHandler(w http.ResponseWriter, r *http.Request) {
+	mu.RLock()
+	loaded := activeHashes != nil
+	currentDataDate := dataDate
+	mu.RUnlock()
+
+	etag := datasetETag()
+
+	if !loaded {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "No dataset loaded yet"})
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Data-Date", currentDataDate)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+currentDataDate+`.json.gz"`)
+	if err := writeSnapshot(w); err != nil {
+		// Headers are sent already, the peer sees a truncated gzip stream
+		log.Printf("[ERROR] Writing snapshot failed: %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import "time"
+
+// Data older than this is flagged with warning STALE_DATA
+var staleAfter = getEnvDuration("STALE_AFTER", 36*time.Hour)
+
+// 📌 Age of a data date (YYYYMMDD), counted from midnight Europe/Warsaw
+func dataAge(date string) (time.Duration, bool) {
+	start, err := time.ParseInLocation("20060102", date, warsaw)
+	if err != nil {
+		return 0, false
+	}
+	return time.Since(start), true
+}
+
+// 📌 Add dataAgeHours and the stale-data warning to a verification response
+func annotateDataAge(result *Response) {
+	age, ok := dataAge(result.Date)
+	if !ok {
+		return
+	}
+
+	hours := int(age.Hours())
+	result.DataAgeHours = &hours
+	if age > staleAfter {
+		result.Warning = "STALE_DATA"
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Largest accepted bank statement
+const statementMaxBytes = 64 << 20
+
+var (
+	// Split payment remittance (/VAT/.../IDC/<NIP>/INV/...) and free text "NIP 123-456-78-90"
+	splitPaymentNIP = regexp.MustCompile(`/IDC/([0-9]{10})(?:/|$)`)
+	textNIP         = regexp.MustCompile(`(?i)\bNIP\b[\s:.]*(?:PL)?([0-9]{3}-?[0-9]{3}-?[0-9]{2}-?[0-9]{2}|[0-9]{3}-?[0-9]{2}-?[0-9]{2}-?[0-9]{3})\b`)
+	// MT940 field tag at the start of a line, e.g. ":61:" or ":60F:"
+	mt940Tag = regexp.MustCompile(`^:([0-9]{2}[A-Z]?):`)
+	// MT940 statement line: value date, optional entry date, debit/credit mark, funds code, amount
+	mt940Line = regexp.MustCompile(`^([0-9]{6})([0-9]{4})?(RC|RD|C|D)[A-Z]?([0-9]+,[0-9]*)`)
+)
+
+// Single outgoing payment of a bank statement
+type StatementPayment struct {
+	Index       int    `json:"index"`
+	Date        string `json:"bookingDate,omitempty"`
+	Amount      string `json:"amount,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Account     string `json:"account,omitempty"`
+	NIP         string `json:"nip,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Why the payment was SKIPPED: NO_ACCOUNT, FOREIGN_ACCOUNT or NO_NIP
+	Reason string `json:"reason,omitempty"`
+	Response
+}
+
+// Counterparty screening of a statement, Exceptions lists every outgoing payment that did not match
+type StatementReport struct {
+	Response   string             `json:"response"`
+	Format     string             `json:"format"`
+	Payments   int                `json:"payments"`
+	Summary    map[string]int     `json:"summary"`
+	Exceptions []StatementPayment `json:"exceptions"`
+}
+
+// 📌 Find a NIP in a payment description, split payment IDC first
+func extractNIP(text string) string {
+	if match := splitPaymentNIP.FindStringSubmatch(text); match != nil {
+		return match[1]
+	}
+	if match := textNIP.FindStringSubmatch(text); match != nil {
+		return strings.ReplaceAll(match[1], "-", "")
+	}
+	return ""
+}
+
+// 📌 Read the outgoing payments of an MT940 statement
+func parseMT940(r io.Reader) ([]StatementPayment, error) {
+	var payments []StatementPayment
+	var tag string
+	var value strings.Builder
+
+	flush := func() {
+		text := strings.TrimSpace(value.String())
+		switch tag {
+		case "61":
+			// Only debits are outgoing, credits and reversals are skipped
+			payment := StatementPayment{Index: -1}
+			if match := mt940Line.FindStringSubmatch(text); match != nil && match[3] == "D" {
+				payment = StatementPayment{Date: "20" + match[1], Amount: strings.Replace(match[4], ",", ".", 1)}
+			}
+			payments = append(payments, payment)
+		case "86":
+			if len(payments) > 0 {
+				applyMT940Details(&payments[len(payments)-1], text)
+			}
+		}
+		tag = ""
+		value.Reset()
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if match := mt940Tag.FindStringSubmatch(line); match != nil {
+			flush()
+			tag = match[1]
+			value.WriteString(line[len(match[0]):])
+			continue
+		}
+		if strings.HasPrefix(line, "-") {
+			flush()
+			continue
+		}
+		// Continuation lines of :86: are joined without a separator, its subfields carry their own
+		value.WriteString(line)
+	}
+	flush()
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	outgoing := payments[:0]
+	for _, payment := range payments {
+		if payment.Index != -1 {
+			outgoing = append(outgoing, payment)
+		}
+	}
+	return outgoing, nil
+}
+
+// 📌 Apply a Polish structured :86: field (~20-~25 description, ~32/~33 name, ~38 IBAN)
+func applyMT940Details(payment *StatementPayment, text string) {
+	separator := ""
+	for _, candidate := range []string{"~", "^", "<"} {
+		if strings.Contains(text, candidate+"20") || strings.Contains(text, candidate+"38") {
+			separator = candidate
+			break
+		}
+	}
+	if separator == "" {
+		payment.Description = text
+		payment.NIP = extractNIP(text)
+		return
+	}
+
+	fields := map[string]string{}
+	for _, part := range strings.Split(text, separator)[1:] {
+		if len(part) >= 2 {
+			fields[part[:2]] += part[2:]
+		}
+	}
+	payment.Description = fields["20"] + fields["21"] + fields["22"] + fields["23"] + fields["24"] + fields["25"]
+	payment.Name = strings.TrimSpace(fields["32"] + fields["33"])
+	if fields["38"] != "" {
+		payment.Account = strings.ToUpper(strings.ReplaceAll(fields["38"], " ", ""))
+	} else if account := normalizeAccount(fields["31"]); len(account) == 26 {
+		payment.Account = account
+	}
+	payment.NIP = extractNIP(payment.Description)
+}
+
+// Fields of a camt.053 entry needed for screening, namespaces are ignored
+type camtEntry struct {
+	Amount    string `xml:"Amt"`
+	Direction string `xml:"CdtDbtInd"`
+	Date      string `xml:"BookgDt>Dt"`
+	DateTime  string `xml:"BookgDt>DtTm"`
+	Details   []struct {
+		Name       string   `xml:"RltdPties>Cdtr>Nm"`
+		NameV8     string   `xml:"RltdPties>Cdtr>Pty>Nm"`
+		PartyID    string   `xml:"RltdPties>Cdtr>Id>OrgId>Othr>Id"`
+		IBAN       string   `xml:"RltdPties>CdtrAcct>Id>IBAN"`
+		Other      string   `xml:"RltdPties>CdtrAcct>Id>Othr>Id"`
+		Remittance []string `xml:"RmtInf>Ustrd"`
+	} `xml:"NtryDtls>TxDtls"`
+}
+
+// 📌 Read the outgoing payments of a camt.053 statement
+func parseCamt053(r io.Reader) ([]StatementPayment, error) {
+	var payments []StatementPayment
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return payments, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "Ntry" {
+			continue
+		}
+
+		var entry camtEntry
+		if err := decoder.DecodeElement(&entry, &start); err != nil {
+			return nil, err
+		}
+		if entry.Direction != "DBIT" {
+			continue
+		}
+		date := entry.Date
+		if date == "" && len(entry.DateTime) >= 10 {
+			date = entry.DateTime[:10]
+		}
+
+		// Batch bookings carry one transaction detail per payment
+		for _, details := range entry.Details {
+			payment := StatementPayment{
+				Date:        strings.ReplaceAll(date, "-", ""),
+				Amount:      strings.TrimSpace(entry.Amount),
+				Name:        strings.TrimSpace(details.Name + details.NameV8),
+				Description: strings.Join(details.Remittance, " "),
+				Account:     strings.ToUpper(strings.ReplaceAll(details.IBAN+details.Other, " ", "")),
+			}
+			if id := strings.TrimPrefix(strings.ReplaceAll(details.PartyID, "-", ""), "PL"); len(id) == 10 && isDigits(id) {
+				payment.NIP = id
+			} else {
+				payment.NIP = extractNIP(payment.Description)
+			}
+			payments = append(payments, payment)
+		}
+		if len(entry.Details) == 0 {
+			payments = append(payments, StatementPayment{Date: strings.ReplaceAll(date, "-", ""), Amount: strings.TrimSpace(entry.Amount)})
+		}
+	}
+}
+
+// 📌 Handle /verify/statement API endpoint, screening outgoing payments of an MT940 or camt.053 statement
+func statementHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Use POST"})
+		return
+	}
+
+	// camt.053 is XML, anything else is read as MT940
+	body := bufio.NewReader(http.MaxBytesReader(w, r.Body, statementMaxBytes))
+	head, _ := body.Peek(512)
+	report := StatementReport{Response: "OK", Format: "MT940", Summary: map[string]int{}, Exceptions: []StatementPayment{}}
+	var payments []StatementPayment
+	var err error
+	if bytes.HasPrefix(bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xEF\xBB\xBF")), " \t\r\n"), []byte("<")) {
+		report.Format = "camt.053"
+		payments, err = parseCamt053(body)
+	} else {
+		payments, err = parseMT940(body)
+	}
+	if err != nil {
+		recordError("invalid_statement")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Invalid " + report.Format + " statement: " + err.Error()})
+		return
+	}
+
+	problem := datasetProblem()
+	if problem != "" {
+		if status, result := unavailableResponse(problem); status != http.StatusOK {
+			recordError("dataset_unavailable")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(result)
+			return
+		}
+	}
+
+	tenant := tenantFromRequest(r)
+	var items []BatchItem
+	var itemIndexes []int
+	for i := range payments {
+		payment := &payments[i]
+		payment.Index = i
+		payment.Account = strings.TrimPrefix(payment.Account, "PL")
+		switch {
+		case payment.Account == "":
+			payment.Reason = "NO_ACCOUNT"
+		case !isDigits(payment.Account):
+			payment.Reason = "FOREIGN_ACCOUNT"
+		case payment.NIP == "":
+			payment.Reason = "NO_NIP"
+		}
+		if payment.Reason != "" {
+			payment.Response = Response{Response: "SKIPPED"}
+			continue
+		}
+		if category, fields := validateInput(payment.NIP, payment.Account); category != "" {
+			recordError(category)
+			payment.Response = validationResponse(fields)
+			continue
+		}
+		if problem != "" {
+			_, payment.Response = unavailableResponse(problem)
+			continue
+		}
+		items = append(items, BatchItem{NIP: payment.NIP, Bank: payment.Account})
+		itemIndexes = append(itemIndexes, i)
+	}
+	verifyBatch(items, func(indexes []int, result Response) {
+		// Every payment index belongs to exactly one unique item
+		for _, index := range indexes {
+			payments[itemIndexes[index]].Response = result
+		}
+	})
+
+	report.Payments = len(payments)
+	for _, payment := range payments {
+		outcome := payment.Reason
+		switch {
+		case outcome != "":
+		case payment.Response.Response == "ERROR":
+			outcome = "INVALID"
+		default:
+			outcome = payment.Bank
+			recordRequest(payment.NIP, payment.Account, payment.Response)
+			recordUsage(tenant, payment.Status)
+			recordStats(payment.Response, true)
+		}
+		report.Summary[outcome]++
+		if outcome != "MATCHED" {
+			report.Exceptions = append(report.Exceptions, payment)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// One bucket per minute for the last 24 hours
+const statsBuckets = 24 * 60
+
+type statsBucket struct {
+	minute   int64
+	counters map[string]uint64
+}
+
+var (
+	statsRing [statsBuckets]statsBucket
+	statsMu   sync.Mutex
+)
+
+// Verification counters for a time window
+type StatsWindow struct {
+	Results   map[string]uint64 `json:"results"`
+	BankMatch map[string]uint64 `json:"bankMatch"`
+	Errors    map[string]uint64 `json:"errors"`
+}
+
+// 📌 Increment a counter in the current minute bucket
+func incrementStat(group string, name string) {
+	statsdSend("verify_"+group, 1, "c", group+":"+strings.ToLower(name))
+
+	minute := time.Now().Unix() / 60
+
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	bucket := &statsRing[minute%statsBuckets]
+	if bucket.minute != minute || bucket.counters == nil {
+		bucket.minute = minute
+		bucket.counters = make(map[string]uint64)
+	}
+	bucket.counters[group+":"+name]++
+}
+
+// 📌 Count a completed verification by result and bank match type
+func recordStats(result Response, bankRequested bool) {
+	incrementStat("result", result.Status)
+	if bankRequested {
+		incrementStat("match", result.match)
+	}
+}
+
+// 📌 Count a rejected request by error category
+func recordError(category string) {
+	incrementStat("error", category)
+}
+
+// 📌 Sum the buckets of the last `minutes` minutes
+func statsWindow(minutes int64) StatsWindow {
+	window := StatsWindow{Results: map[string]uint64{}, BankMatch: map[string]uint64{}, Errors: map[string]uint64{}}
+	groups := map[string]map[string]uint64{"result": window.Results, "match": window.BankMatch, "error": window.Errors}
+	now := time.Now().Unix() / 60
+
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	for _, bucket := range statsRing {
+		if bucket.counters == nil || bucket.minute <= now-minutes {
+			continue
+		}
+		for key, count := range bucket.counters {
+			group, name, _ := strings.Cut(key, ":")
+			groups[group][name] += count
+		}
+	}
+	return window
+}
+
+// 📌 Handle /stats API endpoint
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(struct {
+		LastHour StatsWindow `json:"lastHour"`
+		LastDay  StatsWindow `json:"lastDay"`
+	}{statsWindow(60), statsWindow(statsBuckets)})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// StatsD/DogStatsD agent address (host:port), disabled when empty
+	statsdAddress  = getEnv("STATSD_ADDR", "")
+	statsdPrefix   = getEnv("STATSD_PREFIX", "vatbank.")
+	statsdTags     = getEnv("STATSD_TAGS", "")
+	statsdDogTags  = getEnvBool("STATSD_DOGSTATSD", true)
+	statsdInterval = getEnvDuration("STATSD_INTERVAL", 10*time.Second)
+
+	statsdConn net.Conn
+)
+
+// 📌 Connect to the StatsD agent and start publishing gauges
+func startStatsD() error {
+	if statsdAddress == "" {
+		return nil
+	}
+
+	conn, err := net.Dial("udp", statsdAddress)
+	if err != nil {
+		return err
+	}
+	statsdConn = conn
+	log.Printf("[INFO] Sending StatsD metrics to %s", statsdAddress)
+
+	go func() {
+		for {
+			for _, m := range collectMetrics() {
+				if m.kind == "gauge" {
+					statsdSend(strings.TrimPrefix(m.name, "vatbank_"), m.value, "g", "")
+				}
+			}
+			time.Sleep(statsdInterval)
+		}
+	}()
+	return nil
+}
+
+// 📌 Send a single StatsD line; DogStatsD tags are used for the label when enabled
+func statsdSend(name string, value float64, kind string, label string) {
+	if statsdConn == nil {
+		return
+	}
+
+	name = statsdPrefix + strings.ReplaceAll(name, "_", ".")
+	tags := statsdTags
+	if label != "" {
+		if statsdDogTags {
+			tags = strings.Trim(tags+","+label, ",")
+		} else {
+			// Plain StatsD has no tags, append the value to the metric name
+			_, value, _ := strings.Cut(label, ":")
+			name += "." + value
+		}
+	}
+
+	line := name + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|" + kind
+	if statsdDogTags && tags != "" {
+		line += "|#" + tags
+	}
+	// UDP is fire-and-forget, a missing agent must not affect requests
+	_, _ = statsdConn.Write([]byte(line))
+}
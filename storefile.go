@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Managed API keys of the file store
+var apiKeysFile = getEnv("API_KEYS_FILE", filepath.Join(dataDir, "apikeys.json"))
+
+// Default store: confirmations as JSON Lines, watchlist and keys as JSON files rewritten on change
+type fileStore struct {
+	mu          sync.Mutex
+	confirmFile *os.File
+	watchlist   map[string]*WatchEntry
+	keys        []StoredAPIKey
+}
+
+// 📌 Open the confirmations file and load the watchlist and managed keys
+func openFileStore() (*fileStore, error) {
+	file, err := os.OpenFile(confirmationsFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	s := &fileStore{confirmFile: file, watchlist: make(map[string]*WatchEntry)}
+
+	var entries []*WatchEntry
+	if err := readSealedJSONFile(watchlistFile, &entries); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("watchlist %s: %w", watchlistFile, err)
+	}
+	for _, entry := range entries {
+		s.watchlist[watchKey(entry.Tenant, entry.NIP, entry.Bank)] = entry
+	}
+	if len(entries) > 0 {
+		log.Printf("[INFO] Loaded %d watchlist entries", len(entries))
+	}
+	if err := readJSONFile(apiKeysFile, &s.keys); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("API keys %s: %w", apiKeysFile, err)
+	}
+	return s, nil
+}
+
+// 📌 Read a JSON file, a missing file leaves target untouched
+func readJSONFile(path string, target any) error {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, target)
+}
+
+// 📌 Read a JSON file written by writeSealedJSONFile, files written without encryption pass through
+func readSealedJSONFile(path string, target any) error {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if content, err = openRecord(content); err != nil {
+		return err
+	}
+	return json.Unmarshal(content, target)
+}
+
+// 📌 Write a JSON file through a sibling and a rename so a crash never leaves half a file
+func writeJSONFile(path string, value any) error {
+	content, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	return replaceFile(path, content)
+}
+
+// 📌 Write a JSON file holding counterparty data, encrypted as one record when encryption is enabled
+func writeSealedJSONFile(path string, value any) error {
+	content, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	if content, err = sealRecord(content); err != nil {
+		return err
+	}
+	return replaceFile(path, content)
+}
+
+// 📌 Replace a file's content through a sibling and a rename
+func replaceFile(path string, content []byte) error {
+	temporary := path + ".tmp"
+	if err := os.WriteFile(temporary, content, 0o640); err != nil {
+		return err
+	}
+	return os.Rename(temporary, path)
+}
+
+func (s *fileStore) AppendConfirmation(confirmation Confirmation) error {
+	line, err := json.Marshal(confirmation)
+	if err != nil {
+		return err
+	}
+	if line, err = sealRecord(line); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.confirmFile.Write(append(line, '\n'))
+	return err
+}
+
+func (s *fileStore) Confirmations(from, to time.Time, tenant string) ([]Confirmation, error) {
+	file, err := os.Open(confirmationsFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var matching []Confirmation
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var confirmation Confirmation
+		line, err := openRecord(scanner.Bytes())
+		if err == nil {
+			err = json.Unmarshal(line, &confirmation)
+		}
+		if err != nil {
+			log.Printf("[WARNING] Skipping unreadable confirmation line: %v", err)
+			continue
+		}
+		if confirmation.Time.Before(from) || !confirmation.Time.Before(to) {
+			continue
+		}
+		if tenant != "" && confirmation.Tenant != tenant {
+			continue
+		}
+		matching = append(matching, confirmation)
+	}
+	return matching, scanner.Err()
+}
+
+func (s *fileStore) WatchEntries(tenant string) ([]WatchEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := []WatchEntry{}
+	for _, entry := range s.watchlist {
+		if tenant == "" || entry.Tenant == tenant {
+			entries = append(entries, *entry)
+		}
+	}
+	return entries, nil
+}
+
+func (s *fileStore) WatchEntry(tenant, nip, bank string) (*WatchEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.watchlist[watchKey(tenant, nip, bank)]
+	if !ok {
+		return nil, nil
+	}
+	copied := *entry
+	return &copied, nil
+}
+
+func (s *fileStore) PutWatchEntry(entry WatchEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := watchKey(entry.Tenant, entry.NIP, entry.Bank)
+	previous, ok := s.watchlist[key]
+	s.watchlist[key] = &entry
+	// A repeated verification only moves checkedAt, which is written with the next change or recheck
+	if ok && sameWatchState(previous, &entry) {
+		return nil
+	}
+	return s.saveWatchlist()
+}
+
+// 📌 Check whether two entries differ at most in checkedAt
+func sameWatchState(a *WatchEntry, b *WatchEntry) bool {
+	sameChange := (a.ChangedAt == nil) == (b.ChangedAt == nil) && (a.ChangedAt == nil || a.ChangedAt.Equal(*b.ChangedAt))
+	return a.Status == b.Status && a.BankStatus == b.BankStatus && a.PreviousStatus == b.PreviousStatus &&
+		a.AddedAt.Equal(b.AddedAt) && sameChange
+}
+
+func (s *fileStore) PutWatchEntries(entries []WatchEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range entries {
+		s.watchlist[watchKey(entry.Tenant, entry.NIP, entry.Bank)] = &entry
+	}
+	return s.saveWatchlist()
+}
+
+func (s *fileStore) DeleteWatchEntry(tenant, nip, bank string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := watchKey(tenant, nip, bank)
+	if _, ok := s.watchlist[key]; !ok {
+		return false, nil
+	}
+	delete(s.watchlist, key)
+	return true, s.saveWatchlist()
+}
+
+// 📌 Persist the watchlist, the caller holds s.mu
+func (s *fileStore) saveWatchlist() error {
+	entries := make([]*WatchEntry, 0, len(s.watchlist))
+	for _, entry := range s.watchlist {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return watchKey(entries[i].Tenant, entries[i].NIP, entries[i].Bank) < watchKey(entries[j].Tenant, entries[j].NIP, entries[j].Bank)
+	})
+	return writeSealedJSONFile(watchlistFile, entries)
+}
+
+func (s *fileStore) APIKeys() ([]StoredAPIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]StoredAPIKey(nil), s.keys...), nil
+}
+
+func (s *fileStore) AddAPIKey(key StoredAPIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.keys {
+		if existing.Name == key.Name {
+			return errAPIKeyExists
+		}
+	}
+	s.keys = append(s.keys, key)
+	if err := writeJSONFile(apiKeysFile, s.keys); err != nil {
+		// Keep memory and file in step, the key was never handed out
+		s.keys = s.keys[:len(s.keys)-1]
+		return err
+	}
+	return nil
+}
+
+func (s *fileStore) DeleteAPIKey(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, existing := range s.keys {
+		if existing.Name == name {
+			s.keys = append(s.keys[:i], s.keys[i+1:]...)
+			return true, writeJSONFile(apiKeysFile, s.keys)
+		}
+	}
+	return false, nil
+}
+
+func (s *fileStore) Close() error {
+	return s.confirmFile.Close()
+}
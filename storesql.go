@@ -0,0 +1,306 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// Tables shared by SQLite and PostgreSQL, records are kept as JSON next to the columns they are queried by
+var sqlSchema = []string{
+	`CREATE TABLE IF NOT EXISTS confirmations (
+		id TEXT PRIMARY KEY,
+		issued_at TEXT NOT NULL,
+		tenant TEXT NOT NULL,
+		data TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS confirmations_issued_at ON confirmations (issued_at)`,
+	`CREATE TABLE IF NOT EXISTS watchlist (
+		tenant TEXT NOT NULL,
+		nip TEXT NOT NULL,
+		bank_account TEXT NOT NULL,
+		data TEXT NOT NULL,
+		PRIMARY KEY (tenant, nip, bank_account)
+	)`,
+	`CREATE TABLE IF NOT EXISTS store_keys (
+		name TEXT PRIMARY KEY,
+		data TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS api_keys (
+		name TEXT PRIMARY KEY,
+		key_sha256 TEXT NOT NULL UNIQUE,
+		data TEXT NOT NULL
+	)`,
+}
+
+// Store in an embedded SQLite file or a shared PostgreSQL database
+type sqlStore struct {
+	db     *sql.DB
+	driver string
+	// Key of the watchlist nip and bank_account digests, nil without encryption
+	indexKey []byte
+}
+
+// 📌 Connect to the database and create missing tables
+func openSQLStore(driver, dsn string) (*sqlStore, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if driver == "sqlite" {
+		// A single connection avoids SQLITE_BUSY between writers of the same process
+		db.SetMaxOpenConns(1)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	for _, statement := range sqlSchema {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("creating schema: %w", err)
+		}
+	}
+	s := &sqlStore{db: db, driver: driver}
+	if encryptionEnabled() {
+		if err := s.openIndexKey(); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("watchlist index key: %w", err)
+		}
+		if err := s.sealWatchlist(); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("encrypting the watchlist: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// 📌 Read the watchlist index key, created once and stored encrypted so every replica and restart shares it
+func (s *sqlStore) openIndexKey() error {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	sealed, err := sealRecord([]byte(base64.StdEncoding.EncodeToString(key)))
+	if err != nil {
+		return err
+	}
+	// The first replica to start wins, the others read its key
+	if _, err := s.db.Exec(s.bind(`INSERT INTO store_keys (name, data) VALUES (?, ?) ON CONFLICT (name) DO NOTHING`), "watchlist_index", string(sealed)); err != nil {
+		return err
+	}
+	var stored string
+	if err := s.db.QueryRow(s.bind(`SELECT data FROM store_keys WHERE name = ?`), "watchlist_index").Scan(&stored); err != nil {
+		return err
+	}
+	encoded, err := openRecord([]byte(stored))
+	if err != nil {
+		return err
+	}
+	s.indexKey, err = base64.StdEncoding.DecodeString(string(encoded))
+	return err
+}
+
+// 📌 Digest of a NIP or account for the watchlist key columns, the value itself without encryption
+func (s *sqlStore) blind(value string) string {
+	if s.indexKey == nil || value == "" {
+		return value
+	}
+	return "hmac:" + hex.EncodeToString(hmacSHA256(s.indexKey, value))
+}
+
+// 📌 Encrypt watchlist rows written before encryption was enabled
+func (s *sqlStore) sealWatchlist() error {
+	entries, err := queryJSON[WatchEntry](s, `SELECT data FROM watchlist WHERE nip NOT LIKE 'hmac:%'`)
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+	for _, entry := range entries {
+		if _, err := s.db.Exec(s.bind(`DELETE FROM watchlist WHERE tenant = ? AND nip = ? AND bank_account = ?`), entry.Tenant, entry.NIP, entry.Bank); err != nil {
+			return err
+		}
+		if err := s.PutWatchEntry(entry); err != nil {
+			return err
+		}
+	}
+	log.Printf("[INFO] Encrypted %d watchlist entries", len(entries))
+	return nil
+}
+
+// 📌 Rewrite ? placeholders as $1, $2, … for PostgreSQL
+func (s *sqlStore) bind(query string) string {
+	if s.driver != "postgres" {
+		return query
+	}
+	var bound strings.Builder
+	position := 0
+	for _, char := range query {
+		if char == '?' {
+			position++
+			bound.WriteString("$" + strconv.Itoa(position))
+			continue
+		}
+		bound.WriteRune(char)
+	}
+	return bound.String()
+}
+
+// 📌 Run a query and decode the JSON data column of every row
+func queryJSON[T any](s *sqlStore, query string, args ...any) ([]T, error) {
+	rows, err := s.db.Query(s.bind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []T
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var record T
+		plaintext, err := openRecord([]byte(data))
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(plaintext, &record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func (s *sqlStore) AppendConfirmation(confirmation Confirmation) error {
+	data, err := json.Marshal(confirmation)
+	if err != nil {
+		return err
+	}
+	if data, err = sealRecord(data); err != nil {
+		return err
+	}
+	_, err = s.db.Exec(s.bind(`INSERT INTO confirmations (id, issued_at, tenant, data) VALUES (?, ?, ?, ?)`),
+		confirmation.ID, storeTime(confirmation.Time), confirmation.Tenant, string(data))
+	return err
+}
+
+func (s *sqlStore) Confirmations(from, to time.Time, tenant string) ([]Confirmation, error) {
+	query := `SELECT data FROM confirmations WHERE issued_at >= ? AND issued_at < ?`
+	args := []any{storeTime(from), storeTime(to)}
+	if tenant != "" {
+		query += ` AND tenant = ?`
+		args = append(args, tenant)
+	}
+	return queryJSON[Confirmation](s, query+` ORDER BY issued_at`, args...)
+}
+
+func (s *sqlStore) WatchEntries(tenant string) ([]WatchEntry, error) {
+	var entries []WatchEntry
+	var err error
+	if tenant == "" {
+		entries, err = queryJSON[WatchEntry](s, `SELECT data FROM watchlist`)
+	} else {
+		entries, err = queryJSON[WatchEntry](s, `SELECT data FROM watchlist WHERE tenant = ?`, tenant)
+	}
+	if entries == nil {
+		entries = []WatchEntry{}
+	}
+	return entries, err
+}
+
+func (s *sqlStore) WatchEntry(tenant, nip, bank string) (*WatchEntry, error) {
+	entries, err := queryJSON[WatchEntry](s, `SELECT data FROM watchlist WHERE tenant = ? AND nip = ? AND bank_account = ?`, tenant, s.blind(nip), s.blind(bank))
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	return &entries[0], nil
+}
+
+func (s *sqlStore) PutWatchEntry(entry WatchEntry) error {
+	return s.putWatchEntry(s.db, entry)
+}
+
+func (s *sqlStore) PutWatchEntries(entries []WatchEntry) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := s.putWatchEntry(tx, entry); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// 📌 Insert or update a watchlist entry through the database or a transaction
+func (s *sqlStore) putWatchEntry(db interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}, entry WatchEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if data, err = sealRecord(data); err != nil {
+		return err
+	}
+	_, err = db.Exec(s.bind(`INSERT INTO watchlist (tenant, nip, bank_account, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (tenant, nip, bank_account) DO UPDATE SET data = excluded.data`),
+		entry.Tenant, s.blind(entry.NIP), s.blind(entry.Bank), string(data))
+	return err
+}
+
+func (s *sqlStore) DeleteWatchEntry(tenant, nip, bank string) (bool, error) {
+	result, err := s.db.Exec(s.bind(`DELETE FROM watchlist WHERE tenant = ? AND nip = ? AND bank_account = ?`), tenant, s.blind(nip), s.blind(bank))
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func (s *sqlStore) APIKeys() ([]StoredAPIKey, error) {
+	return queryJSON[StoredAPIKey](s, `SELECT data FROM api_keys ORDER BY name`)
+}
+
+func (s *sqlStore) AddAPIKey(key StoredAPIKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	result, err := s.db.Exec(s.bind(`INSERT INTO api_keys (name, key_sha256, data) VALUES (?, ?, ?) ON CONFLICT DO NOTHING`), key.Name, key.KeySHA256, string(data))
+	if err != nil {
+		return err
+	}
+	if inserted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if inserted == 0 {
+		return errAPIKeyExists
+	}
+	return nil
+}
+
+func (s *sqlStore) DeleteAPIKey(name string) (bool, error) {
+	result, err := s.db.Exec(s.bind(`DELETE FROM api_keys WHERE name = ?`), name)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
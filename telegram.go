@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Seconds a getUpdates call waits for new messages (long polling)
+const telegramPollTimeout = 50
+
+var (
+	// Token from @BotFather, the bot is disabled when empty
+	telegramToken = getSecret("TELEGRAM_BOT_TOKEN", "")
+	// Comma-separated Telegram user IDs or @usernames allowed to use the bot
+	telegramAllowed = parseTelegramAllowed(getEnv("TELEGRAM_ALLOWED_USERS", ""))
+	// Bot API base URL, a local Bot API server can be used instead
+	telegramAPIURL = strings.TrimSuffix(getEnv("TELEGRAM_API_URL", "https://api.telegram.org"), "/")
+
+	telegramClient = &http.Client{Timeout: (telegramPollTimeout + 10) * time.Second}
+)
+
+// Fields of a Bot API update used by the bot
+type telegramUpdate struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *struct {
+		MessageID int64 `json:"message_id"`
+		From      struct {
+			ID       int64  `json:"id"`
+			Username string `json:"username"`
+		} `json:"from"`
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		Text string `json:"text"`
+	} `json:"message"`
+}
+
+// 📌 Parse the allowlist, user IDs as digits and usernames in lower case without "@"
+func parseTelegramAllowed(value string) map[string]bool {
+	allowed := make(map[string]bool)
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(entry), "@")); entry != "" {
+			allowed[entry] = true
+		}
+	}
+	return allowed
+}
+
+// 📌 Call a Bot API method, decoding its result into target
+func telegramCall(method string, request any, target any) error {
+	token := readSecret(&telegramToken)
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	resp, err := telegramClient.Post(telegramAPIURL+"/bot"+token+"/"+method, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		// The token is part of the URL, keep it out of the logs
+		return errors.New(strings.ReplaceAll(err.Error(), token, "<token>"))
+	}
+	defer resp.Body.Close()
+
+	var reply struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return fmt.Errorf("%s returned %s", method, resp.Status)
+	}
+	if !reply.OK {
+		return fmt.Errorf("%s failed: %s", method, reply.Description)
+	}
+	if target != nil {
+		return json.Unmarshal(reply.Result, target)
+	}
+	return nil
+}
+
+// 📌 Long-poll the Bot API and answer messages of allowlisted users
+func runTelegramBot() {
+	log.Printf("[INFO] Telegram bot started for %d allowed users", len(telegramAllowed))
+	var offset int64
+	for {
+		var updates []telegramUpdate
+		err := telegramCall("getUpdates", map[string]any{"offset": offset, "timeout": telegramPollTimeout, "allowed_updates": []string{"message"}}, &updates)
+		if err != nil {
+			log.Printf("[WARNING] Telegram polling failed: %v", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			message := update.Message
+			if message == nil || message.Text == "" {
+				continue
+			}
+
+			userID := strconv.FormatInt(message.From.ID, 10)
+			var reply string
+			if !telegramAllowed[userID] && (message.From.Username == "" || !telegramAllowed[strings.ToLower(message.From.Username)]) {
+				log.Printf("[WARNING] Telegram user %s is not in TELEGRAM_ALLOWED_USERS", userID)
+				reply = "You are not allowed to use this bot. Your Telegram user ID is " + userID + "."
+			} else if answer, ok := chatAnswer("telegram:"+userID, "telegram", message.Text); ok {
+				reply = answer
+			} else {
+				reply = "Send a NIP and optionally a bank account, e.g.\n1111111111 61 1090 1014 0000 0712 1981 2874"
+			}
+
+			err := telegramCall("sendMessage", map[string]any{"chat_id": message.Chat.ID, "text": reply, "reply_to_message_id": message.MessageID}, nil)
+			if err != nil {
+				log.Printf("[WARNING] Telegram reply failed: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+// Single lookup performed while verifying a request
+type TraceStep struct {
+	// "nip", "account" or "mask" ("mock" in mock mode)
+	Check string `json:"check"`
+	Mask  string `json:"mask,omitempty"`
+	// Value that was hashed: data date + NIP [+ account or masked account]
+	Input   string `json:"input,omitempty"`
+	Outcome string `json:"outcome"`
+}
+
+// Ordered list of lookups, a nil *Trace records nothing
+type Trace []TraceStep
+
+// 📌 Append a step when tracing is enabled
+func (t *Trace) add(step TraceStep) {
+	if t != nil {
+		*t = append(*t, step)
+	}
+}
+
+// 📌 Outcome of a single hash lookup
+func traceOutcome(isActive bool, isExempt bool) string {
+	switch {
+	case isActive:
+		return "ACTIVE"
+	case isExempt:
+		return "EXEMPT"
+	default:
+		return "NOT_FOUND"
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 📌 Upload a file to S3-compatible storage
+func uploadS3Object(key string, source string) error {
+	objectURL, err := s3ObjectURL(key)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, objectURL.String(), file)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/gzip")
+	if s3AccessKey != "" && s3SecretKey != "" {
+		signS3Request(req, time.Now())
+	}
+
+	log.Printf("[INFO] Uploading: s3://%s/%s", s3Bucket, key)
+	resp, err := s3Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// 📌 Write the loaded dataset as a gzip snapshot file, renamed into place so watchers never see half a file
+func writeSnapshotFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	temporary := path + ".tmp"
+	file, err := os.OpenFile(temporary, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	if err := writeSnapshot(file); err != nil {
+		file.Close()
+		_ = os.Remove(temporary)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(temporary)
+		return err
+	}
+	return os.Rename(temporary, path)
+}
+
+// 📌 Run the update subcommand: download, validate and write a snapshot once, e.g. from a CronJob
+func runUpdate(args []string) int {
+	flags := flag.NewFlagSet("update", flag.ExitOnError)
+	output := flags.String("out", filepath.Join(dataDir, "snapshots", "{DATE}.json.gz"),
+		"snapshot file to write, or s3:<key> for S3_BUCKET ({DATE} is the data date)")
+	flags.Parse(args)
+
+	if err := ensureDir(tmpDir); err != nil {
+		log.Printf("[ERROR] Directory %s is not writable: %v", tmpDir, err)
+		return 1
+	}
+	if dataSource == "file" {
+		if err := reloadFromDisk(); err != nil {
+			log.Printf("[ERROR] Loading %s failed: %v", dataPath, err)
+			return 1
+		}
+	} else {
+		log.Printf("[INFO] Starting data update from %s...", dataSource)
+		jsonFile, cleanup, err := fetchData()
+		if err != nil {
+			log.Printf("[ERROR] Fetching data failed: %s", err)
+			return 1
+		}
+		err = loadData(jsonFile)
+		cleanup()
+		if err != nil {
+			return 1
+		}
+	}
+
+	mu.RLock()
+	date := dataDate
+	mu.RUnlock()
+	target := strings.ReplaceAll(*output, "{DATE}", date)
+
+	key, toS3 := strings.CutPrefix(target, "s3:")
+	path := target
+	if toS3 {
+		path = filepath.Join(tmpDir, date+".json.gz")
+		defer os.Remove(path)
+	}
+	if err := writeSnapshotFile(path); err != nil {
+		log.Printf("[ERROR] Writing snapshot %s failed: %v", path, err)
+		return 1
+	}
+	if toS3 {
+		if err := uploadS3Object(key, path); err != nil {
+			log.Printf("[ERROR] Uploading snapshot failed: %v", err)
+			return 1
+		}
+	}
+	log.Printf("[INFO] Snapshot for %s written to %s", date, target)
+	pruneRetained()
+	return 0
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// Periodic JSON Lines export of per-tenant usage, disabled when empty
+	usageExportFile     = getEnv("USAGE_EXPORT_FILE", "")
+	usageExportInterval = getEnvDuration("USAGE_EXPORT_INTERVAL", time.Hour)
+
+	usageCounts = make(map[string]map[string]uint64)
+	usageSince  = time.Now()
+	usageMu     sync.Mutex
+)
+
+// Per-tenant request counts by status
+type UsageReport struct {
+	Since   time.Time                    `json:"since"`
+	Time    time.Time                    `json:"time"`
+	Tenants map[string]map[string]uint64 `json:"tenants"`
+}
+
+// 📌 Count a request for a tenant by result status (ERROR for rejected requests)
+func recordUsage(tenant string, status string) {
+	if tenant == "" {
+		return
+	}
+
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	counts, ok := usageCounts[tenant]
+	if !ok {
+		counts = make(map[string]uint64)
+		usageCounts[tenant] = counts
+	}
+	counts[status]++
+}
+
+// 📌 Copy the current usage counters
+func usageReport() UsageReport {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+
+	report := UsageReport{Since: usageSince, Time: time.Now(), Tenants: make(map[string]map[string]uint64, len(usageCounts))}
+	for tenant, counts := range usageCounts {
+		copied := make(map[string]uint64, len(counts))
+		for status, count := range counts {
+			copied[status] = count
+		}
+		report.Tenants[tenant] = copied
+	}
+	return report
+}
+
+// 📌 Handle /admin/usage API endpoint
+func usageHandler(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(usageReport())
+}
+
+// 📌 Periodically append the usage counters to USAGE_EXPORT_FILE
+func exportUsage() {
+	if usageExportFile == "" {
+		return
+	}
+
+	for {
+		time.Sleep(usageExportInterval)
+
+		file, err := os.OpenFile(usageExportFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+		if err != nil {
+			log.Printf("[ERROR] Usage export failed: %v", err)
+			continue
+		}
+		if err := json.NewEncoder(file).Encode(usageReport()); err != nil {
+			log.Printf("[ERROR] Usage export failed: %v", err)
+		}
+		file.Close()
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import "pl-vatbank-checker/flatfile"
+
+// Reject NIPs and bank accounts with a wrong check digit (enabled by default)
+var validateChecksums = getEnvBool("VALIDATE_CHECKSUMS", true)
+
+// Single offending input field of a rejected request
+type FieldError = flatfile.FieldError
+
+// 📌 Validate a single verification input, returns the error category and the offending fields
+func validateInput(nip string, bank string) (string, []FieldError) {
+	return flatfile.ValidateInput(nip, bank, validateChecksums)
+}
+
+// 📌 Error response listing the offending fields
+func validationResponse(fields []FieldError) Response {
+	message := "Invalid parameters"
+	if len(fields) == 1 {
+		message = fields[0].Message
+	}
+	return Response{Response: "ERROR", Message: message, Errors: fields}
+}
+
+// 📌 Check that a value is non-empty and contains only ASCII digits
+func isDigits(value string) bool {
+	return flatfile.IsDigits(value)
+}
+
+// 📌 Check the NIP check digit (weighted sum modulo 11)
+func validNIPChecksum(nip string) bool {
+	return flatfile.ValidNIPChecksum(nip)
+}
+
+// 📌 Check the NRB check digits (IBAN modulo 97 with the PL country code)
+func validNRBChecksum(nrb string) bool {
+	return flatfile.ValidNRBChecksum(nrb)
+}
@@ -0,0 +1,75 @@
+//go:build js && wasm
+
+// Verification core for browsers and edge workers, built with
+//
+//	GOOS=js GOARCH=wasm go build -o vatbank.wasm ./wasm
+//
+// It registers vatbankLoad and vatbankVerify on the global object, vatbank.js wraps them.
+package main
+
+import (
+	"bytes"
+	"syscall/js"
+
+	"pl-vatbank-checker/flatfile"
+)
+
+var dataset *flatfile.Dataset
+
+// 📌 vatbankLoad(Uint8Array): load an uncompressed flat file or snapshot, returns its header
+func load(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeObject {
+		return map[string]any{"response": "ERROR", "message": "Pass the flat file as a Uint8Array"}
+	}
+	data := make([]byte, args[0].Get("length").Int())
+	js.CopyBytesToGo(data, args[0])
+
+	loaded, err := flatfile.Load(bytes.NewReader(data))
+	if err != nil {
+		return map[string]any{"response": "ERROR", "message": "Flat file is not readable: " + err.Error()}
+	}
+	dataset = loaded
+	return map[string]any{
+		"response":   "OK",
+		"date":       dataset.Date,
+		"iterations": dataset.Iterations,
+		"active":     len(dataset.Active),
+		"exempt":     len(dataset.Exempt),
+		"masks":      len(dataset.Masks),
+	}
+}
+
+// 📌 vatbankVerify(nip, bank): verify like /verify, bank may be empty
+func verify(this js.Value, args []js.Value) any {
+	if dataset == nil {
+		return map[string]any{"response": "ERROR", "message": "No dataset loaded yet"}
+	}
+	nip, bank := "", ""
+	if len(args) > 0 && args[0].Type() == js.TypeString {
+		nip = args[0].String()
+	}
+	if len(args) > 1 && args[1].Type() == js.TypeString {
+		bank = args[1].String()
+	}
+	// Same rules and messages as the service, without check digits
+	if _, fields := flatfile.ValidateInput(nip, bank, false); len(fields) > 0 {
+		return map[string]any{"response": "ERROR", "message": fields[0].Message}
+	}
+
+	result := dataset.Lookup(nip, bank, nil)
+	response := map[string]any{"response": "OK", "status": result.Status, "bank": result.Bank, "date": dataset.Date}
+	// accountAssigned as in the /verify response, null without an account
+	if bank == "" {
+		response["accountAssigned"] = nil
+	} else {
+		response["accountAssigned"] = result.Match != "none"
+	}
+	return response
+}
+
+func main() {
+	js.Global().Set("vatbankLoad", js.FuncOf(load))
+	js.Global().Set("vatbankVerify", js.FuncOf(verify))
+	// Keep the exported functions callable
+	select {}
+}
@@ -0,0 +1,66 @@
+// Client-side VAT payer and bank account checks against a downloaded snapshot.
+//
+// Load wasm_exec.js from the Go distribution ($(go env GOROOT)/lib/wasm/wasm_exec.js) first, then:
+//
+//   const checker = await VatBank.init("vatbank.wasm");
+//   await checker.loadSnapshot("https://vatbank.example/snapshot", { headers: { "X-API-Key": key } });
+//   checker.verify("1234567890", "12345678901234567890123456");
+//   // { response: "OK", status: "ACTIVE", bank: "MATCHED", date: "20250101", accountAssigned: true }
+(function (root) {
+  "use strict";
+
+  // Decompress a gzip snapshot, flat files extracted from the MF archive pass unchanged
+  async function gunzip(bytes) {
+    if (bytes.length < 2 || bytes[0] !== 0x1f || bytes[1] !== 0x8b) {
+      return bytes;
+    }
+    const stream = new Blob([bytes]).stream().pipeThrough(new DecompressionStream("gzip"));
+    return new Uint8Array(await new Response(stream).arrayBuffer());
+  }
+
+  class VatBank {
+    // Start the WASM module, source is a URL, a Response or the module bytes
+    static async init(source) {
+      const go = new root.Go();
+      let result;
+      if (source instanceof ArrayBuffer || ArrayBuffer.isView(source)) {
+        result = await WebAssembly.instantiate(source, go.importObject);
+      } else {
+        const response = source instanceof Response ? source : await fetch(source);
+        result = await WebAssembly.instantiate(await response.arrayBuffer(), go.importObject);
+      }
+      go.run(result.instance);
+      return new VatBank();
+    }
+
+    // Load a flat file or /snapshot from bytes (gzip or plain JSON)
+    async load(bytes) {
+      const header = root.vatbankLoad(await gunzip(new Uint8Array(bytes)));
+      if (header.response !== "OK") {
+        throw new Error(header.message);
+      }
+      this.date = header.date;
+      return header;
+    }
+
+    // Download and load /snapshot, options are passed to fetch (e.g. the X-API-Key header)
+    async loadSnapshot(url, options) {
+      const response = await fetch(url, options);
+      if (!response.ok) {
+        throw new Error(`Snapshot download failed: HTTP ${response.status}`);
+      }
+      return this.load(await response.arrayBuffer());
+    }
+
+    // Verify a NIP and optional 26-digit bank account, answers like /verify
+    verify(nip, bank) {
+      return root.vatbankVerify(String(nip), bank ? String(bank) : "");
+    }
+  }
+
+  if (typeof module !== "undefined" && module.exports) {
+    module.exports = VatBank;
+  } else {
+    root.VatBank = VatBank;
+  }
+})(globalThis);
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Watched NIP/account pairs of the file store survive restarts in this file
+var watchlistFile = getEnv("WATCHLIST_FILE", filepath.Join(dataDir, "watchlist.json"))
+
+// Single monitored NIP/account pair of a tenant
+type WatchEntry struct {
+	Tenant     string    `json:"tenant"`
+	NIP        string    `json:"nip"`
+	Bank       string    `json:"bankAccount,omitempty"`
+	Status     string    `json:"status"`
+	BankStatus string    `json:"bank"`
+	AddedAt    time.Time `json:"addedAt"`
+	CheckedAt  time.Time `json:"checkedAt"`
+	// Set when a later dataset reported a different status than before
+	PreviousStatus string     `json:"previousStatus,omitempty"`
+	ChangedAt      *time.Time `json:"changedAt,omitempty"`
+}
+
+// Serializes read-modify-write sequences of watchlist entries and the status history
+var watchlistMu sync.Mutex
+
+// 📌 Key of a watchlist entry
+func watchKey(tenant, nip, bank string) string {
+	return tenant + "|" + nip + "|" + bank
+}
+
+// 📌 Add a verified pair to the tenant's watchlist, or refresh its last result
+func watchPair(tenant, nip, bank string, result Response) {
+	now := time.Now().UTC()
+
+	watchlistMu.Lock()
+	defer watchlistMu.Unlock()
+	entry, err := store.WatchEntry(tenant, nip, bank)
+	if err != nil {
+		log.Printf("[ERROR] Reading watchlist failed: %v", err)
+		return
+	}
+	if entry == nil {
+		entry = &WatchEntry{Tenant: tenant, NIP: nip, Bank: bank, AddedAt: now}
+		log.Printf("[INFO] Tenant %s started watching a NIP", tenant)
+	}
+	updateWatchEntry(entry, result, now)
+	if err := store.PutWatchEntry(*entry); err != nil {
+		log.Printf("[ERROR] Saving watchlist failed: %v", err)
+	}
+	saveHistoryLater()
+}
+
+// 📌 Store a verification result on an entry, remembering status changes
+func updateWatchEntry(entry *WatchEntry, result Response, now time.Time) bool {
+	changed := entry.Status != "" && (entry.Status != result.Status || entry.BankStatus != result.Bank)
+	if changed {
+		entry.PreviousStatus = entry.Status + "/" + entry.BankStatus
+		entry.ChangedAt = &now
+		log.Printf("[WARNING] Watched NIP %s of tenant %s changed from %s/%s to %s/%s",
+			entry.NIP, entry.Tenant, entry.Status, entry.BankStatus, result.Status, result.Bank)
+	}
+	entry.Status = result.Status
+	entry.BankStatus = result.Bank
+	entry.CheckedAt = now
+	recordHistory(entry, result, now)
+	return changed
+}
+
+// 📌 Verify every watched pair against the newly activated dataset, returns the entries whose status changed
+func recheckWatchlist() []WatchEntry {
+	if datasetProblem() != "" {
+		return nil
+	}
+
+	// Verify outside the lock so /verify?watch=true is never blocked by a recheck
+	pairs, err := store.WatchEntries("")
+	if err != nil {
+		log.Printf("[ERROR] Reading watchlist failed: %v", err)
+		return nil
+	}
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	results := make([]Response, len(pairs))
+	for i, pair := range pairs {
+		results[i] = verify(pair.NIP, pair.Bank)
+	}
+
+	now := time.Now().UTC()
+	var changes, updated []WatchEntry
+	watchlistMu.Lock()
+	defer watchlistMu.Unlock()
+	for i, pair := range pairs {
+		// Entries removed during the recheck stay removed
+		entry, err := store.WatchEntry(pair.Tenant, pair.NIP, pair.Bank)
+		if err != nil || entry == nil {
+			continue
+		}
+		if updateWatchEntry(entry, results[i], now) {
+			changes = append(changes, *entry)
+		}
+		updated = append(updated, *entry)
+	}
+	if err := store.PutWatchEntries(updated); err != nil {
+		log.Printf("[ERROR] Saving watchlist failed: %v", err)
+	}
+	saveHistoryLater()
+	log.Printf("[INFO] Rechecked %d watchlist entries", len(pairs))
+	return changes
+}
+
+// 📌 Handle /watchlist API endpoint, lists (GET) or removes (DELETE ?nip=&bank=) the tenant's entries
+func watchlistHandler(w http.ResponseWriter, r *http.Request) {
+	tenant := tenantFromRequest(r)
+	if tenant == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "The watchlist requires an API key, set API_KEYS"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		entries, err := store.WatchEntries(tenant)
+		if err != nil {
+			log.Printf("[ERROR] Reading watchlist failed: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Reading watchlist failed"})
+			return
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].NIP+entries[i].Bank < entries[j].NIP+entries[j].Bank
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	case http.MethodDelete:
+		watchlistMu.Lock()
+		ok, err := store.DeleteWatchEntry(tenant, r.URL.Query().Get("nip"), r.URL.Query().Get("bank"))
+		watchlistMu.Unlock()
+		if err != nil {
+			log.Printf("[ERROR] Saving watchlist failed: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Saving watchlist failed"})
+			return
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Not on the watchlist"})
+			return
+		}
+		json.NewEncoder(w).Encode(Response{Response: "OK", Message: "Removed from the watchlist"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "Use GET or DELETE"})
+	}
+}
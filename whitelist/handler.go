@@ -0,0 +1,97 @@
+package whitelist
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"pl-vatbank-checker/flatfile"
+)
+
+// Options of the embedded API
+type Options struct {
+	// Path the handler is mounted under, e.g. "/vat" serves /vat/verify; stripped before routing
+	Prefix string
+	// Accept NIPs and bank accounts with a wrong check digit, as VALIDATE_CHECKSUMS=false does in the service
+	SkipChecksums bool
+}
+
+// JSON response, the same fields as the service's /verify
+type Response struct {
+	Response string `json:"response"`
+	Status   string `json:"status,omitempty"`
+	Bank     string `json:"bank,omitempty"`
+	Date     string `json:"date,omitempty"`
+	Message  string `json:"message,omitempty"`
+	// Offending input fields of a rejected request
+	Errors          []flatfile.FieldError `json:"errors,omitempty"`
+	AccountAssigned json.RawMessage       `json:"accountAssigned,omitempty"`
+}
+
+// Single entry of a batch request of the service's /verify/batch
+type BatchItem struct {
+	NIP  string `json:"nip"`
+	Bank string `json:"bank,omitempty"`
+}
+
+type handler struct {
+	checker *Checker
+	options Options
+}
+
+// 📌 http.Handler serving GET /verify and GET /health against a Checker
+//
+// Batches stay with the service, which deduplicates items, applies the
+// unavailable policy and spreads them over its worker pools.
+func NewHandler(checker *Checker, options Options) http.Handler {
+	h := &handler{checker: checker, options: options}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /verify", h.verify)
+	mux.HandleFunc("GET /health", h.health)
+
+	prefix := strings.TrimSuffix(options.Prefix, "/")
+	if prefix == "" {
+		return mux
+	}
+	return http.StripPrefix(prefix, mux)
+}
+
+// 📌 Verify one NIP and optional bank account, a rejected input or missing dataset gives an ERROR response
+//
+// Validation and accountAssigned come from the flatfile package, as in the
+// service, so both answer the same input with the same codes and messages.
+func (h *handler) check(nip string, bank string) (int, Response) {
+	if _, fields := flatfile.ValidateInput(nip, bank, !h.options.SkipChecksums); len(fields) > 0 {
+		message := "Invalid parameters"
+		if len(fields) == 1 {
+			message = fields[0].Message
+		}
+		return http.StatusOK, Response{Response: "ERROR", Message: message, Errors: fields}
+	}
+
+	result, date, err := h.checker.Verify(nip, bank)
+	if err != nil {
+		return http.StatusServiceUnavailable, Response{Response: "ERROR", Message: "No dataset loaded yet"}
+	}
+	return http.StatusOK, Response{Response: "OK", Status: result.Status, Bank: result.Bank, Date: date, AccountAssigned: flatfile.AccountAssigned(bank, result.Match)}
+}
+
+// 📌 Handle /verify API endpoint
+func (h *handler) verify(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	status, result := h.check(query.Get("nip"), query.Get("bank"))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// 📌 Handle /health API endpoint, 503 until a dataset is loaded
+func (h *handler) health(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if h.checker.Date() == "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(Response{Response: "ERROR", Message: "No dataset loaded yet"})
+		return
+	}
+	json.NewEncoder(w).Encode(Response{Response: "OK", Message: "Service is running", Date: h.checker.Date()})
+}
@@ -0,0 +1,98 @@
+// Package whitelist serves the /verify API of pl-vatbank-checker from inside
+// another Go program. The embedding program loads a flat file or /snapshot
+// into a Checker and mounts NewHandler on its own mux, under its own
+// middleware and path prefix:
+//
+//	checker := whitelist.NewChecker()
+//	if err := checker.LoadFile("/data/snapshots/20250101.json.gz"); err != nil {
+//		log.Fatal(err)
+//	}
+//	mux.Handle("/vat/", auth(whitelist.NewHandler(checker, whitelist.Options{Prefix: "/vat"})))
+//
+// Downloading and refreshing the dataset stays with the caller, e.g. from a
+// pl-vatbank-checker instance's /snapshot or the standalone updater's output.
+package whitelist
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+
+	"pl-vatbank-checker/flatfile"
+)
+
+// Sentinel error of a verification before any dataset was loaded
+var ErrNotLoaded = errors.New("no dataset loaded yet")
+
+// Sentinel error of a NIP that is not 10 digits or a bank account that is not 26, wrapped with the reason
+var ErrInvalidInput = errors.New("invalid input")
+
+// Verifies against the most recently loaded dataset, safe for concurrent use
+type Checker struct {
+	// Accepted liczbaTransformacji, set before the first Load; 1 to flatfile.DefaultMaxIterations if not set
+	Limits flatfile.Limits
+
+	dataset atomic.Pointer[flatfile.Dataset]
+}
+
+// 📌 Create a Checker without a dataset, load one before serving
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// 📌 Replace the dataset with a flat file or snapshot, gzip-compressed or plain JSON
+func (c *Checker) Load(r io.Reader) error {
+	buffered := bufio.NewReader(r)
+	if magic, _ := buffered.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		decompressed, err := gzip.NewReader(buffered)
+		if err != nil {
+			return err
+		}
+		defer decompressed.Close()
+		r = decompressed
+	} else {
+		r = buffered
+	}
+
+	dataset, err := flatfile.LoadLimited(r, c.Limits)
+	if err != nil {
+		return err
+	}
+	c.dataset.Store(dataset)
+	return nil
+}
+
+// 📌 Replace the dataset with a flat file or snapshot on disk
+func (c *Checker) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return c.Load(file)
+}
+
+// 📌 Data date of the loaded dataset as YYYYMMDD, empty before the first Load
+func (c *Checker) Date() string {
+	if dataset := c.dataset.Load(); dataset != nil {
+		return dataset.Date
+	}
+	return ""
+}
+
+// 📌 Verify a NIP and optional 26-digit bank account, check digits are not validated
+func (c *Checker) Verify(nip string, bank string) (flatfile.Result, string, error) {
+	if _, fields := flatfile.ValidateInput(nip, bank, false); len(fields) > 0 {
+		return flatfile.Result{}, "", fmt.Errorf("%w: %s", ErrInvalidInput, fields[0].Message)
+	}
+	dataset := c.dataset.Load()
+	if dataset == nil {
+		return flatfile.Result{}, "", ErrNotLoaded
+	}
+	return dataset.Lookup(nip, bank, nil), dataset.Date, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Media type of Office Open XML workbooks
+const xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// Single worksheet, the first row is the bold header; cells are strings or ints
+type xlsxSheet struct {
+	Name string
+	Rows [][]any
+}
+
+// 📌 Check whether a request asks for an .xlsx workbook (?format=xlsx or Accept)
+func wantsXLSX(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "xlsx" || strings.Contains(r.Header.Get("Accept"), xlsxContentType)
+}
+
+// 📌 Send response headers of a workbook download
+func startXLSXDownload(w http.ResponseWriter, filename string) {
+	w.Header().Set("Content-Type", xlsxContentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+}
+
+// 📌 Write a minimal workbook; text is stored as inline UTF-8 strings so Polish characters survive any locale
+func writeXLSX(w io.Writer, sheets []xlsxSheet) error {
+	archive := zip.NewWriter(w)
+	files := map[string]string{
+		"_rels/.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`,
+		"xl/styles.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+			`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+			`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+			`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+			`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+			`</styleSheet>`,
+	}
+
+	var types, workbook, relations strings.Builder
+	types.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	workbook.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	relations.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i, sheet := range sheets {
+		number := strconv.Itoa(i + 1)
+		types.WriteString(`<Override PartName="/xl/worksheets/sheet` + number + `.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`)
+		workbook.WriteString(`<sheet name="` + xmlEscape(sheet.Name) + `" sheetId="` + number + `" r:id="rId` + number + `"/>`)
+		relations.WriteString(`<Relationship Id="rId` + number + `" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet` + number + `.xml"/>`)
+		files["xl/worksheets/sheet"+number+".xml"] = worksheetXML(sheet)
+	}
+	relations.WriteString(`<Relationship Id="rId` + strconv.Itoa(len(sheets)+1) + `" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`)
+	files["[Content_Types].xml"] = types.String() + `</Types>`
+	files["xl/workbook.xml"] = workbook.String() + `</sheets></workbook>`
+	files["xl/_rels/workbook.xml.rels"] = relations.String()
+
+	// [Content_Types].xml first, some readers expect it there
+	names := []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml"}
+	for i := range sheets {
+		names = append(names, "xl/worksheets/sheet"+strconv.Itoa(i+1)+".xml")
+	}
+	now := time.Now()
+	for _, name := range names {
+		file, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(file, files[name]); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// 📌 Render the XML of one worksheet with column widths fitted to the content
+func worksheetXML(sheet xlsxSheet) string {
+	var widths []int
+	for _, row := range sheet.Rows {
+		for i, value := range row {
+			if i >= len(widths) {
+				widths = append(widths, 8)
+			}
+			widths[i] = max(widths[i], min(utf8.RuneCountInString(fmt.Sprint(value))+2, 60))
+		}
+	}
+
+	var out strings.Builder
+	out.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	if len(widths) > 0 {
+		out.WriteString(`<cols>`)
+		for i, width := range widths {
+			fmt.Fprintf(&out, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, width)
+		}
+		out.WriteString(`</cols>`)
+	}
+	out.WriteString(`<sheetData>`)
+	for r, row := range sheet.Rows {
+		style := ""
+		if r == 0 {
+			style = ` s="1"`
+		}
+		fmt.Fprintf(&out, `<row r="%d">`, r+1)
+		for c, value := range row {
+			ref := columnName(c) + strconv.Itoa(r+1)
+			switch typed := value.(type) {
+			case int:
+				fmt.Fprintf(&out, `<c r="%s"%s><v>%d</v></c>`, ref, style, typed)
+			default:
+				text := fmt.Sprint(typed)
+				if text == "" {
+					continue
+				}
+				fmt.Fprintf(&out, `<c r="%s"%s t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, style, xmlEscape(text))
+			}
+		}
+		out.WriteString(`</row>`)
+	}
+	out.WriteString(`</sheetData></worksheet>`)
+	return out.String()
+}
+
+// 📌 Spreadsheet column letters of a zero-based index (0 → A, 26 → AA)
+func columnName(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
+
+// 📌 Escape text for XML, replacing characters XML cannot carry
+func xmlEscape(text string) string {
+	var escaped strings.Builder
+	xml.EscapeText(&escaped, []byte(text))
+	return escaped.String()
+}